@@ -0,0 +1,258 @@
+/*
+Package aggregate reduces the values found by the processors to totals and groups and reorders the found tags.
+*/
+package aggregate
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tty2/xq/internal/domain"
+)
+
+// Names of the aggregation functions.
+const (
+	Count = "count" // number of the values
+	Sum   = "sum"   // sum of the numbers
+	Avg   = "avg"   // average of the numbers
+	Min   = "min"   // the least value, numbers are compared as numbers
+	Max   = "max"   // the greatest value, numbers are compared as numbers
+)
+
+type (
+	// Source finds the values to aggregate.
+	Source interface {
+		Process(r *bufio.Reader) chan string
+		Err() error // error the source stopped with, it's known when the channel is closed
+	}
+
+	// Evaluator returns the values selected in the markup of a tag.
+	Evaluator func(tag []byte) ([]string, error)
+
+	// Aggregation prints result of the function applied to all the values found by the source:
+	// `sum(.PurchaseOrder.Items.Item.USPrice)`.
+	Aggregation struct {
+		source   Source
+		function string
+		err      error
+	}
+
+	// Groups groups the tags found by the source by the key and prints the groups ordered by the key.
+	// Every group is printed as the key and result of the function applied to the values of the group tags
+	// separated by tab: `group_by(.objects.object; .title#lang) | count`. Only keys are printed if there is
+	// no function.
+	Groups struct {
+		source   Source
+		key      Evaluator
+		value    Evaluator
+		function string
+		err      error
+	}
+
+	group struct {
+		key    string
+		tags   int
+		values []string
+	}
+)
+
+// New creates a new Aggregation of the values found by the source.
+func New(source Source, function string) *Aggregation {
+	return &Aggregation{
+		source:   source,
+		function: function,
+	}
+}
+
+// Process reads all the values found by the source and prints the result.
+func (a *Aggregation) Process(r *bufio.Reader) chan string {
+	ch := make(chan string)
+
+	go func() {
+		defer close(ch)
+
+		var values []string
+		for value := range a.source.Process(r) {
+			values = append(values, value)
+		}
+		if a.source.Err() != nil { // values of the part of the document aren't the result
+			return
+		}
+
+		res, err := Reduce(a.function, values)
+		if err != nil {
+			a.err = err
+
+			return
+		}
+		for _, v := range res {
+			ch <- v
+		}
+	}()
+
+	return ch
+}
+
+// Err returns the error the source or the aggregation stopped with.
+func (a *Aggregation) Err() error {
+	if a.err != nil {
+		return a.err
+	}
+
+	return a.source.Err()
+}
+
+// NewGroups creates a new Groups of the tags found by the source. Values of every tag are aggregated
+// by the function.
+func NewGroups(source Source, key, value Evaluator, function string) *Groups {
+	return &Groups{
+		source:   source,
+		key:      key,
+		value:    value,
+		function: function,
+	}
+}
+
+// Process reads all the tags found by the source and prints the groups.
+func (g *Groups) Process(r *bufio.Reader) chan string {
+	ch := make(chan string)
+
+	go func() {
+		defer close(ch)
+
+		tags := g.source.Process(r)
+		groups, err := g.collect(tags)
+		if err != nil {
+			g.err = err
+			for range tags { // the source is drained to let it finish
+			}
+
+			return
+		}
+		if g.source.Err() != nil {
+			return
+		}
+
+		for _, gr := range groups {
+			switch {
+			case g.function == "":
+				ch <- gr.key
+			case g.function == Count:
+				ch <- gr.key + "\t" + strconv.Itoa(gr.tags)
+			default:
+				res, err := Reduce(g.function, gr.values)
+				if err != nil {
+					g.err = err
+
+					return
+				}
+				ch <- gr.key + "\t" + strings.Join(res, "")
+			}
+		}
+	}()
+
+	return ch
+}
+
+// Err returns the error the source or the grouping stopped with.
+func (g *Groups) Err() error {
+	if g.err != nil {
+		return g.err
+	}
+
+	return g.source.Err()
+}
+
+// collect groups the tags by the key and returns the groups ordered by the key.
+func (g *Groups) collect(tags chan string) ([]*group, error) {
+	var groups []*group
+	byKey := map[string]*group{}
+	for tag := range tags {
+		keys, err := g.key([]byte(tag))
+		if err != nil {
+			return nil, err
+		}
+
+		var key string // tags without the key are grouped by empty key
+		if len(keys) > 0 {
+			key = keys[0]
+		}
+
+		gr, ok := byKey[key]
+		if !ok {
+			gr = &group{
+				key: key,
+			}
+			byKey[key] = gr
+			groups = append(groups, gr)
+		}
+		gr.tags++
+
+		if g.value == nil {
+			continue
+		}
+		values, err := g.value([]byte(tag))
+		if err != nil {
+			return nil, err
+		}
+		gr.values = append(gr.values, values...)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return domain.CompareValues(groups[i].key, groups[j].key) < 0
+	})
+
+	return groups, nil
+}
+
+// Reduce returns result of the function applied to the values. There is no result for average, minimum and
+// maximum of no values.
+func Reduce(function string, values []string) ([]string, error) {
+	var res string
+	switch function {
+	case Count:
+		res = strconv.Itoa(len(values))
+	case Sum, Avg:
+		if function == Avg && len(values) == 0 {
+			return []string{}, nil
+		}
+		var sum float64
+		for _, v := range values {
+			n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("function `%s` can't be applied to `%s`: value isn't a number", function, v)
+			}
+			sum += n
+		}
+		if function == Avg {
+			sum /= float64(len(values))
+		}
+		res = formatNumber(sum)
+	case Min, Max:
+		if len(values) == 0 {
+			return []string{}, nil
+		}
+		res = strings.TrimSpace(values[0])
+		for _, v := range values[1:] {
+			v = strings.TrimSpace(v)
+			c := domain.CompareValues(v, res)
+			if function == Min && c < 0 || function == Max && c > 0 {
+				res = v
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown aggregation function `%s`", function)
+	}
+
+	return []string{res}, nil
+}
+
+// formatNumber returns the number without errors of floating point arithmetic: `0.1 + 0.2` is `0.3`.
+func formatNumber(n float64) string {
+	n, _ = strconv.ParseFloat(strconv.FormatFloat(n, 'g', 15, 64), 64) // nolint errcheck: the number is formatted
+
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
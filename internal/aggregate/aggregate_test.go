@@ -0,0 +1,211 @@
+package aggregate
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type values []string
+
+func (v values) Process(*bufio.Reader) chan string {
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		for i := range v {
+			ch <- v[i]
+		}
+	}()
+
+	return ch
+}
+
+func (v values) Err() error {
+	return nil
+}
+
+// broken is a source which stops with the error after the values.
+type broken struct {
+	values
+}
+
+func (broken) Err() error {
+	return errors.New("incorrect xml structure")
+}
+
+// tracked is a source which closes done when all the values are read.
+type tracked struct {
+	values
+	done chan struct{}
+}
+
+func (t tracked) Process(r *bufio.Reader) chan string {
+	ch := make(chan string)
+	go func() {
+		defer close(t.done)
+		for v := range t.values.Process(r) {
+			ch <- v
+		}
+		close(ch)
+	}()
+
+	return ch
+}
+
+func collect(ch chan string) []string {
+	var res []string
+	for v := range ch {
+		res = append(res, v)
+	}
+
+	return res
+}
+
+func TestReduce(t *testing.T) {
+	t.Parallel()
+
+	t.Run("numbers", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for function, expected := range map[string]string{
+			Count: "4",
+			Sum:   "151.2",
+			Avg:   "37.8",
+			Min:   "0.1",
+			Max:   "100",
+		} {
+			res, err := Reduce(function, []string{"0.1", "100", " 0.2 ", "50.9"})
+			rq.NoError(err, function)
+			rq.Equal([]string{expected}, res, function)
+		}
+	})
+
+	t.Run("strings", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res, err := Reduce(Min, []string{"b", "10", "a"})
+		rq.NoError(err)
+		rq.Equal([]string{"10"}, res)
+
+		res, err = Reduce(Max, []string{"b", "10", "a"})
+		rq.NoError(err)
+		rq.Equal([]string{"b"}, res)
+
+		_, err = Reduce(Sum, []string{"1", "a"})
+		rq.Error(err)
+	})
+
+	t.Run("no values", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res, err := Reduce(Sum, nil)
+		rq.NoError(err)
+		rq.Equal([]string{"0"}, res)
+
+		for _, function := range []string{Avg, Min, Max} {
+			res, err = Reduce(function, nil)
+			rq.NoError(err)
+			rq.Empty(res)
+		}
+
+		_, err = Reduce("median", nil)
+		rq.Error(err)
+	})
+}
+
+func TestAggregation(t *testing.T) {
+	t.Parallel()
+
+	t.Run("sum", func(t *testing.T) {
+		t.Parallel()
+
+		res := collect(New(values{"1", "2.5"}, Sum).Process(nil))
+		require.Equal(t, []string{"3.5"}, res)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		a := New(values{"1", "x"}, Sum)
+		rq.Empty(collect(a.Process(nil)))
+		rq.EqualError(a.Err(), "function `sum` can't be applied to `x`: value isn't a number")
+
+		a = New(broken{values{"1"}}, Sum)
+		rq.Empty(collect(a.Process(nil)))
+		rq.EqualError(a.Err(), "incorrect xml structure")
+	})
+}
+
+func TestGroups(t *testing.T) {
+	t.Parallel()
+
+	// tags are `key:value1,value2`
+	key := func(tag []byte) ([]string, error) {
+		if i := strings.IndexByte(string(tag), ':'); i > 0 {
+			return []string{string(tag[:i])}, nil
+		}
+
+		return nil, nil
+	}
+	value := func(tag []byte) ([]string, error) {
+		i := strings.IndexByte(string(tag), ':')
+
+		return strings.Split(string(tag[i+1:]), ","), nil
+	}
+	tags := values{"b:1,2", "10:5", "a:3", "b:4", "9:1", ":7"}
+
+	t.Run("count", func(t *testing.T) {
+		t.Parallel()
+
+		res := collect(NewGroups(tags, key, nil, Count).Process(nil))
+		require.Equal(t, []string{"\t1", "9\t1", "10\t1", "a\t1", "b\t2"}, res)
+	})
+
+	t.Run("keys", func(t *testing.T) {
+		t.Parallel()
+
+		res := collect(NewGroups(tags, key, nil, "").Process(nil))
+		require.Equal(t, []string{"", "9", "10", "a", "b"}, res)
+	})
+
+	t.Run("sum", func(t *testing.T) {
+		t.Parallel()
+
+		res := collect(NewGroups(tags, key, value, Sum).Process(nil))
+		require.Equal(t, []string{"\t7", "9\t1", "10\t5", "a\t3", "b\t7"}, res)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		g := NewGroups(values{"a:1", "a:x"}, key, value, Sum)
+		rq.Empty(collect(g.Process(nil)))
+		rq.EqualError(g.Err(), "function `sum` can't be applied to `x`: value isn't a number")
+
+		g = NewGroups(broken{tags}, key, nil, Count)
+		rq.Empty(collect(g.Process(nil)))
+		rq.EqualError(g.Err(), "incorrect xml structure")
+	})
+
+	t.Run("source is read to the end on errors", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		wrong := func([]byte) ([]string, error) {
+			return nil, errors.New("wrong key")
+		}
+		source := tracked{values: tags, done: make(chan struct{})}
+		g := NewGroups(source, wrong, nil, Count)
+		rq.Empty(collect(g.Process(nil)))
+		rq.EqualError(g.Err(), "wrong key")
+		<-source.done
+	})
+}
@@ -0,0 +1,160 @@
+package aggregate
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+
+	"github.com/tty2/xq/internal/domain"
+)
+
+// Names of the functions reordering tags.
+const (
+	SortBy   = "sort_by"   // tags ordered by the key
+	Reverse  = "reverse"   // tags in reverse order
+	Unique   = "unique"    // tags without duplicates
+	UniqueBy = "unique_by" // the first tag of every key ordered by the key
+)
+
+type (
+	// Stage reorders the tags by the function. The key is set for the functions ordering tags by the key.
+	Stage struct {
+		Function string
+		Key      Evaluator
+	}
+
+	// Order reads all the tags found by the source and prints them reordered by the stages:
+	// `.objects.object | sort_by(.title#lang) | reverse`. Unlike the other processors it keeps all the tags
+	// in memory until the document ends.
+	Order struct {
+		source Source
+		stages []Stage
+		err    error
+	}
+)
+
+// NewOrder creates a new Order of the tags found by the source.
+func NewOrder(source Source, stages ...Stage) *Order {
+	return &Order{
+		source: source,
+		stages: stages,
+	}
+}
+
+// Process reads all the tags found by the source and prints them reordered.
+func (o *Order) Process(r *bufio.Reader) chan string {
+	ch := make(chan string)
+
+	go func() {
+		defer close(ch)
+
+		var tags []string
+		for tag := range o.source.Process(r) {
+			tags = append(tags, tag)
+		}
+		if o.source.Err() != nil { // tags of the part of the document aren't reordered
+			return
+		}
+
+		var err error
+		for i := range o.stages {
+			tags, err = o.stages[i].apply(tags)
+			if err != nil {
+				o.err = err
+
+				return
+			}
+		}
+
+		for _, tag := range tags {
+			ch <- tag
+		}
+	}()
+
+	return ch
+}
+
+// Err returns the error the source or the reordering stopped with.
+func (o *Order) Err() error {
+	if o.err != nil {
+		return o.err
+	}
+
+	return o.source.Err()
+}
+
+// apply returns the tags reordered by the function of the stage. Equal tags and tags with equal keys keep
+// their order.
+func (s Stage) apply(tags []string) ([]string, error) {
+	switch s.Function {
+	case Reverse:
+		res := make([]string, len(tags))
+		for i := range tags {
+			res[len(tags)-1-i] = tags[i]
+		}
+
+		return res, nil
+	case Unique:
+		return unique(tags, tags), nil
+	case SortBy, UniqueBy:
+		if s.Key == nil {
+			return nil, fmt.Errorf("function `%s` requires the key", s.Function)
+		}
+		keys, err := s.keys(tags)
+		if err != nil {
+			return nil, err
+		}
+
+		idx := make([]int, len(tags))
+		for i := range idx {
+			idx[i] = i
+		}
+		sort.SliceStable(idx, func(i, j int) bool {
+			return domain.CompareValues(keys[idx[i]], keys[idx[j]]) < 0
+		})
+
+		sortedTags := make([]string, len(tags))
+		sortedKeys := make([]string, len(tags))
+		for i, j := range idx {
+			sortedTags[i], sortedKeys[i] = tags[j], keys[j]
+		}
+		if s.Function == UniqueBy {
+			return unique(sortedTags, sortedKeys), nil
+		}
+
+		return sortedTags, nil
+	}
+
+	return nil, fmt.Errorf("unknown function `%s`", s.Function)
+}
+
+// keys returns the first value of the key of every tag. Tags without the key have empty key.
+func (s Stage) keys(tags []string) ([]string, error) {
+	keys := make([]string, len(tags))
+	for i := range tags {
+		values, err := s.Key([]byte(tags[i]))
+		if err != nil {
+			return nil, err
+		}
+		if len(values) > 0 {
+			keys[i] = values[0]
+		}
+	}
+
+	return keys, nil
+}
+
+// unique returns the tags without the ones which keys are the same as keys of the previous tags.
+func unique(tags, keys []string) []string {
+	res := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for i := range tags {
+		if seen[keys[i]] {
+			continue
+		}
+		seen[keys[i]] = true
+		res = append(res, tags[i])
+	}
+
+	return res
+}
@@ -0,0 +1,66 @@
+package aggregate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrder(t *testing.T) {
+	t.Parallel()
+
+	// tags are `key:value`
+	key := func(tag []byte) ([]string, error) {
+		if i := strings.IndexByte(string(tag), ':'); i > 0 {
+			return []string{string(tag[:i])}, nil
+		}
+
+		return nil, nil
+	}
+	tags := values{"b:1", "10:2", "a:3", "b:4", "9:5", ":6", "a:3"}
+
+	t.Run("sort by", func(t *testing.T) {
+		t.Parallel()
+
+		res := collect(NewOrder(tags, Stage{Function: SortBy, Key: key}).Process(nil))
+		require.Equal(t, []string{":6", "9:5", "10:2", "a:3", "a:3", "b:1", "b:4"}, res)
+	})
+
+	t.Run("reverse", func(t *testing.T) {
+		t.Parallel()
+
+		res := collect(NewOrder(tags, Stage{Function: Reverse}).Process(nil))
+		require.Equal(t, []string{"a:3", ":6", "9:5", "b:4", "a:3", "10:2", "b:1"}, res)
+	})
+
+	t.Run("unique", func(t *testing.T) {
+		t.Parallel()
+
+		res := collect(NewOrder(tags, Stage{Function: Unique}).Process(nil))
+		require.Equal(t, []string{"b:1", "10:2", "a:3", "b:4", "9:5", ":6"}, res)
+	})
+
+	t.Run("unique by", func(t *testing.T) {
+		t.Parallel()
+
+		res := collect(NewOrder(tags, Stage{Function: UniqueBy, Key: key}, Stage{Function: Reverse}).Process(nil))
+		require.Equal(t, []string{"b:1", "a:3", "10:2", "9:5", ":6"}, res)
+	})
+
+	t.Run("without key", func(t *testing.T) {
+		t.Parallel()
+
+		o := NewOrder(tags, Stage{Function: SortBy})
+		require.Empty(t, collect(o.Process(nil)))
+		require.EqualError(t, o.Err(), "function `sort_by` requires the key")
+	})
+
+	t.Run("source error", func(t *testing.T) {
+		t.Parallel()
+
+		o := NewOrder(broken{tags}, Stage{Function: Reverse})
+		require.Empty(t, collect(o.Process(nil)))
+		require.EqualError(t, o.Err(), "incorrect xml structure")
+	})
+}
@@ -0,0 +1,19 @@
+package domain
+
+// Attribute is the attribute selected from the tags matched by the query: `#name`, all the attributes `#*`
+// or the ones which names match the regular expression `#/^data-/`.
+type Attribute struct {
+	Name      string // name of the attribute or `Wildcard` for all the attributes
+	Pattern   string // regular expression the names of the attributes are matched by
+	Namespace string // URI of the namespace the attribute belongs to, its name is local then
+}
+
+// IsSet checks if any attribute is selected.
+func (a Attribute) IsSet() bool {
+	return a.Name != "" || a.Pattern != ""
+}
+
+// IsMultiple checks if several attributes of the tag can be selected.
+func (a Attribute) IsMultiple() bool {
+	return a.Name == Wildcard || a.Pattern != ""
+}
@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Axis is a direction the step selects tags in relatively to the tags matched by the previous steps.
+type Axis int
+
+const (
+	// AxisChild selects child tags: `.parent.child`.
+	AxisChild Axis = iota
+	// AxisParent selects parents of the matched tags: `.objects.object.key^`.
+	AxisParent
+	// AxisAncestor selects ancestors of the matched tags: `..key.ancestor::object`.
+	AxisAncestor
+	// AxisFollowingSibling selects tags located after the matched ones inside the same parent:
+	// `..marker.following-sibling::item`.
+	AxisFollowingSibling
+)
+
+func (a Axis) String() string {
+	switch a {
+	case AxisChild:
+		return "child"
+	case AxisParent:
+		return "parent"
+	case AxisAncestor:
+		return "ancestor"
+	case AxisFollowingSibling:
+		return "following-sibling"
+	}
+
+	return ""
+}
+
+// CheckAxis checks that the path contains the only axis step and the steps before it and the axis step itself
+// can be matched as soon as the tag is opened: they can have attribute filters only.
+func CheckAxis(path []Step) error {
+	axis := -1
+	for i := range path {
+		if path[i].Axis == AxisChild {
+			continue
+		}
+		if axis > -1 {
+			return errors.New("path can contain the only axis step")
+		}
+		axis = i
+	}
+	if axis == -1 {
+		return nil
+	}
+
+	for i := range path {
+		if path[i].Index > -1 {
+			return errors.New("index can't be used together with axis")
+		}
+	}
+
+	if !path[axis].matchedOnOpen() {
+		return fmt.Errorf("axis step `%s` can have attribute filters only", path[axis].Name)
+	}
+	for i := 0; i < axis; i++ {
+		if !path[i].matchedOnOpen() {
+			return fmt.Errorf("steps before axis can have attribute filters only, but `%s` has other ones",
+				path[i].Name)
+		}
+	}
+
+	return nil
+}
+
+// matchedOnOpen checks if the step doesn't wait for children or positions of the tags to match them.
+func (s Step) matchedOnOpen() bool {
+	if s.Condition != nil || s.Slice != nil || s.Index > -1 {
+		return false
+	}
+	for i := range s.Filters {
+		if s.Filters[i].IsChild() {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,47 @@
+package domain
+
+// ConditionOperator represents the way operands of condition are combined.
+type ConditionOperator int
+
+const (
+	// ConditionFilter is satisfied if the filter is satisfied: `.Quantity > 1`.
+	ConditionFilter ConditionOperator = iota
+	// ConditionAnd is satisfied if all the operands are satisfied: `.Quantity > 1 and @sku`.
+	ConditionAnd
+	// ConditionOr is satisfied if any of the operands is satisfied: `.Quantity > 1 or @sku`.
+	ConditionOr
+	// ConditionNot is satisfied if the only operand isn't satisfied: `not(@sku)`.
+	ConditionNot
+)
+
+// Condition is a boolean expression of filters the tag must satisfy. It's set by `select`.
+//
+// Example:
+//
+//	.Items.Item | select(.Quantity > 1 and not(@sku))
+//
+// Condition = {Operator: `ConditionAnd`, Operands: [
+//
+//	{Operator: `ConditionFilter`, Filter: {Child: [`Quantity`], Operator: `FilterGreater`, Value: `1`}},
+//	{Operator: `ConditionNot`, Operands: [{Operator: `ConditionFilter`, Filter: {Attribute: `sku`}}]},
+//
+// ]}
+type Condition struct {
+	Operator ConditionOperator
+	Filter   Filter      // filter of `ConditionFilter`
+	Operands []Condition // operands of `ConditionAnd`, `ConditionOr` and the only operand of `ConditionNot`
+}
+
+// Filters returns all the filters of the condition.
+func (c Condition) Filters() []Filter {
+	if c.Operator == ConditionFilter {
+		return []Filter{c.Filter}
+	}
+
+	var filters []Filter
+	for i := range c.Operands {
+		filters = append(filters, c.Operands[i].Filters()...)
+	}
+
+	return filters
+}
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionFilters(t *testing.T) {
+	t.Parallel()
+
+	t.Run("filter", func(t *testing.T) {
+		t.Parallel()
+
+		f := Filter{Attribute: "id", Operator: FilterExists}
+		c := Condition{Operator: ConditionFilter, Filter: f}
+
+		require.Equal(t, []Filter{f}, c.Filters())
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		t.Parallel()
+
+		a := Filter{Attribute: "id", Operator: FilterExists}
+		b := Filter{Child: []string{"price"}, Operator: FilterLess, Value: "10"}
+		c := Condition{Operator: ConditionOr, Operands: []Condition{
+			{Operator: ConditionFilter, Filter: a},
+			{Operator: ConditionNot, Operands: []Condition{{Operator: ConditionFilter, Filter: b}}},
+		}}
+
+		require.Equal(t, []Filter{a, b}, c.Filters())
+	})
+}
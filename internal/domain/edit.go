@@ -0,0 +1,48 @@
+package domain
+
+// EditOperator represents the way the tags or attributes matched by the query are modified.
+type EditOperator int
+
+const (
+	// EditAssign sets text of the tags or value of the attribute: `.objects.object[0].title = "New"`.
+	EditAssign EditOperator = iota
+	// EditUpdate replaces text of the tags or value of the attribute by the result of string functions applied to it:
+	// `.objects.object.poster#url |= sub("http:"; "https:")`.
+	EditUpdate
+	// EditDelete deletes the tags with their nested tags or the attribute: `del(.objects.object.poster#url)`.
+	EditDelete
+	// EditAppend inserts the markup into the tags after their nested tags: `.project.dependencies += <dependency/>`.
+	EditAppend
+	// EditBefore inserts the markup before the tags: `before(.project.modules.module[0]; <module>core</module>)`.
+	EditBefore
+	// EditAfter inserts the markup after the tags: `after(.project.modules.module[-1]; <module>cli</module>)`.
+	EditAfter
+	// EditWrap wraps the tags into the empty tag of the markup: `wrap(.project.build.plugins; <pluginManagement/>)`.
+	EditWrap
+	// EditUnwrap replaces the tags by their content: `unwrap(.project.build.pluginManagement)`.
+	EditUnwrap
+)
+
+// String returns the sign or the keyword of operator used in queries.
+func (o EditOperator) String() string {
+	switch o {
+	case EditAssign:
+		return "="
+	case EditUpdate:
+		return "|="
+	case EditDelete:
+		return "del"
+	case EditAppend:
+		return "+="
+	case EditBefore:
+		return "before"
+	case EditAfter:
+		return "after"
+	case EditWrap:
+		return "wrap"
+	case EditUnwrap:
+		return "unwrap"
+	}
+
+	return ""
+}
@@ -0,0 +1,82 @@
+package domain
+
+// FilterOperator represents the way a value is checked by filter.
+type FilterOperator int
+
+const (
+	// FilterExists checks if tag has the attribute or the child: `[@attr]`, `[child]`.
+	FilterExists FilterOperator = iota
+	// FilterEqual checks if value is equal to filter value: `[@attr='value']`.
+	FilterEqual
+	// FilterNotEqual checks if value is not equal to filter value: `[@attr!='value']`.
+	FilterNotEqual
+	// FilterMatch checks if value matches regular expression: `[@attr=~'^val']`.
+	FilterMatch
+	// FilterLess checks if value is less than filter value: `[price<10]`.
+	FilterLess
+	// FilterLessOrEqual checks if value is less than or equal to filter value: `[price<=10]`.
+	FilterLessOrEqual
+	// FilterGreater checks if value is greater than filter value: `[price>10]`.
+	FilterGreater
+	// FilterGreaterOrEqual checks if value is greater than or equal to filter value: `[price>=10]`.
+	FilterGreaterOrEqual
+)
+
+// Filter keeps a condition set in brackets after tag name.
+// The condition is checked either for an attribute of the tag or for text of its child tag.
+// Child can be located deeper than the next level: `[info.year>1990]`. The condition is checked for an attribute
+// of the child if both are set: `[info#year>1990]`. `Self` filter set by `select(. > 15)` checks text of the tag
+// itself.
+// If the tag has several such children, it's enough one of them satisfies the condition.
+// Values are compared as numbers if both of them are numbers and as strings otherwise.
+// String functions set after the attribute or the child are applied to the value before it's compared, filter without
+// operator is satisfied then if any of the results isn't `false`: `[@id | test('^a')]`.
+//
+// Example:
+//
+//	.objects.object[@lang='EN']
+//
+// Filter = {Attribute: `lang`, Operator: `FilterEqual`, Value: `EN`}
+//
+//	.objects.object[title='Name']
+//
+// Filter = {Child: [`title`], Operator: `FilterEqual`, Value: `Name`}
+type Filter struct {
+	Attribute string
+	Namespace string // URI of the namespace the attribute belongs to, its name is local then
+	Child     []string
+	Self      bool
+	Operator  FilterOperator
+	Value     string
+	Functions []Function
+}
+
+// IsChild checks if filter condition is checked for a child tag or for text of the tag, so it's known only when
+// the children are read.
+func (f Filter) IsChild() bool {
+	return len(f.Child) > 0 || f.Self
+}
+
+// String returns the sign of operator used in queries.
+func (o FilterOperator) String() string {
+	switch o {
+	case FilterExists:
+		return ""
+	case FilterEqual:
+		return "="
+	case FilterNotEqual:
+		return "!="
+	case FilterMatch:
+		return "=~"
+	case FilterLess:
+		return "<"
+	case FilterLessOrEqual:
+		return "<="
+	case FilterGreater:
+		return ">"
+	case FilterGreaterOrEqual:
+		return ">="
+	}
+
+	return ""
+}
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Function is a string function applied to the values selected by the query or to the values checked by filter.
+//
+// Example:
+//
+//	.objects.object.title#lang | ascii_downcase
+//
+// Function = {Name: `ascii_downcase`}
+//
+//	.Items.Item[ProductName | split(' ') | join('-') = 'Baby-Monitor']
+//
+// Functions = [{Name: `split`, Args: [` `]}, {Name: `join`, Args: [`-`]}]
+type Function struct {
+	Name string
+	Args []string
+}
+
+// String returns the function call as it's written in queries: `sub("a"; "b")`.
+func (f Function) String() string {
+	if len(f.Args) == 0 {
+		return f.Name
+	}
+
+	args := make([]string, len(f.Args))
+	for i := range f.Args {
+		args[i] = strconv.Quote(f.Args[i])
+	}
+
+	return f.Name + "(" + strings.Join(args, "; ") + ")"
+}
@@ -64,4 +64,88 @@ const (
 	// result:
 	//		value2
 	AttrValue
+	// TagCount represents search the number of tags.
+	//
+	// Example:
+	// 	<tagname attr1="value1" attr2="value2">
+	// 		<inside attr="value">42</inside>
+	//		<inside2 attr="value">some data</inside2>
+	// 	</tagname>
+	//
+	// SearchType = `TagCount` target tag = `tagname.*`
+	//
+	// result:
+	//		2
+	TagCount
+	// TagName represents search names of tags.
+	//
+	// Example:
+	// 	<tagname attr1="value1" attr2="value2">
+	// 		<inside attr="value">42</inside>
+	//		<inside2 attr="value">some data</inside2>
+	// 	</tagname>
+	//
+	// SearchType = `TagName` target tag = `tagname.*`
+	//
+	// result:
+	//		inside
+	//		inside2
+	TagName
+	// TagText represents search text of tags without nested tags markup.
+	//
+	// Example:
+	// 	<tagname attr1="value1" attr2="value2">
+	// 		<inside attr="value">42</inside>
+	//		<inside2 attr="value">some data</inside2>
+	// 	</tagname>
+	//
+	// SearchType = `TagText` target tag = `tagname`
+	//
+	// result:
+	//		42 some data
+	TagText
+	// TagRaw represents search markup of tags with their nested tags as it is in the data. It's used to evaluate
+	// queries relative to every matched tag: `group_by(.objects.object; .title#lang)`.
+	//
+	// Example:
+	// 	<tagname attr1="value1" attr2="value2">
+	// 		<inside attr="value">42</inside>
+	// 	</tagname>
+	//
+	// SearchType = `TagRaw` target tag = `tagname.inside`
+	//
+	// result:
+	//		<inside attr="value">42</inside>
+	TagRaw
+	// TagPath represents search paths of tags in the query syntax. Every tag gets its position among the tags
+	// with the same name inside the parent.
+	//
+	// Example:
+	// 	<tagname attr1="value1" attr2="value2">
+	// 		<inside attr="value">42</inside>
+	//		<inside attr="value">some data</inside>
+	// 	</tagname>
+	//
+	// SearchType = `TagPath` target tag = `tagname`
+	//
+	// result:
+	//		.tagname[0]
+	//		.tagname[0].inside[0]
+	//		.tagname[0].inside[1]
+	TagPath
+	// TagEdit represents modification of text of tags or their attribute. The result is the whole document where
+	// only the matched tags or attributes are changed.
+	//
+	// Example:
+	// 	<tagname attr1="value1" attr2="value2">
+	// 		<inside attr="value">42</inside>
+	// 	</tagname>
+	//
+	// SearchType = `TagEdit` target tag = `tagname.inside` value = `43`
+	//
+	// result:
+	// 	<tagname attr1="value1" attr2="value2">
+	// 		<inside attr="value">43</inside>
+	// 	</tagname>
+	TagEdit
 )
@@ -0,0 +1,67 @@
+package domain
+
+// Slice keeps positions of tags selected by caller: `[start:end:step]`.
+// Positions are counted from zero among the tags matched by the step inside the same parent tag.
+// Negative `Start` and `End` are counted from the end: `[-1]` is the last tag, `[-3:]` are the last three.
+// `End` isn't included into the slice and is ignored if `HasEnd` isn't set.
+//
+// Example:
+//
+//	[2:5]  = {Start: 2, End: 5, HasEnd: true, Step: 1}
+//	[::2]  = {Start: 0, Step: 2}
+//	[-1]   = {Start: -1, Step: 1}
+//	[-2]   = {Start: -2, End: -1, HasEnd: true, Step: 1}
+type Slice struct {
+	Start  int
+	End    int
+	HasEnd bool
+	Step   int
+}
+
+// FromEnd checks if total number of tags is needed to know if a position is inside the slice.
+func (s Slice) FromEnd() bool {
+	return s.Start < 0 || (s.HasEnd && s.End < 0)
+}
+
+// Last returns the number of the last tags which can be inside the slice counted from the end: the tags before them
+// are outside it whatever the total number of tags is. It's 0 if any tag can be inside the slice.
+func (s Slice) Last() int {
+	if s.Start < 0 {
+		return -s.Start
+	}
+
+	return 0
+}
+
+// Contains checks if `position` is inside the slice when there are `total` tags.
+// `total` is used only for the slices counted from the end.
+func (s Slice) Contains(position, total int) bool {
+	start := s.Start
+	if start < 0 {
+		start += total
+		if start < 0 {
+			start = 0
+		}
+	}
+
+	if position < start {
+		return false
+	}
+
+	if s.HasEnd {
+		end := s.End
+		if end < 0 {
+			end += total
+		}
+		if position >= end {
+			return false
+		}
+	}
+
+	step := s.Step
+	if step < 1 {
+		step = 1
+	}
+
+	return (position-start)%step == 0
+}
@@ -0,0 +1,97 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSliceFromEnd(t *testing.T) {
+	t.Parallel()
+
+	t.Run("false", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.False(Slice{Start: 2, End: 5, HasEnd: true, Step: 1}.FromEnd())
+		rq.False(Slice{Start: 0, End: -1, Step: 2}.FromEnd())
+	})
+
+	t.Run("true", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.True(Slice{Start: -1, Step: 1}.FromEnd())
+		rq.True(Slice{Start: 1, End: -1, HasEnd: true, Step: 1}.FromEnd())
+	})
+}
+
+func TestSliceLast(t *testing.T) {
+	t.Parallel()
+	rq := require.New(t)
+
+	rq.Equal(1, Slice{Start: -1, Step: 1}.Last())
+	rq.Equal(3, Slice{Start: -3, End: -1, HasEnd: true, Step: 2}.Last())
+	rq.Zero(Slice{Start: 1, End: -1, HasEnd: true, Step: 1}.Last())
+	rq.Zero(Slice{Start: 2, Step: 1}.Last())
+}
+
+func TestSliceContains(t *testing.T) {
+	t.Parallel()
+
+	t.Run("range", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		sl := Slice{Start: 2, End: 5, HasEnd: true, Step: 1}
+
+		rq.False(sl.Contains(1, 0))
+		rq.True(sl.Contains(2, 0))
+		rq.True(sl.Contains(4, 0))
+		rq.False(sl.Contains(5, 0))
+	})
+
+	t.Run("step", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		sl := Slice{Start: 1, Step: 2}
+
+		rq.False(sl.Contains(0, 0))
+		rq.True(sl.Contains(1, 0))
+		rq.False(sl.Contains(2, 0))
+		rq.True(sl.Contains(101, 0))
+	})
+
+	t.Run("last", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		sl := Slice{Start: -1, Step: 1}
+
+		rq.False(sl.Contains(3, 5))
+		rq.True(sl.Contains(4, 5))
+	})
+
+	t.Run("from end", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		sl := Slice{Start: -3, End: -1, HasEnd: true, Step: 1}
+
+		rq.False(sl.Contains(1, 5))
+		rq.True(sl.Contains(2, 5))
+		rq.True(sl.Contains(3, 5))
+		rq.False(sl.Contains(4, 5))
+	})
+
+	t.Run("start is out of range", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		sl := Slice{Start: -10, Step: 1}
+
+		rq.True(sl.Contains(0, 2))
+		rq.True(sl.Contains(1, 2))
+	})
+}
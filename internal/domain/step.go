@@ -3,23 +3,167 @@ Package domain keeps all the shared structures.
 */
 package domain
 
+import "strings"
+
 // Step keeps name of tag and index set by caller.
+// If `Descendant` is set the tag can be located at any depth below the previous step (`..name`).
+// `Filters` keeps conditions set in brackets after the name the tag must satisfy (`name[@attr='value']`).
+// `Slice` keeps positions of the tags selected by the step if it's set (`name[-1]`, `name[2:5]`).
+// If `Namespace` is set `Name` is a local name of the tag and the tag must belong to namespace with the URI
+// (`{uri}name`). The namespace of the tag isn't checked by the step itself, it's the filter the caller checks.
+// `Axis` is set if the step selects tags relatively to the tags matched by the previous steps in other direction
+// than down to the children (`^`, `ancestor::name`).
+// `Condition` keeps boolean expression of filters set by `select` the tag must satisfy as well as `Filters`.
 type Step struct {
-	Name  string
-	Index int
+	Name       string
+	Index      int
+	Descendant bool
+	Filters    []Filter
+	Slice      *Slice
+	Namespace  string
+	Axis       Axis
+	Condition  *Condition
+}
+
+// Wildcard is a step name that matches any tag name.
+const Wildcard = "*"
+
+// MatchName checks if tag with `name` can be matched by the step.
+// Only local part of the name is compared if the step has namespace.
+func (s Step) MatchName(name string) bool {
+	if s.Namespace != "" {
+		name = LocalName(name)
+	}
+
+	return s.Name == Wildcard || s.Name == name
+}
+
+// LocalName returns name without namespace prefix: `soap:Body` -> `Body`.
+func LocalName(name string) string {
+	if i := strings.IndexByte(name, ':'); i > -1 {
+		return name[i+1:]
+	}
+
+	return name
+}
+
+// Prefix returns namespace prefix of the name: `soap:Body` -> `soap`.
+func Prefix(name string) string {
+	if i := strings.IndexByte(name, ':'); i > -1 {
+		return name[:i]
+	}
+
+	return ""
 }
 
 // PathsMatch checks if slices `p` and `ph` are similar.
-func PathsMatch(p []Step, ph []string) bool {
-	if len(p) != len(ph) {
-		return false
+// `passes` keeps flags of steps filters satisfied by every tag of `ph`: `passes[i][j]` is true if
+// tag `ph[i]` satisfies filters of step `p[j]`. Tag without flags satisfies filters of all steps.
+func PathsMatch(p []Step, ph []string, passes ...[]bool) bool {
+	states := walk(p, ph, passes)
+
+	return states[len(p)]
+}
+
+// MatchedSteps returns flags of steps from `p` the last tag in `ph` matches.
+// Index of a step is set to true if the last tag matches it and all the previous tags match
+// the previous steps.
+func MatchedSteps(p []Step, ph []string, passes ...[]bool) []bool {
+	matched := make([]bool, len(p))
+	if len(ph) == 0 {
+		return matched
 	}
 
+	last := len(ph) - 1
+	states := walk(p, ph[:last], passes)
 	for i := range p {
-		if p[i].Name != ph[i] {
-			return false
+		matched[i] = states[i] && p[i].MatchName(ph[last]) && passed(passes, last, i)
+	}
+
+	return matched
+}
+
+// MatchDepth returns the length of the shortest beginning of `ph` that matches `p`.
+// Returns -1 if there is no such part of the path.
+func MatchDepth(p []Step, ph []string, passes ...[]bool) int {
+	states := InitialStates(p)
+	if states[len(p)] {
+		return 0
+	}
+
+	next := make([]bool, len(p)+1)
+	for i := range ph {
+		states, next = nextStates(p, states, ph[i], passes, i, next), states
+		if states[len(p)] {
+			return i + 1
 		}
 	}
 
-	return true
+	return -1
+}
+
+// walk returns states after all the tags of `ph` are passed through the steps `p`.
+// State with index `i` is true if `ph` matches the first `i` steps.
+func walk(p []Step, ph []string, passes [][]bool) []bool {
+	states, next := InitialStates(p), make([]bool, len(p)+1)
+	for i := range ph {
+		states, next = nextStates(p, states, ph[i], passes, i, next), states
+	}
+
+	return states
+}
+
+// InitialStates returns states of the steps `p` before any tag is passed through them. State with index `i` is true
+// if the passed tags match the first `i` steps, so the path is matched if the last state is true.
+func InitialStates(p []Step) []bool {
+	states := make([]bool, len(p)+1)
+	states[0] = true
+
+	return states
+}
+
+// NextStates returns states of the steps `p` after the tag with `name` is passed through them, `states` are
+// the states before the tag. `passed` keeps flags of the steps filters satisfied by the tag, tag without flags
+// satisfies filters of all steps. The states are written to `next` if it's large enough, so it can be reused, but
+// it can't share memory with `states`.
+func NextStates(p []Step, states []bool, name string, passed, next []bool) []bool {
+	if cap(next) < len(p)+1 {
+		next = make([]bool, len(p)+1)
+	}
+	next = next[:len(p)+1]
+	for i := range next {
+		next[i] = false
+	}
+
+	for i := range p {
+		if !states[i] {
+			continue
+		}
+		if p[i].Descendant { // tag can be skipped until the step is found
+			next[i] = true
+		}
+		if p[i].MatchName(name) && (len(passed) <= i || passed[i]) {
+			next[i+1] = true
+		}
+	}
+
+	return next
+}
+
+// nextStates returns states after the tag on `depth` of the path with flags `passes` as `NextStates` does.
+func nextStates(p []Step, states []bool, name string, passes [][]bool, depth int, next []bool) []bool {
+	var row []bool
+	if depth < len(passes) {
+		row = passes[depth]
+	}
+
+	return NextStates(p, states, name, row, next)
+}
+
+func passed(passes [][]bool, depth, step int) bool {
+	if depth >= len(passes) || len(passes[depth]) <= step {
+		return true
+	}
+
+	return passes[depth][step]
 }
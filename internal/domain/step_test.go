@@ -69,3 +69,266 @@ func TestPathsMatch(t *testing.T) {
 		rq.True(res)
 	})
 }
+
+func TestPathsMatchDescendant(t *testing.T) {
+	t.Parallel()
+
+	st := []Step{
+		{Name: "test1", Index: -1},
+		{Name: "test3", Index: -1, Descendant: true},
+	}
+
+	t.Run("direct child", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.True(PathsMatch(st, []string{"test1", "test3"}))
+	})
+
+	t.Run("deep child", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.True(PathsMatch(st, []string{"test1", "test2", "test2", "test3"}))
+	})
+
+	t.Run("different root", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.False(PathsMatch(st, []string{"test2", "test3"}))
+	})
+
+	t.Run("tag inside target", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.False(PathsMatch(st, []string{"test1", "test3", "test4"}))
+	})
+
+	t.Run("leading descendant", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := PathsMatch([]Step{{Name: "test3", Index: -1, Descendant: true}}, []string{"test1", "test2", "test3"})
+
+		rq.True(res)
+	})
+}
+
+func TestMatchedSteps(t *testing.T) {
+	t.Parallel()
+
+	t.Run("empty path", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := MatchedSteps([]Step{{Name: "test1", Index: -1}}, []string{})
+
+		rq.Equal([]bool{false}, res)
+	})
+
+	t.Run("intermediate step", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		st := []Step{
+			{Name: "test1", Index: -1},
+			{Name: "test2", Index: -1},
+			{Name: "test3", Index: -1},
+		}
+
+		res := MatchedSteps(st, []string{"test1", "test2"})
+
+		rq.Equal([]bool{false, true, false}, res)
+	})
+
+	t.Run("same name on several steps", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		st := []Step{
+			{Name: "test1", Index: -1, Descendant: true},
+			{Name: "test1", Index: -1, Descendant: true},
+		}
+
+		res := MatchedSteps(st, []string{"test1", "test2", "test1"})
+
+		rq.Equal([]bool{true, true}, res)
+	})
+}
+
+func TestMatchDepth(t *testing.T) {
+	t.Parallel()
+
+	t.Run("empty query", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.Equal(0, MatchDepth([]Step{}, []string{"test1"}))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.Equal(-1, MatchDepth([]Step{{Name: "test3", Index: -1}}, []string{"test1", "test3"}))
+	})
+
+	t.Run("the shortest match", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		st := []Step{
+			{Name: "test1", Index: -1, Descendant: true},
+		}
+
+		rq.Equal(2, MatchDepth(st, []string{"test2", "test1", "test1", "test3"}))
+	})
+}
+
+func TestNextStates(t *testing.T) {
+	t.Parallel()
+	rq := require.New(t)
+
+	st := []Step{{Name: "a", Index: -1}, {Name: "b", Index: -1, Descendant: true}}
+
+	states := InitialStates(st)
+	rq.Equal([]bool{true, false, false}, states)
+
+	states = NextStates(st, states, "a", nil, nil)
+	rq.Equal([]bool{false, true, false}, states)
+
+	next := make([]bool, 0, 3)
+	res := NextStates(st, states, "c", nil, next)
+	rq.Equal([]bool{false, true, false}, res)
+	rq.Equal(&next[:1][0], &res[0]) // the slice is reused
+
+	rq.Equal([]bool{false, true, true}, NextStates(st, res, "b", []bool{true, true}, states))
+	rq.Equal([]bool{false, true, false}, NextStates(st, states, "b", []bool{true, false}, nil))
+}
+
+func TestPathsMatchWildcard(t *testing.T) {
+	t.Parallel()
+
+	t.Run("any name", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		st := []Step{
+			{Name: "test1", Index: -1},
+			{Name: Wildcard, Index: -1},
+			{Name: "test3", Index: -1},
+		}
+
+		rq.True(PathsMatch(st, []string{"test1", "test2", "test3"}))
+		rq.True(PathsMatch(st, []string{"test1", "test4", "test3"}))
+		rq.False(PathsMatch(st, []string{"test1", "test3"}))
+	})
+
+	t.Run("with descendant", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		st := []Step{
+			{Name: "test1", Index: -1},
+			{Name: Wildcard, Index: -1, Descendant: true},
+		}
+
+		rq.True(PathsMatch(st, []string{"test1", "test2", "test3"}))
+		rq.False(PathsMatch(st, []string{"test1"}))
+	})
+}
+
+func TestMatchName(t *testing.T) {
+	t.Parallel()
+
+	t.Run("literal", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		st := Step{Name: "test1", Index: -1}
+
+		rq.True(st.MatchName("test1"))
+		rq.False(st.MatchName("test2"))
+	})
+
+	t.Run("wildcard", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		st := Step{Name: Wildcard, Index: -1}
+
+		rq.True(st.MatchName("test1"))
+		rq.True(st.MatchName("test2"))
+	})
+
+	t.Run("namespace", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		st := Step{Name: "Body", Index: -1, Namespace: "urn:soap"}
+
+		rq.True(st.MatchName("Body"))
+		rq.True(st.MatchName("soap:Body"))
+		rq.True(st.MatchName("env:Body"))
+		rq.False(st.MatchName("env:Header"))
+	})
+
+	t.Run("prefix without namespace", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		st := Step{Name: "soap:Body", Index: -1}
+
+		rq.True(st.MatchName("soap:Body"))
+		rq.False(st.MatchName("env:Body"))
+		rq.False(st.MatchName("Body"))
+	})
+}
+
+func TestQualifiedNameParts(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.Equal("Body", LocalName("soap:Body"))
+		rq.Equal("soap", Prefix("soap:Body"))
+		rq.Equal("Body", LocalName("Body"))
+		rq.Equal("", Prefix("Body"))
+	})
+}
+
+func TestPathsMatchFilters(t *testing.T) {
+	t.Parallel()
+
+	st := []Step{
+		{Name: "test1", Index: -1},
+		{Name: "test2", Index: -1, Filters: []Filter{{Attribute: "attr", Operator: FilterExists}}},
+	}
+
+	t.Run("passed", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.True(PathsMatch(st, []string{"test1", "test2"}, nil, []bool{true, true}))
+	})
+
+	t.Run("not passed", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.False(PathsMatch(st, []string{"test1", "test2"}, nil, []bool{true, false}))
+		rq.Equal([]bool{false, false}, MatchedSteps(st, []string{"test1", "test2"}, nil, []bool{true, false}))
+		rq.Equal(-1, MatchDepth(st, []string{"test1", "test2", "test3"}, nil, []bool{true, false}))
+	})
+
+	t.Run("without flags", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.True(PathsMatch(st, []string{"test1", "test2"}))
+	})
+}
@@ -0,0 +1,89 @@
+package domain
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// CompareValues compares values as numbers if both of them are numbers and as strings otherwise.
+func CompareValues(a, b string) int {
+	an, errA := strconv.ParseFloat(a, 64)
+	bn, errB := strconv.ParseFloat(b, 64)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+
+	switch {
+	case an < bn:
+		return -1
+	case an > bn:
+		return 1
+	}
+
+	return 0
+}
+
+// DecodeEntities replaces the predefined entities and character references with the symbols they stand for:
+// `&lt;` is `<`, `&#169;` and `&#xA9;` are `©`. Other entities are kept as they are.
+func DecodeEntities(s string) string {
+	if !strings.Contains(s, "&") {
+		return s
+	}
+
+	var sb strings.Builder
+	for {
+		start := strings.IndexByte(s, '&')
+		if start == -1 {
+			break
+		}
+		end := strings.IndexByte(s[start:], ';')
+		if end == -1 {
+			break
+		}
+		end += start
+
+		sb.WriteString(s[:start])
+		r, ok := entity(s[start+1 : end])
+		if !ok { // `&` can be followed by the next entity: `& &lt;`
+			sb.WriteByte('&')
+			s = s[start+1:]
+
+			continue
+		}
+		sb.WriteRune(r)
+		s = s[end+1:]
+	}
+	sb.WriteString(s)
+
+	return sb.String()
+}
+
+// entity returns the symbol of the entity name or character reference without `&` and `;`.
+func entity(name string) (rune, bool) {
+	switch name {
+	case "lt":
+		return '<', true
+	case "gt":
+		return '>', true
+	case "amp":
+		return '&', true
+	case "apos":
+		return '\'', true
+	case "quot":
+		return '"', true
+	}
+
+	if !strings.HasPrefix(name, "#") {
+		return 0, false
+	}
+	code, err := strconv.ParseUint(name[1:], 10, 32)
+	if strings.HasPrefix(name, "#x") {
+		code, err = strconv.ParseUint(name[2:], 16, 32)
+	}
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return 0, false
+	}
+
+	return rune(code), true
+}
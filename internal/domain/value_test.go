@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareValues(t *testing.T) {
+	t.Parallel()
+
+	t.Run("numbers", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.Equal(1, CompareValues("10", "9"))
+		rq.Equal(-1, CompareValues("1.5", "10"))
+		rq.Equal(0, CompareValues("10.0", "10"))
+	})
+
+	t.Run("strings", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.Equal(-1, CompareValues("10", "9a"))
+		rq.Equal(1, CompareValues("b", "a"))
+		rq.Equal(0, CompareValues("a", "a"))
+	})
+}
+
+func TestDecodeEntities(t *testing.T) {
+	t.Parallel()
+	rq := require.New(t)
+
+	rq.Equal(`a < b > c & 'd' "e"`, DecodeEntities("a &lt; b &gt; c &amp; &apos;d&apos; &quot;e&quot;"))
+	rq.Equal("© © ©", DecodeEntities("&#169; &#xA9; &#xa9;"))
+	rq.Equal("&nbsp; & <", DecodeEntities("&nbsp; & &lt;"))
+	rq.Equal("&#xD800; &#abc; &lt", DecodeEntities("&#xD800; &#abc; &lt"))
+	rq.Equal("&lt;", DecodeEntities("&amp;lt;"))
+}
@@ -31,6 +31,7 @@ type (
 		InsideTag      bool // semaphore that shows if we read data inside a tag
 		SkipData       bool
 		printList      []string
+		err            error // error the processing stopped with
 	}
 
 	tag struct {
@@ -61,7 +62,7 @@ func (p *Processor) Process(r *bufio.Reader) chan string {
 				if err == io.EOF {
 					return
 				}
-				ch <- err.Error()
+				p.err = err
 
 				return
 			}
@@ -70,7 +71,7 @@ func (p *Processor) Process(r *bufio.Reader) chan string {
 
 			err = p.process(buf)
 			if err != nil {
-				ch <- err.Error()
+				p.err = err
 
 				return
 			}
@@ -86,6 +87,11 @@ func (p *Processor) Process(r *bufio.Reader) chan string {
 	return ch
 }
 
+// Err returns the error the processing stopped with. It's known when the channel returned by `Process` is closed.
+func (p *Processor) Err() error {
+	return p.err
+}
+
 func (p *Processor) process(chunk []byte) error {
 	for i := range chunk {
 		switch {
@@ -3,10 +3,42 @@ package processor
 import (
 	"errors"
 	"fmt"
+	"regexp"
+	"strings"
 
+	"github.com/tty2/xq/internal/domain"
 	"github.com/tty2/xq/internal/domain/symbol"
 )
 
+// compileAttributes returns the pattern names of the selected attributes are matched by.
+// Wildcard has empty pattern which matches all the names.
+func compileAttributes(attribute domain.Attribute) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(attribute.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression of attribute: %w", err)
+	}
+
+	return re, nil
+}
+
+// pickAttributes returns `name=value` pairs of the tag attributes which names match `re`.
+func pickAttributes(re *regexp.Regexp, tag []byte) []string {
+	var pairs []string
+	for _, name := range pickAttributesNames(tag) {
+		name = strings.TrimSpace(name)
+		if !re.MatchString(name) {
+			continue
+		}
+		value, err := pickAttributeValue(name, tag)
+		if err != nil {
+			continue
+		}
+		pairs = append(pairs, name+"="+value)
+	}
+
+	return pairs
+}
+
 func pickAttributesNames(tag []byte) []string {
 	if len(tag) < 3 || tag[0] != symbol.OpenBracket || tag[len(tag)-1] != symbol.CloseBracket {
 		return nil
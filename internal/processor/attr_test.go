@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"github.com/tty2/xq/internal/domain"
 )
 
 func TestPickAttributesNames(t *testing.T) {
@@ -105,3 +106,59 @@ func TestPickAttributeValue(t *testing.T) {
 		rq.Error(err)
 	})
 }
+
+// nolint lll: there are long strings on purpose
+func TestProcessSeveralAttributes(t *testing.T) {
+	t.Parallel()
+
+	const data = `<svg><g id="a" data-x="1" data-y="2"><rect data-x="3" width="4" /></g><g data-x="1" /></svg>`
+
+	t.Run("all attributes", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p, err := New([]domain.Step{
+			{Name: "g", Index: -1, Descendant: true},
+		}, domain.Attribute{Name: domain.Wildcard}, domain.AttrValue)
+		rq.NoError(err)
+
+		err = p.process([]byte(data))
+		rq.NoError(err)
+		rq.Equal([]string{"id=a", "data-x=1", "data-y=2"}, p.printList)
+	})
+
+	t.Run("values by regular expression", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p, err := New([]domain.Step{
+			{Name: domain.Wildcard, Index: -1, Descendant: true},
+		}, domain.Attribute{Pattern: "^data-"}, domain.AttrValue)
+		rq.NoError(err)
+
+		err = p.process([]byte(data))
+		rq.NoError(err)
+		rq.Equal([]string{"data-x=1", "data-y=2", "data-x=3"}, p.printList)
+	})
+
+	t.Run("names by regular expression", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p, err := New([]domain.Step{
+			{Name: domain.Wildcard, Index: -1, Descendant: true},
+		}, domain.Attribute{Pattern: "^(id|width)$"}, domain.AttrList)
+		rq.NoError(err)
+
+		err = p.process([]byte(data))
+		rq.NoError(err)
+		rq.Equal([]string{"id", "width"}, p.printList)
+	})
+
+	t.Run("invalid regular expression", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := New([]domain.Step{{Name: "g", Index: -1}}, domain.Attribute{Pattern: "["}, domain.AttrValue)
+		require.Error(t, err)
+	})
+}
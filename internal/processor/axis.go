@@ -0,0 +1,136 @@
+package processor
+
+import "github.com/tty2/xq/internal/domain"
+
+// axisCandidate is a tag that is selected by the parent or ancestor axis step if the anchor path matches
+// one of its children or descendants.
+type axisCandidate struct {
+	depth   int    // length of the current path with the tag
+	passed  []bool // the same row as the tag has in `currentFilters`
+	pending []bool // the same row as the tag has in `currentPending`
+}
+
+// splitAxis splits the path with axis step to the anchor path which selects tags the axis is relative to
+// and the path which selects the result: the axis step matching tags at any depth and the steps after it.
+func splitAxis(path []domain.Step) ([]domain.Step, []domain.Step, domain.Axis) {
+	for i := range path {
+		if path[i].Axis == domain.AxisChild {
+			continue
+		}
+
+		target := path[i]
+		target.Descendant = true
+
+		return path[:i], append([]domain.Step{target}, path[i+1:]...), path[i].Axis
+	}
+
+	return nil, path, domain.AxisChild
+}
+
+// openAxis sets flag of the axis step for current tag and checks if current tag is matched by the anchor path.
+// Tag selected by parent or ancestor axis is pending until the anchor matches its descendant.
+func (p *Processor) openAxis(passed, pending []bool) ([]bool, []bool) {
+	if p.query.axis == domain.AxisChild {
+		return passed, pending
+	}
+
+	if passed == nil {
+		passed = make([]bool, len(p.query.path))
+		for j := range passed {
+			passed[j] = true
+		}
+	}
+	if pending == nil {
+		pending = make([]bool, len(p.query.path))
+	}
+
+	depth := len(p.currentPath)
+	if len(p.siblings) == 0 { // anchor among root tags
+		p.siblings = append(p.siblings, false)
+	}
+
+	passed[0] = passed[0] && p.query.path[0].MatchName(p.currentTag.name)
+	switch p.query.axis {
+	case domain.AxisParent, domain.AxisAncestor:
+		if passed[0] {
+			pending[0] = true
+			p.axes = append(p.axes, &axisCandidate{
+				depth:   depth,
+				passed:  passed,
+				pending: pending,
+			})
+		}
+	case domain.AxisFollowingSibling:
+		passed[0] = passed[0] && p.siblings[depth-1]
+	case domain.AxisChild:
+	}
+
+	p.siblings = append(p.siblings, false)
+	p.currentAnchor = append(p.currentAnchor, p.anchorFilters())
+	if domain.PathsMatch(p.query.anchor, p.currentPath, p.currentAnchor...) {
+		p.anchorFound(depth)
+	}
+
+	return passed, pending
+}
+
+// anchorFilters returns flags of the anchor steps whose filters and namespace current tag satisfies.
+func (p *Processor) anchorFilters() []bool {
+	var passed []bool
+	for i, step := range p.query.anchor {
+		if len(step.Filters) == 0 && step.Namespace == "" {
+			continue
+		}
+		if passed == nil {
+			passed = make([]bool, len(p.query.anchor))
+			for j := range passed {
+				passed[j] = true
+			}
+		}
+		passed[i] = p.inNamespace(step) && p.checkFilters(step.Filters, p.currentTag.bytes)
+	}
+
+	return passed
+}
+
+// anchorFound selects tags relative to the tag on `depth` matched by the anchor path.
+func (p *Processor) anchorFound(depth int) {
+	switch p.query.axis {
+	case domain.AxisParent, domain.AxisAncestor:
+		for _, c := range p.axes {
+			if c.depth < depth && (p.query.axis == domain.AxisAncestor || c.depth == depth-1) {
+				c.pending[0] = false
+			}
+		}
+	case domain.AxisFollowingSibling:
+		p.siblings[depth-1] = true
+	case domain.AxisChild:
+		return
+	}
+
+	p.flushQueue()
+}
+
+// closeAxis drops the tag on `depth` from the axis candidates if its descendants weren't matched by the anchor.
+func (p *Processor) closeAxis(depth int) {
+	if p.query.axis == domain.AxisChild {
+		return
+	}
+
+	if ln := len(p.axes); ln > 0 && p.axes[ln-1].depth == depth {
+		c := p.axes[ln-1]
+		p.axes = p.axes[:ln-1]
+		if c.pending[0] {
+			c.passed[0] = false
+			c.pending[0] = false
+			p.changeMatches(c.depth - 1)
+		}
+	}
+
+	if len(p.siblings) > depth {
+		p.siblings = p.siblings[:depth]
+	}
+	if len(p.currentAnchor) > 0 {
+		p.currentAnchor = p.currentAnchor[:len(p.currentAnchor)-1]
+	}
+}
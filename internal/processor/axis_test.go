@@ -0,0 +1,112 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tty2/xq/internal/domain"
+)
+
+// nolint lll: there are long strings on purpose
+func TestProcessWithAxes(t *testing.T) {
+	t.Parallel()
+
+	const data = `<shop><book id="1"><title>a</title><price>10</price></book><book id="2"><title>b</title></book><magazine id="3"><issue><price>5</price></issue></magazine></shop>`
+
+	t.Run("parent", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p, err := New([]domain.Step{
+			{Name: "price", Index: -1, Descendant: true},
+			{Name: domain.Wildcard, Index: -1, Axis: domain.AxisParent},
+		}, domain.Attribute{Name: "id"}, domain.AttrValue)
+		rq.NoError(err)
+
+		err = p.process([]byte(data))
+		rq.NoError(err)
+		rq.Equal([]string{"1"}, p.printList)
+		rq.Empty(p.queue)
+		rq.Empty(p.axes)
+	})
+
+	t.Run("parent with child step", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p, err := New([]domain.Step{
+			{Name: "price", Index: -1, Descendant: true},
+			{Name: domain.Wildcard, Index: -1, Axis: domain.AxisParent},
+			{Name: "title", Index: -1},
+		}, domain.Attribute{}, domain.TagValue)
+		rq.NoError(err)
+
+		err = p.process([]byte(data))
+		rq.NoError(err)
+		rq.Len(p.printList, 3)
+		rq.Contains(p.printList[1], "a")
+	})
+
+	t.Run("ancestor", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p, err := New([]domain.Step{
+			{Name: "price", Index: -1, Descendant: true},
+			{Name: domain.Wildcard, Index: -1, Axis: domain.AxisAncestor, Filters: []domain.Filter{
+				{Attribute: "id", Operator: domain.FilterExists},
+			}},
+		}, domain.Attribute{Name: "id"}, domain.AttrValue)
+		rq.NoError(err)
+
+		err = p.process([]byte(data))
+		rq.NoError(err)
+		rq.Equal([]string{"1", "3"}, p.printList)
+	})
+
+	t.Run("following sibling", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p, err := New([]domain.Step{
+			{Name: "book", Index: -1, Descendant: true, Filters: []domain.Filter{
+				{Attribute: "id", Operator: domain.FilterEqual, Value: "1"},
+			}},
+			{Name: domain.Wildcard, Index: -1, Axis: domain.AxisFollowingSibling},
+		}, domain.Attribute{Name: "id"}, domain.AttrValue)
+		rq.NoError(err)
+
+		err = p.process([]byte(data + `<shop><magazine id="4" /></shop>`))
+		rq.NoError(err)
+		rq.Equal([]string{"2", "3"}, p.printList)
+		rq.Equal([]bool{false}, p.siblings) // frame of root tags
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for _, path := range [][]domain.Step{
+			{
+				{Name: "a", Index: -1, Filters: []domain.Filter{{Child: []string{"b"}, Operator: domain.FilterExists}}},
+				{Name: domain.Wildcard, Index: -1, Axis: domain.AxisParent},
+			},
+			{
+				{Name: "a", Index: -1},
+				{Name: "b", Index: -1, Axis: domain.AxisAncestor, Slice: &domain.Slice{Start: 0, End: 1, HasEnd: true, Step: 1}},
+			},
+			{
+				{Name: "a", Index: 1},
+				{Name: "b", Index: -1, Axis: domain.AxisFollowingSibling},
+			},
+			{
+				{Name: "a", Index: -1},
+				{Name: domain.Wildcard, Index: -1, Axis: domain.AxisParent},
+				{Name: domain.Wildcard, Index: -1, Axis: domain.AxisParent},
+			},
+		} {
+			_, err := New(path, domain.Attribute{}, domain.TagList)
+			rq.Error(err)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package processor
+
+import (
+	"github.com/tty2/xq/internal/domain"
+)
+
+// condition is a state of the step condition for the candidate. Results of attribute filters are known
+// as soon as the tag is opened, child filters are satisfied when the children are read.
+type condition struct {
+	operator domain.ConditionOperator
+	operands []*condition
+	value    bool        // result of attribute filter
+	check    *childCheck // check of child filter
+}
+
+// waitsForChildren checks if the step can be checked only when the children of the tag are read.
+func waitsForChildren(step domain.Step) bool {
+	return hasChildFilters(step.Filters) || step.Condition != nil
+}
+
+// stepCondition returns condition which consists of the step child filters and the condition set by select.
+func stepCondition(step domain.Step) domain.Condition {
+	operands := []domain.Condition{}
+	for _, f := range step.Filters {
+		if f.IsChild() {
+			operands = append(operands, domain.Condition{
+				Operator: domain.ConditionFilter,
+				Filter:   f,
+			})
+		}
+	}
+	if step.Condition != nil {
+		operands = append(operands, *step.Condition)
+	}
+
+	return domain.Condition{
+		Operator: domain.ConditionAnd,
+		Operands: operands,
+	}
+}
+
+// newCondition creates state of the condition for the `step` of the candidate `c` and current tag.
+func (p *Processor) newCondition(dc domain.Condition, c *candidate, step int) *condition {
+	cond := &condition{
+		operator: dc.Operator,
+	}
+	if dc.Operator != domain.ConditionFilter {
+		for i := range dc.Operands {
+			cond.operands = append(cond.operands, p.newCondition(dc.Operands[i], c, step))
+		}
+
+		return cond
+	}
+
+	if !dc.Filter.IsChild() {
+		cond.value = p.checkFilter(dc.Filter, p.currentTag.bytes)
+
+		return cond
+	}
+
+	cond.check = &childCheck{
+		owner:  c,
+		step:   step,
+		filter: dc.Filter,
+	}
+	c.checks = append(c.checks, cond.check)
+
+	return cond
+}
+
+// evaluate returns result of the condition and if it's known. Child filters that aren't satisfied yet are
+// unknown unless it's `final` and the children are read.
+func (c *condition) evaluate(final bool) (bool, bool) {
+	switch c.operator {
+	case domain.ConditionFilter:
+		if c.check == nil {
+			return c.value, true
+		}
+		if c.check.satisfied {
+			return true, true
+		}
+
+		return false, final
+	case domain.ConditionAnd:
+		known := true
+		for _, o := range c.operands {
+			value, ok := o.evaluate(final)
+			if ok && !value {
+				return false, true
+			}
+			known = known && ok
+		}
+
+		return known, known
+	case domain.ConditionOr:
+		known := true
+		for _, o := range c.operands {
+			value, ok := o.evaluate(final)
+			if ok && value {
+				return true, true
+			}
+			known = known && ok
+		}
+
+		return false, known
+	case domain.ConditionNot:
+		value, ok := c.operands[0].evaluate(final)
+
+		return !value, ok
+	}
+
+	return false, true
+}
+
+// resolveKnown resolves the steps of the candidate which conditions are known as soon as the tag is opened.
+func (p *Processor) resolveKnown(c *candidate) {
+	for i, cond := range c.conditions {
+		if cond == nil {
+			continue
+		}
+		if value, ok := cond.evaluate(false); ok {
+			p.resolve(c, i, value)
+		}
+	}
+}
+
+// resolve sets result of the `step` condition for the candidate. If the step child filters set in brackets
+// are satisfied, the tag gets position of the step with slice. Position counted from the end is checked
+// when the parent is closed.
+func (p *Processor) resolve(c *candidate, step int, value bool) {
+	c.conditions[step] = nil
+	p.changeMatches(c.depth - 1)
+	if !value {
+		c.passed[step] = false
+		c.pending[step] = false
+
+		return
+	}
+
+	for i, s := range c.unplaced {
+		if s == step {
+			c.unplaced = append(c.unplaced[:i], c.unplaced[i+1:]...)
+			c.pending[step] = false
+			p.place(c.parent, step, c.passed, c.pending)
+
+			return
+		}
+	}
+	if sl := p.query.path[step].Slice; sl != nil && sl.FromEnd() {
+		return
+	}
+	c.pending[step] = false
+}
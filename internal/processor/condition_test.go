@@ -0,0 +1,141 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tty2/xq/internal/domain"
+)
+
+// nolint lll: there are long strings on purpose
+func TestProcessWithConditions(t *testing.T) {
+	t.Parallel()
+
+	const data = `<Items><Item sku="a"><Quantity>1</Quantity><USPrice>148.95</USPrice></Item><Item sku="b"><Quantity>2</Quantity><USPrice>39.98</USPrice><Comment>gift</Comment></Item><Item sku="c"><Quantity>3.0</Quantity><USPrice>200</USPrice></Item></Items>`
+
+	filter := func(f domain.Filter) domain.Condition {
+		return domain.Condition{Operator: domain.ConditionFilter, Filter: f}
+	}
+	quantity := filter(domain.Filter{Child: []string{"Quantity"}, Operator: domain.FilterGreater, Value: "1"})
+	price := filter(domain.Filter{Child: []string{"USPrice"}, Operator: domain.FilterLess, Value: "100"})
+	comment := filter(domain.Filter{Child: []string{"Comment"}, Operator: domain.FilterExists})
+
+	process := func(t *testing.T, cond domain.Condition, slice *domain.Slice) []string {
+		t.Helper()
+
+		p, err := New([]domain.Step{
+			{Name: "Items", Index: -1},
+			{Name: "Item", Index: -1, Condition: &cond, Slice: slice},
+		}, domain.Attribute{Name: "sku"}, domain.AttrValue)
+		require.NoError(t, err)
+
+		err = p.process([]byte(data))
+		require.NoError(t, err)
+		require.NoError(t, p.finish())
+		require.Empty(t, p.queue)
+		require.Empty(t, p.candidates)
+
+		return p.printList
+	}
+
+	t.Run("and", func(t *testing.T) {
+		t.Parallel()
+
+		res := process(t, domain.Condition{
+			Operator: domain.ConditionAnd,
+			Operands: []domain.Condition{quantity, price},
+		}, nil)
+		require.Equal(t, []string{"b"}, res)
+	})
+
+	t.Run("or and not", func(t *testing.T) {
+		t.Parallel()
+
+		res := process(t, domain.Condition{
+			Operator: domain.ConditionOr,
+			Operands: []domain.Condition{
+				filter(domain.Filter{Child: []string{"Quantity"}, Operator: domain.FilterEqual, Value: "3"}),
+				{Operator: domain.ConditionNot, Operands: []domain.Condition{comment}},
+			},
+		}, nil)
+		require.Equal(t, []string{"a", "c"}, res)
+	})
+
+	t.Run("attributes", func(t *testing.T) {
+		t.Parallel()
+
+		res := process(t, domain.Condition{
+			Operator: domain.ConditionNot,
+			Operands: []domain.Condition{
+				filter(domain.Filter{Attribute: "sku", Operator: domain.FilterMatch, Value: "^[ab]$"}),
+			},
+		}, nil)
+		require.Equal(t, []string{"c"}, res)
+	})
+
+	t.Run("text of the tag", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		cond := filter(domain.Filter{Self: true, Operator: domain.FilterGreater, Value: "1"})
+		p, err := New([]domain.Step{
+			{Name: "Items", Index: -1},
+			{Name: "Item", Index: -1},
+			{Name: "Quantity", Index: -1, Condition: &cond},
+		}, domain.Attribute{}, domain.TagText)
+		rq.NoError(err)
+		rq.NoError(p.process([]byte(data)))
+		rq.NoError(p.finish())
+		rq.Equal([]string{"2", "3.0"}, p.printList)
+
+		res := process(t, filter(domain.Filter{Self: true, Operator: domain.FilterMatch, Value: "gift$"}), nil)
+		rq.Equal([]string{"b"}, res)
+	})
+
+	t.Run("attribute of the child", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		cond := domain.Condition{Operator: domain.ConditionOr, Operands: []domain.Condition{
+			filter(domain.Filter{Child: []string{"info"}, Attribute: "year", Operator: domain.FilterGreater, Value: "2000"}),
+			filter(domain.Filter{Child: []string{"info"}, Attribute: "lang", Operator: domain.FilterExists}),
+		}}
+		p, err := New([]domain.Step{{Name: "a", Index: -1, Descendant: true, Condition: &cond}}, domain.Attribute{Name: "id"},
+			domain.AttrValue)
+		rq.NoError(err)
+		rq.NoError(p.process([]byte(`<r><a id="1"><info year="1999"/></a><a id="2"><info year="1"/><info year="2005"/></a><a id="3"><info lang="EN">2001</info></a><a id="4"><year>2005</year></a></r>`)))
+		rq.NoError(p.finish())
+		rq.Equal([]string{"2", "3"}, p.printList)
+	})
+
+	t.Run("positions are counted before condition", func(t *testing.T) {
+		t.Parallel()
+
+		res := process(t, quantity, &domain.Slice{Start: 1, Step: 1})
+		require.Equal(t, []string{"b", "c"}, res)
+
+		res = process(t, quantity, &domain.Slice{Start: 0, End: 1, HasEnd: true, Step: 1})
+		require.Empty(t, res)
+
+		res = process(t, price, &domain.Slice{Start: -1, Step: 1})
+		require.Empty(t, res)
+
+		res = process(t, comment, &domain.Slice{Start: -2, End: -1, HasEnd: true, Step: 1})
+		require.Equal(t, []string{"b"}, res)
+	})
+
+	t.Run("child filters with position", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := New([]domain.Step{
+			{
+				Name:      "Item",
+				Index:     -1,
+				Filters:   []domain.Filter{{Child: []string{"Comment"}, Operator: domain.FilterExists}},
+				Condition: &quantity,
+				Slice:     &domain.Slice{Start: 0, End: 1, HasEnd: true, Step: 1},
+			},
+		}, domain.Attribute{}, domain.TagList)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,471 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/tty2/xq/internal/domain"
+	"github.com/tty2/xq/internal/domain/symbol"
+	"github.com/tty2/xq/internal/transform"
+)
+
+const whitespaces = " \t\r\n"
+
+type (
+	// Edit sets how the tags or attributes matched by the query are modified.
+	Edit struct {
+		Operator  domain.EditOperator
+		Value     string            // value set by `EditAssign` or the markup inserted by the others
+		Functions []domain.Function // string functions applied to the value by `EditUpdate`
+	}
+
+	// editor keeps markup of the document read after the last printed part, so the markup which isn't modified
+	// is printed as it is.
+	editor struct {
+		Edit
+		functions transform.Chain
+		text      *Processor // evaluates text of the modified tag if it has nested tags
+		wrapper   [2]string  // open and close tags set by `EditWrap`
+		document  []byte
+		// tags of current path matched by the query, the nested ones are modified if the outer ones aren't
+		contents []*content
+	}
+
+	// content keeps markup of the tag matched by the query until the tag is closed.
+	content struct {
+		depth  int    // length of the current path with the tag
+		line   []byte // line break and indentation before the tag if it starts the line
+		open   int    // size of the open tag
+		value  []byte
+		edited []byte // the value with the modified nested tags
+	}
+)
+
+// SetEdit sets how the tags or attributes matched by `TagEdit` search are modified.
+func (p *Processor) SetEdit(e Edit) error {
+	functions, err := transform.Compile(e.Functions)
+	if err != nil {
+		return err
+	}
+
+	text, err := New([]domain.Step{{Name: domain.Wildcard, Index: -1}}, domain.Attribute{}, domain.TagText)
+	if err != nil {
+		return err
+	}
+
+	p.edit = &editor{
+		Edit:      e,
+		functions: functions,
+		text:      text,
+	}
+	if e.Operator == domain.EditWrap {
+		open, closeTag, ok := wrapper(e.Value)
+		if !ok {
+			return fmt.Errorf("tags can be wrapped into the only empty tag, but got `%s`", e.Value)
+		}
+		p.edit.wrapper = [2]string{open, closeTag}
+	}
+
+	return nil
+}
+
+// keep adds the markup to the document or to the content of the innermost modified tag if it's open.
+func (p *Processor) keep(b ...byte) {
+	p.keepEdited(b, b)
+}
+
+// keepEdited adds the original markup and the markup with the modified nested tags to the content of the innermost
+// modified tag. Only the modified markup is added to the document.
+func (p *Processor) keepEdited(original, edited []byte) {
+	if p.edit == nil {
+		return
+	}
+	if ln := len(p.edit.contents); ln > 0 {
+		c := p.edit.contents[ln-1]
+		c.value = append(c.value, original...)
+		c.edited = append(c.edited, edited...)
+
+		return
+	}
+	p.edit.document = append(p.edit.document, edited...)
+}
+
+// flushDocument prints the markup of the document read after the last printed part. Unless `all` is set, whitespaces
+// at the end wait for the next markup, so the line of the deleted tag can be removed with its indentation.
+func (p *Processor) flushDocument(all bool) {
+	if p.edit == nil {
+		return
+	}
+
+	end := len(p.edit.document)
+	if !all {
+		end = len(bytes.TrimRight(p.edit.document, whitespaces))
+	}
+	if end == 0 {
+		return
+	}
+
+	p.print(string(p.edit.document[:end]), false, matchAny)
+	p.edit.document = append(p.edit.document[:0], p.edit.document[end:]...)
+}
+
+// lineStart returns the line break and indentation the document or the content of the innermost modified tag ends
+// with if current tag starts the line. They are removed from the markup.
+func (p *Processor) lineStart() []byte {
+	ln := len(p.edit.contents)
+	if ln == 0 {
+		i := lastLine(p.edit.document)
+		if i == -1 {
+			return nil
+		}
+		line := append([]byte{}, p.edit.document[i:]...)
+		p.edit.document = p.edit.document[:i]
+
+		return line
+	}
+
+	c := p.edit.contents[ln-1]
+	i := lastLine(c.edited)
+	if i == -1 || !bytes.HasSuffix(c.value, c.edited[i:]) {
+		return nil
+	}
+	line := append([]byte{}, c.edited[i:]...)
+	c.edited = c.edited[:i]
+	c.value = c.value[:len(c.value)-len(line)]
+
+	return line
+}
+
+// lastLine returns index of the line break the markup ends with if there are only whitespaces after it or -1.
+func lastLine(markup []byte) int {
+	i := bytes.LastIndexByte(markup, symbol.NewLine)
+	if i == -1 || len(bytes.TrimLeft(markup[i:], whitespaces)) > 0 {
+		return -1
+	}
+	if i > 0 && markup[i-1] == symbol.CarriageReturn {
+		i--
+	}
+
+	return i
+}
+
+// openEdit modifies the attribute of current tag or starts to keep its content to modify the tag when it's closed.
+// Tags nested into the modified one are modified only if the outer tag turns out not to match the query.
+func (p *Processor) openEdit() {
+	if p.query.attribute == "" {
+		p.edit.contents = append(p.edit.contents, &content{
+			depth: len(p.currentPath),
+			line:  p.lineStart(),
+			open:  len(p.currentTag.bytes),
+		})
+
+		return
+	}
+
+	name, ok := p.attributeName(p.query.attribute, p.query.namespace, p.currentTag.bytes)
+	if !ok {
+		return
+	}
+	value, ok := p.edit.attribute(p.currentTag.bytes, name)
+	if !ok {
+		return
+	}
+	p.currentTag.edited = true
+	p.flushDocument(true)
+	p.printOr(value, string(p.currentTag.bytes), false, p.matchCurrent)
+}
+
+// closeEdit prints the modified tag on `depth` when the tag is closed. The tag nested into another modified one
+// is added to the content of the outer tag, it's modified only if its path is known to match the query.
+func (p *Processor) closeEdit(depth int) {
+	ln := len(p.edit.contents)
+	if ln == 0 || p.edit.contents[ln-1].depth != depth {
+		return
+	}
+	c := p.edit.contents[ln-1]
+	p.edit.contents = p.edit.contents[:ln-1]
+	original := append(append([]byte{}, c.line...), c.value...)
+	unchanged := append(append([]byte{}, c.line...), c.edited...)
+
+	if !p.currentPathMatch() { // child filters of the tag aren't satisfied
+		p.keepEdited(original, unchanged)
+
+		return
+	}
+
+	value, ok := p.edit.element(c.line, c.value, c.open, p.currentTag.name)
+	if !ok {
+		p.keepEdited(original, unchanged)
+
+		return
+	}
+	if len(p.edit.contents) > 0 {
+		if domain.PathsMatch(p.query.path, p.currentPath, checkedFilters(p.currentFilters, p.currentPending)...) {
+			p.keepEdited(original, []byte(value))
+		} else {
+			p.keepEdited(original, unchanged)
+		}
+
+		return
+	}
+	p.flushDocument(true)
+	p.printOr(value, string(unchanged), false, p.matchCurrent)
+}
+
+// element returns the modified markup of the tag with the line it starts. Deleted tag has no markup, so its line
+// is removed. Markup inserted before or after the tag starts the same line as the tag.
+func (e *editor) element(line, markup []byte, open int, name string) (string, bool) {
+	switch e.Operator {
+	case domain.EditDelete:
+		return "", true
+	case domain.EditAppend:
+		return string(line) + appendChild(markup, open, name, e.Value), true
+	case domain.EditBefore:
+		return string(line) + e.Value + string(line) + string(markup), true
+	case domain.EditAfter:
+		return string(line) + string(markup) + string(line) + e.Value, true
+	case domain.EditWrap:
+		return string(line) + e.wrapper[0] + string(markup) + e.wrapper[1], true
+	case domain.EditUnwrap:
+		if open == len(markup) {
+			return "", true
+		}
+		content := markup[open:bytes.LastIndexByte(markup, symbol.OpenBracket)]
+		text := string(bytes.Trim(content, whitespaces))
+		if text == "" {
+			return "", true
+		}
+		if indent := contentLine(content); len(line) > 0 && len(indent) > 0 { // content is shifted to the tag line
+			text = strings.ReplaceAll(text, string(indent), string(line))
+		}
+
+		return string(line) + text, true
+	case domain.EditAssign, domain.EditUpdate:
+	}
+
+	value, ok := e.replaceText(markup, open, name)
+	if !ok {
+		return "", false
+	}
+
+	return string(line) + value, true
+}
+
+// replaceText returns markup of the tag with modified text. If the tag has nested tags, they are replaced by
+// the text. Whitespaces around the text of the tag without nested tags are kept.
+func (e *editor) replaceText(markup []byte, open int, name string) (string, bool) {
+	if open == len(markup) { // `<tag/>`
+		value, ok := e.value("")
+		if !ok {
+			return "", false
+		}
+		tag := bytes.TrimRight(markup[:open-2], whitespaces)
+
+		return string(tag) + ">" + escape(value, 0) + "</" + name + ">", true
+	}
+
+	end := bytes.LastIndexByte(markup, symbol.OpenBracket) // close tag
+	text := markup[open:end]
+	start, stop := 0, len(text)
+	var old string
+	if bytes.IndexByte(text, symbol.OpenBracket) == -1 {
+		start = len(text) - len(bytes.TrimLeft(text, whitespaces))
+		stop = len(bytes.TrimRight(text, whitespaces))
+		if stop < start { // the text is whitespaces only
+			stop = start
+		}
+		old = domain.DecodeEntities(string(text[start:stop]))
+	} else {
+		values, err := e.text.Evaluate(markup)
+		if err != nil {
+			return "", false
+		}
+		if len(values) > 0 {
+			old = values[0]
+		}
+	}
+
+	value, ok := e.value(old)
+	if !ok {
+		return "", false
+	}
+
+	return string(markup[:open+start]) + escape(value, 0) + string(markup[open+stop:]), true
+}
+
+// appendChild returns markup of the tag with the child inserted after its content. The child starts a new line
+// with indentation of the content if the content starts a new line.
+func appendChild(markup []byte, open int, name, child string) string {
+	if open == len(markup) { // `<tag/>`
+		return string(bytes.TrimRight(markup[:open-2], whitespaces)) + ">" + child + "</" + name + ">"
+	}
+
+	content := markup[open:bytes.LastIndexByte(markup, symbol.OpenBracket)]
+	end := open + len(bytes.TrimRight(content, whitespaces))
+
+	return string(markup[:end]) + string(contentLine(content)) + child + string(markup[end:])
+}
+
+// contentLine returns the line break and indentation the content of the tag starts with if it starts a new line.
+func contentLine(content []byte) []byte {
+	indent := content[:len(content)-len(bytes.TrimLeft(content, whitespaces))]
+	i := bytes.LastIndexByte(indent, symbol.NewLine)
+	if i == -1 {
+		return nil
+	}
+	if i > 0 && indent[i-1] == symbol.CarriageReturn {
+		i--
+	}
+
+	return indent[i:]
+}
+
+// wrapper returns the open and close tags of the empty tag the modified tags are wrapped into: `<w/>`, `<w></w>`.
+func wrapper(markup string) (string, string, bool) {
+	markup = strings.TrimSpace(markup)
+	if !strings.HasPrefix(markup, "<") || !strings.HasSuffix(markup, ">") {
+		return "", "", false
+	}
+
+	end := 1
+	for ; end < len(markup) && markup[end] != symbol.CloseBracket; end++ {
+		if symbol.IsQuote(markup[end]) {
+			i := strings.IndexByte(markup[end+1:], markup[end])
+			if i == -1 {
+				return "", "", false
+			}
+			end += i + 1
+		}
+	}
+	name := strings.FieldsFunc(markup[1:end], func(r rune) bool {
+		return r == '/' || symbol.IsSpace(byte(r))
+	})
+	if len(name) == 0 || end == len(markup) {
+		return "", "", false
+	}
+	closeTag := "</" + name[0] + ">"
+
+	if end == len(markup)-1 && markup[end-1] == '/' {
+		return strings.TrimRight(markup[:end-1], whitespaces) + ">", closeTag, true
+	}
+	if strings.TrimSpace(markup[end+1:]) != closeTag {
+		return "", "", false
+	}
+
+	return markup[:end+1], closeTag, true
+}
+
+// attribute returns the tag with modified value of the attribute. The attribute is added to the tag if it's
+// assigned and the tag doesn't have it. Deleted attribute is removed with whitespaces before it.
+func (e *editor) attribute(tag []byte, name string) (string, bool) {
+	start, end, found := attributeSpan(tag, name)
+	if e.Operator == domain.EditDelete {
+		if !found {
+			return "", false
+		}
+		i := bytes.LastIndex(tag[:start], []byte(name))
+		i = len(bytes.TrimRight(tag[:i], whitespaces))
+
+		return string(tag[:i]) + string(tag[end+1:]), true
+	}
+	if !found {
+		if e.Operator != domain.EditAssign {
+			return "", false
+		}
+		end = len(tag) - 1
+		if tag[end-1] == '/' {
+			end--
+		}
+		end = len(bytes.TrimRight(tag[:end], whitespaces))
+
+		return string(tag[:end]) + " " + name + `="` + escape(e.Value, '"') + `"` + string(tag[end:]), true
+	}
+
+	value, ok := e.value(domain.DecodeEntities(string(tag[start:end])))
+	if !ok {
+		return "", false
+	}
+
+	return string(tag[:start]) + escape(value, tag[start-1]) + string(tag[end:]), true
+}
+
+// value returns the new value instead of the old one. It returns false if the value isn't changed, so the markup
+// is kept as it is.
+func (e *editor) value(old string) (string, bool) {
+	value := e.Value
+	if e.Operator == domain.EditUpdate {
+		values := e.functions.Apply(old)
+		if len(values) == 0 {
+			return "", false
+		}
+		value = values[0]
+	}
+
+	return value, value != old
+}
+
+// attributeSpan returns the start and the end of the attribute value in the tag without quotes.
+func attributeSpan(tag []byte, name string) (int, int, bool) {
+	i := 1
+	for i < len(tag) && !symbol.IsSpace(tag[i]) && tag[i] != '/' && tag[i] != symbol.CloseBracket { // tag name
+		i++
+	}
+
+	for i < len(tag) {
+		for i < len(tag) && strings.IndexByte(whitespaces, tag[i]) > -1 {
+			i++
+		}
+		start := i
+		for i < len(tag) && tag[i] != '=' && strings.IndexByte(whitespaces, tag[i]) == -1 &&
+			tag[i] != '/' && tag[i] != symbol.CloseBracket {
+			i++
+		}
+		attr := string(tag[start:i])
+		for i < len(tag) && strings.IndexByte(whitespaces, tag[i]) > -1 {
+			i++
+		}
+		if i == len(tag) || tag[i] != '=' {
+			if i == start { // `/` or `>`
+				i++
+			}
+
+			continue
+		}
+		i++
+		for i < len(tag) && strings.IndexByte(whitespaces, tag[i]) > -1 {
+			i++
+		}
+		if i == len(tag) || !symbol.IsQuote(tag[i]) {
+			return 0, 0, false
+		}
+		end := bytes.IndexByte(tag[i+1:], tag[i])
+		if end == -1 {
+			return 0, 0, false
+		}
+		if attr == name {
+			return i + 1, i + 1 + end, true
+		}
+		i += end + 2
+	}
+
+	return 0, 0, false
+}
+
+// escape replaces symbols which can't be used in text by entities. Quote is escaped too if it's set.
+func escape(value string, quote byte) string {
+	pairs := []string{"&", "&amp;", "<", "&lt;", ">", "&gt;"}
+	switch quote {
+	case symbol.DoubleQuote:
+		pairs = append(pairs, `"`, "&quot;")
+	case symbol.Quote:
+		pairs = append(pairs, "'", "&apos;")
+	}
+
+	return strings.NewReplacer(pairs...).Replace(value)
+}
+
+// matchAny is the match of the document markup which is printed anyway.
+func matchAny([]string, [][]bool) bool {
+	return true
+}
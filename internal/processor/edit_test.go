@@ -0,0 +1,376 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tty2/xq/internal/domain"
+)
+
+// editDocument returns the document modified by the processor. The document is processed by chunks.
+func editDocument(t *testing.T, path []domain.Step, attribute string, e Edit, chunks ...string) string {
+	t.Helper()
+	rq := require.New(t)
+
+	p, err := New(path, domain.Attribute{Name: attribute}, domain.TagEdit)
+	rq.NoError(err)
+	rq.NoError(p.SetEdit(e))
+
+	for _, chunk := range chunks {
+		rq.NoError(p.process([]byte(chunk)))
+	}
+	rq.NoError(p.finish())
+
+	return strings.Join(p.printList, "")
+}
+
+// editError returns the error the processor stops editing the document with.
+func editError(t *testing.T, path []domain.Step, attribute string, e Edit, chunks ...string) error {
+	t.Helper()
+	rq := require.New(t)
+
+	p, err := New(path, domain.Attribute{Name: attribute}, domain.TagEdit)
+	rq.NoError(err)
+	rq.NoError(p.SetEdit(e))
+
+	for _, chunk := range chunks {
+		err = p.process([]byte(chunk))
+		if err != nil {
+			return err
+		}
+	}
+
+	return p.finish()
+}
+
+// nolint lll: there are long strings on purpose
+func TestProcessEdit(t *testing.T) {
+	t.Parallel()
+
+	t.Run("assign text", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := editDocument(t, []domain.Step{{Name: "a", Index: -1}, {Name: "b", Index: -1}}, "",
+			Edit{Operator: domain.EditAssign, Value: "x & <y>"},
+			"<?xml version=\"1.0\"?>\n<!-- <b>1</b> -->\n<a>\n  <b id='1'>\n    1\n  </b>\n  <b/>\n  <b>2<c>3</c></b>\n  <c>4</c>\n</a>\n")
+		rq.Equal("<?xml version=\"1.0\"?>\n<!-- <b>1</b> -->\n<a>\n  <b id='1'>\n    x &amp; &lt;y&gt;\n  </b>\n  <b>x &amp; &lt;y&gt;</b>\n  <b>x &amp; &lt;y&gt;</b>\n  <c>4</c>\n</a>\n", res)
+	})
+
+	t.Run("update text", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := editDocument(t, []domain.Step{{Name: "b", Index: -1, Descendant: true}}, "",
+			Edit{Operator: domain.EditUpdate, Functions: []domain.Function{{Name: "sub", Args: []string{"^a", "A"}}}},
+			"<a><b>a &amp; b</b><b>b</b><b> a <![CDATA[<c>]]></b></a>")
+		rq.Equal("<a><b>A &amp; b</b><b>b</b><b>A &lt;c&gt;</b></a>", res)
+	})
+
+	t.Run("attribute", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		path := []domain.Step{{Name: "a", Index: -1}, {Name: "b", Index: -1}}
+		res := editDocument(t, path, "url",
+			Edit{Operator: domain.EditUpdate, Functions: []domain.Function{{Name: "sub", Args: []string{"^http:", "https:"}}}},
+			`<a><b url='http://a?x=1&amp;y="2"'/><b  url = "http://b" /><b>http://c</b></a>`)
+		rq.Equal(`<a><b url='https://a?x=1&amp;y="2"'/><b  url = "https://b" /><b>http://c</b></a>`, res)
+
+		res = editDocument(t, path, "id", Edit{Operator: domain.EditAssign, Value: `"1"`},
+			`<a><b id="0">x</b><b /><b data-id="2"></b></a>`)
+		rq.Equal(`<a><b id="&quot;1&quot;">x</b><b id="&quot;1&quot;" /><b data-id="2" id="&quot;1&quot;"></b></a>`, res)
+	})
+
+	t.Run("child filters", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := editDocument(t, []domain.Step{
+			{Name: "a", Index: -1},
+			{Name: "b", Index: -1, Filters: []domain.Filter{{Child: []string{"d"}, Operator: domain.FilterExists}}},
+			{Name: "c", Index: -1},
+		}, "id", Edit{Operator: domain.EditAssign, Value: "x"},
+			`<a><b><c id="1">1</c></b><b><c id="2">2</c><d/></b></a>`)
+		rq.Equal(`<a><b><c id="1">1</c></b><b><c id="x">2</c><d/></b></a>`, res)
+	})
+
+	t.Run("nested candidates", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		filters := []domain.Filter{{Child: []string{"b"}, Operator: domain.FilterExists}}
+		res := editDocument(t, []domain.Step{{Name: "c", Index: -1, Descendant: true, Filters: filters}}, "",
+			Edit{Operator: domain.EditAssign, Value: "Z"},
+			"<r>\n  <c>\n    <c>\n      <b>1</b>\n    </c>\n  </c>\n  <c><c><b>2</b></c><b>3</b></c>\n</r>")
+		rq.Equal("<r>\n  <c>\n    <c>Z</c>\n  </c>\n  <c>Z</c>\n</r>", res)
+
+		res = editDocument(t, []domain.Step{{Name: domain.Wildcard, Index: -1, Descendant: true, Filters: filters}}, "",
+			Edit{Operator: domain.EditAssign, Value: "Z"}, "<r><c><b>1</b></c></r>")
+		rq.Equal("<r><c>Z</c></r>", res)
+	})
+
+	t.Run("index", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := editDocument(t, []domain.Step{{Name: "a", Index: -1}, {Name: "b", Index: 1}}, "",
+			Edit{Operator: domain.EditAssign, Value: "x"},
+			"<a><b>1</b><b>2</b><b>", "3</b>", "</a>")
+		rq.Equal("<a><b>1</b><b>x</b><b>3</b></a>", res)
+	})
+
+	t.Run("unchanged markup", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		data := "<a>\n\t<b x = '1'>&#65;</b>\n</a>"
+		res := editDocument(t, []domain.Step{{Name: domain.Wildcard, Index: -1, Descendant: true}}, "",
+			Edit{Operator: domain.EditUpdate, Functions: []domain.Function{{Name: "upper"}}}, data)
+		rq.Equal(data, res)
+	})
+}
+
+// nolint lll: there are long strings on purpose
+func TestProcessDelete(t *testing.T) {
+	t.Parallel()
+
+	t.Run("tags", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := editDocument(t, []domain.Step{{Name: "b", Index: -1, Descendant: true}}, "", Edit{Operator: domain.EditDelete},
+			"<a>\n  <b>\n    <b/>\n  </b>\n  <c>1</c><b/>\n  ", "<b/>\r\n</a>\n")
+		rq.Equal("<a>\n  <c>1</c>\r\n</a>\n", res)
+	})
+
+	t.Run("child filters", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := editDocument(t, []domain.Step{
+			{Name: "a", Index: -1},
+			{Name: "b", Index: -1, Filters: []domain.Filter{{Child: []string{"c"}, Operator: domain.FilterEqual, Value: "1"}}},
+		}, "", Edit{Operator: domain.EditDelete},
+			"<a>\n  <b><c>1</c></b>\n  <b><c>2</c></b>\n</a>")
+		rq.Equal("<a>\n  <b><c>2</c></b>\n</a>", res)
+	})
+
+	t.Run("nested candidates", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := editDocument(t, []domain.Step{
+			{Name: "c", Index: -1, Descendant: true, Filters: []domain.Filter{{Child: []string{"b"}, Operator: domain.FilterExists}}},
+		}, "", Edit{Operator: domain.EditDelete},
+			"<r>\n  <c>\n    <c>\n      <b>1</b>\n    </c>\n  </c>\n  <c><c><b>2</b></c><b>3</b></c>\n</r>")
+		rq.Equal("<r>\n  <c>\n  </c>\n</r>", res)
+	})
+
+	t.Run("attributes", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := editDocument(t, []domain.Step{{Name: "a", Index: -1}, {Name: "b", Index: -1}}, "id", Edit{Operator: domain.EditDelete},
+			`<a id="0"><b x="1" id = '2'/><b id="3"	y="4">5</b><b/></a>`)
+		rq.Equal(`<a id="0"><b x="1"/><b	y="4">5</b><b/></a>`, res)
+	})
+
+	t.Run("incorrect document", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		path := []domain.Step{{Name: "a", Index: -1}, {Name: "c", Index: -1}}
+		for _, attribute := range []string{"", "id"} {
+			err := editError(t, path, attribute, Edit{Operator: domain.EditDelete}, "<a><b>1</b>\n", "<c id='1'>unterminated")
+			rq.EqualError(err, "incorrect xml structure: the document ends before the tag `c` is closed", attribute)
+
+			err = editError(t, path, attribute, Edit{Operator: domain.EditDelete}, "<a><c id='1'>1</c>\n<c")
+			rq.EqualError(err, "incorrect xml structure: the document ends inside the tag `<c`", attribute)
+
+			err = editError(t, path, attribute, Edit{Operator: domain.EditDelete}, "<a><c id='1'>1</c><b>2</d></a>")
+			rq.EqualError(err, "incorrect xml structure: the last open tag is `b`, but close tag is `d`", attribute)
+		}
+	})
+}
+
+// nolint lll: there are long strings on purpose
+func TestProcessInsert(t *testing.T) {
+	t.Parallel()
+
+	path := []domain.Step{{Name: "a", Index: -1}, {Name: "b", Index: -1}}
+	data := "<a>\n  <b>\n    <c>1</c>\n  </b>\n  <b/>\n  <b>2</b>\n</a>"
+
+	for name, tt := range map[string]struct {
+		edit     Edit
+		expected string
+	}{
+		"append": {
+			edit:     Edit{Operator: domain.EditAppend, Value: "<d/>"},
+			expected: "<a>\n  <b>\n    <c>1</c>\n    <d/>\n  </b>\n  <b><d/></b>\n  <b>2<d/></b>\n</a>",
+		},
+		"before": {
+			edit:     Edit{Operator: domain.EditBefore, Value: "<d/>"},
+			expected: "<a>\n  <d/>\n  <b>\n    <c>1</c>\n  </b>\n  <d/>\n  <b/>\n  <d/>\n  <b>2</b>\n</a>",
+		},
+		"after": {
+			edit:     Edit{Operator: domain.EditAfter, Value: "<d/>"},
+			expected: "<a>\n  <b>\n    <c>1</c>\n  </b>\n  <d/>\n  <b/>\n  <d/>\n  <b>2</b>\n  <d/>\n</a>",
+		},
+		"wrap": {
+			edit:     Edit{Operator: domain.EditWrap, Value: "<w x='>'></w>"},
+			expected: "<a>\n  <w x='>'><b>\n    <c>1</c>\n  </b></w>\n  <w x='>'><b/></w>\n  <w x='>'><b>2</b></w>\n</a>",
+		},
+		"unwrap": {
+			edit:     Edit{Operator: domain.EditUnwrap},
+			expected: "<a>\n  <c>1</c>\n  2\n</a>",
+		},
+	} {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.expected, editDocument(t, path, "", tt.edit, data))
+		})
+	}
+
+	t.Run("child filters", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := editDocument(t, []domain.Step{
+			{Name: "a", Index: -1},
+			{Name: "b", Index: -1, Filters: []domain.Filter{{Child: []string{"c"}, Operator: domain.FilterEqual, Value: "2"}}},
+		}, "", Edit{Operator: domain.EditAppend, Value: "<d/>"},
+			"<a><b><c>1</c></b><b><c>", "2</c></b></a>")
+		rq.Equal("<a><b><c>1</c></b><b><c>2</c><d/></b></a>", res)
+	})
+
+	t.Run("nested candidates", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		nested := []domain.Step{
+			{Name: "c", Index: -1, Descendant: true, Filters: []domain.Filter{{Child: []string{"b"}, Operator: domain.FilterExists}}},
+		}
+		data := "<r>\n  <c>\n    <c>\n      <b>1</b>\n    </c>\n  </c>\n  <c><c><b>2</b></c><b>3</b></c>\n</r>"
+		for _, tt := range []struct {
+			edit     Edit
+			expected string
+		}{
+			{
+				edit:     Edit{Operator: domain.EditAppend, Value: "<d/>"},
+				expected: "<r>\n  <c>\n    <c>\n      <b>1</b>\n      <d/>\n    </c>\n  </c>\n  <c><c><b>2</b></c><b>3</b><d/></c>\n</r>",
+			},
+			{
+				edit:     Edit{Operator: domain.EditWrap, Value: "<w></w>"},
+				expected: "<r>\n  <c>\n    <w><c>\n      <b>1</b>\n    </c></w>\n  </c>\n  <w><c><c><b>2</b></c><b>3</b></c></w>\n</r>",
+			},
+			{
+				edit:     Edit{Operator: domain.EditUpdate, Functions: []domain.Function{{Name: "sub", Args: []string{"1", "X"}}}},
+				expected: "<r>\n  <c>\n    <c>X</c>\n  </c>\n  <c><c><b>2</b></c><b>3</b></c>\n</r>",
+			},
+		} {
+			rq.Equal(tt.expected, editDocument(t, nested, "", tt.edit, data), tt.edit.Operator)
+		}
+	})
+
+	t.Run("truncated document", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for _, e := range []Edit{
+			{Operator: domain.EditAppend, Value: "<d/>"},
+			{Operator: domain.EditBefore, Value: "<d/>"},
+			{Operator: domain.EditAfter, Value: "<d/>"},
+			{Operator: domain.EditWrap, Value: "<w></w>"},
+			{Operator: domain.EditUnwrap},
+		} {
+			err := editError(t, path, "", e, "<a>\n  <b>1</b>\n", "  <b>unterminated")
+			rq.EqualError(err, "incorrect xml structure: the document ends before the tag `b` is closed", e.Operator)
+
+			err = editError(t, path, "", e, "<a>\n  <b>1</b>\n  <b/>")
+			rq.EqualError(err, "incorrect xml structure: the document ends before the tag `a` is closed", e.Operator)
+		}
+	})
+
+	t.Run("invalid wrapper", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p, err := New(path, domain.Attribute{}, domain.TagEdit)
+		rq.NoError(err)
+		for _, wrapper := range []string{"<w>x</w>", "<w></v>", "<w/><v/>", "w", "<w x='/>"} {
+			rq.Error(p.SetEdit(Edit{Operator: domain.EditWrap, Value: wrapper}), wrapper)
+		}
+	})
+}
+
+func TestAttributeSpan(t *testing.T) {
+	t.Parallel()
+	rq := require.New(t)
+
+	tag := []byte(`<a b="1" c = 'x"y' d>`)
+
+	start, end, ok := attributeSpan(tag, "c")
+	rq.True(ok)
+	rq.Equal(`x"y`, string(tag[start:end]))
+
+	_, _, ok = attributeSpan(tag, "d")
+	rq.False(ok)
+
+	_, _, ok = attributeSpan([]byte(`<a/>`), "a")
+	rq.False(ok)
+}
+
+func TestProcessEditErrors(t *testing.T) {
+	t.Parallel()
+
+	path := []domain.Step{{Name: "a", Index: -1}, {Name: "c", Index: -1}}
+	assign := Edit{Operator: domain.EditAssign, Value: "x"}
+
+	t.Run("truncated document", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		err := editError(t, path, "", assign, "<a><b>1</b>", "<c>unterminated")
+		rq.EqualError(err, "incorrect xml structure: the document ends before the tag `c` is closed")
+
+		err = editError(t, path, "", assign, "<a><b>1</b><c>2</c>")
+		rq.EqualError(err, "incorrect xml structure: the document ends before the tag `a` is closed")
+
+		err = editError(t, path, "id", assign, "<a><b>1</b><c id='1'")
+		rq.EqualError(err, "incorrect xml structure: the document ends inside the tag `<c id='1'`")
+	})
+
+	t.Run("truncated document isn't modified only", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for _, data := range []string{"<a><c>1</c><c>unterminated", "<a><c>1</c><c id='1'"} {
+			p, err := New(path, domain.Attribute{}, domain.TagText)
+			rq.NoError(err)
+			rq.NoError(p.process([]byte(data)))
+			rq.NoError(p.finish(), data)
+			rq.Equal([]string{"1"}, p.printList, data)
+		}
+	})
+
+	t.Run("truncated after the index target", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		err := editError(t, []domain.Step{{Name: "a", Index: -1}, {Name: "c", Index: 0}}, "", assign,
+			"<a><c>1</c>", "<c>2</c>")
+		rq.EqualError(err, "incorrect xml structure: the document ends before the tag `a` is closed")
+	})
+
+	t.Run("malformed document", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		err := editError(t, path, "", assign, "<a><b>1</b><c>2</d></a>")
+		rq.EqualError(err, "incorrect xml structure: the last open tag is `c`, but close tag is `d`")
+	})
+}
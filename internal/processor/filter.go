@@ -0,0 +1,544 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/tty2/xq/internal/domain"
+	"github.com/tty2/xq/internal/transform"
+	"github.com/tty2/xq/pkg/slice"
+)
+
+type (
+	// candidate is a tag of the current path whose filters can't be checked until its child tags are read.
+	candidate struct {
+		depth      int          // length of the current path with the tag
+		passed     []bool       // the same row as the tag has in `currentFilters`
+		pending    []bool       // the same row as the tag has in `currentPending`
+		conditions []*condition // conditions of the steps which aren't resolved yet
+		checks     []*childCheck
+		// steps with slices the tag gets position for when their child filters are satisfied
+		unplaced []int
+		parent   *children
+	}
+
+	// childCheck is a child filter of a candidate step.
+	childCheck struct {
+		owner     *candidate
+		step      int
+		filter    domain.Filter
+		satisfied bool
+	}
+
+	// capture keeps text of a child tag in order to check filters of candidates.
+	capture struct {
+		depth  int
+		text   []byte
+		checks []*childCheck
+	}
+
+	// output is a result waiting for child filters of its path to be checked.
+	output struct {
+		value    string
+		fallback string // printed instead of the value if its path doesn't match the query
+		unique   bool   // skip the value if it's already printed
+		offset   int
+		state    *pathState
+		match    matchFunc
+		waiting  bool // the value isn't known until the tag is closed
+	}
+
+	// pathState is a copy of the current path with the flags of its tags. The values found until the path
+	// is changed share it.
+	pathState struct {
+		path    []string
+		passed  [][]bool
+		pending [][]bool
+	}
+
+	// matchFunc checks if a path matches the query.
+	matchFunc func(path []string, passes [][]bool) bool
+)
+
+func compileFilters(path []domain.Step) (map[string]*regexp.Regexp, error) {
+	regexps := map[string]*regexp.Regexp{}
+	for i := range path {
+		for _, f := range stepFilters(path[i]) {
+			if f.Operator != domain.FilterMatch {
+				continue
+			}
+			if _, ok := regexps[f.Value]; ok {
+				continue
+			}
+
+			re, err := regexp.Compile(f.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression in filter of `%s`: %w", path[i].Name, err)
+			}
+			regexps[f.Value] = re
+		}
+	}
+
+	return regexps, nil
+}
+
+// compileFunctions compiles string functions of the filters. Functions are kept by the key made of the calls.
+func compileFunctions(path []domain.Step) (map[string]transform.Chain, error) {
+	chains := map[string]transform.Chain{}
+	for i := range path {
+		for _, f := range stepFilters(path[i]) {
+			if len(f.Functions) == 0 {
+				continue
+			}
+			key := functionsKey(f.Functions)
+			if _, ok := chains[key]; ok {
+				continue
+			}
+
+			chain, err := transform.Compile(f.Functions)
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter of `%s`: %w", path[i].Name, err)
+			}
+			chains[key] = chain
+		}
+	}
+
+	return chains, nil
+}
+
+// stepFilters returns filters of the step including the ones of its condition.
+func stepFilters(step domain.Step) []domain.Filter {
+	if step.Condition == nil {
+		return step.Filters
+	}
+
+	return append(append([]domain.Filter{}, step.Filters...), step.Condition.Filters()...)
+}
+
+func functionsKey(functions []domain.Function) string {
+	calls := make([]string, len(functions))
+	for i := range functions {
+		calls[i] = functions[i].String()
+	}
+
+	return strings.Join(calls, " | ")
+}
+
+func validateFilters(path []domain.Step) error {
+	var child, index bool
+	for i := range path {
+		if path[i].Index > -1 {
+			index = true
+		}
+		if waitsForChildren(path[i]) {
+			child = true
+		}
+	}
+
+	if child && index {
+		return errors.New("index can't be used together with child filters")
+	}
+	if index && hasSlices(path) {
+		return errors.New("index can't be used together with slices")
+	}
+	for i := range path {
+		if path[i].Condition != nil && hasChildFilters(path[i].Filters) && path[i].Slice != nil {
+			return fmt.Errorf("select can't be applied to `%s` with both child filters and position", path[i].Name)
+		}
+	}
+
+	return nil
+}
+
+// openFilters puts results of steps filters for the current tag to the current path.
+// Filters with attributes and namespaces of the steps are checked at once, but the ones with child tags wait
+// for the children.
+func (p *Processor) openFilters() {
+	if hasNamespaces(p.query.path) || hasNamespaces(p.query.anchor) || p.query.namespace != "" {
+		p.openNamespaces()
+	}
+	passed, pending := p.passedFilters()
+	var c *candidate
+	if pending != nil {
+		c = p.addCandidate(passed, pending)
+	}
+	p.addToCaptures() // text of current tag is captured for its own candidate as well
+
+	passed, pending = p.openAxis(passed, pending)
+	passed, pending = p.checkPositions(passed, pending)
+	if c != nil { // conditions are resolved after positions, select is applied to the tags with positions
+		p.resolveKnown(c)
+	}
+	p.currentFilters = append(p.currentFilters, passed)
+	p.currentPending = append(p.currentPending, pending)
+	p.state = nil
+	p.changeMatches(len(p.currentFilters) - 1)
+}
+
+// addCandidate adds current tag to the candidates waiting for the children.
+func (p *Processor) addCandidate(passed, pending []bool) *candidate {
+	c := &candidate{
+		depth:      len(p.currentPath),
+		passed:     passed,
+		pending:    pending,
+		conditions: make([]*condition, len(p.query.path)),
+	}
+	for i := range pending {
+		if pending[i] {
+			c.conditions[i] = p.newCondition(stepCondition(p.query.path[i]), c, i)
+		}
+	}
+	p.candidates = append(p.candidates, c)
+
+	return c
+}
+
+// passedFilters returns flags of the query steps whose filters and namespace current tag satisfies and flags of
+// the steps whose child filters aren't checked yet. Returns nil if there are no such steps in the query.
+func (p *Processor) passedFilters() ([]bool, []bool) {
+	var passed, pending []bool
+	for i := range p.query.path {
+		if len(p.query.path[i].Filters) == 0 && p.query.path[i].Namespace == "" && p.query.path[i].Condition == nil {
+			continue
+		}
+		if passed == nil {
+			passed = make([]bool, len(p.query.path))
+			for j := range passed {
+				passed[j] = true
+			}
+		}
+		passed[i] = p.inNamespace(p.query.path[i]) && p.checkFilters(p.query.path[i].Filters, p.currentTag.bytes)
+		if !passed[i] || !waitsForChildren(p.query.path[i]) {
+			continue
+		}
+		if !p.query.path[i].MatchName(p.currentTag.name) {
+			passed[i] = false
+
+			continue
+		}
+		if pending == nil {
+			pending = make([]bool, len(p.query.path))
+		}
+		pending[i] = true
+	}
+
+	return passed, pending
+}
+
+func hasChildFilters(filters []domain.Filter) bool {
+	for i := range filters {
+		if filters[i].IsChild() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addToCaptures starts to keep text of current tag if it's a child some candidates are waiting for.
+func (p *Processor) addToCaptures() {
+	var cp *capture
+	for _, c := range p.candidates {
+		for _, ch := range c.checks {
+			if ch.satisfied || c.conditions[ch.step] == nil || !childPathMatch(ch.filter.Child, p.currentPath[c.depth:]) {
+				continue
+			}
+			if ch.filter.Operator == domain.FilterExists && len(ch.filter.Functions) == 0 && ch.filter.Attribute == "" {
+				p.satisfy(ch)
+
+				continue
+			}
+			if ch.filter.Attribute != "" { // attribute of the child is known at once
+				if p.checkFilter(ch.filter, p.currentTag.bytes) {
+					p.satisfy(ch)
+				}
+
+				continue
+			}
+			if cp == nil {
+				cp = &capture{
+					depth: len(p.currentPath),
+				}
+			}
+			cp.checks = append(cp.checks, ch)
+		}
+	}
+
+	if cp != nil {
+		p.captures = append(p.captures, cp)
+	}
+}
+
+func childPathMatch(child, path []string) bool {
+	if len(child) != len(path) {
+		return false
+	}
+
+	for i := range child {
+		if child[i] != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *Processor) captureText(s ...byte) {
+	for i := range p.captures {
+		p.captures[i].text = append(p.captures[i].text, s...)
+	}
+}
+
+// closeFilters checks child filters when the last tag of the current path is closed and prints its text
+// if it's selected.
+func (p *Processor) closeFilters() {
+	depth := len(p.currentPath)
+
+	if ln := len(p.captures); ln > 0 && p.captures[ln-1].depth == depth {
+		cp := p.captures[ln-1]
+		p.captures = p.captures[:ln-1]
+		value := normalizeText(cp.text)
+		for _, ch := range cp.checks {
+			if !ch.satisfied && p.compare(ch.filter, value) {
+				p.satisfy(ch)
+			}
+		}
+	}
+
+	if ln := len(p.candidates); ln > 0 && p.candidates[ln-1].depth == depth {
+		c := p.candidates[ln-1]
+		p.candidates = p.candidates[:ln-1]
+		for i, cond := range c.conditions {
+			if cond == nil {
+				continue
+			}
+			value, _ := cond.evaluate(true) // children satisfying the rest of filters weren't found
+			p.resolve(c, i, value)
+		}
+	}
+
+	p.closeText(depth)
+	p.closeRaw(depth)
+	if p.edit != nil {
+		p.closeEdit(depth)
+	}
+	p.closePath(depth)
+	p.closePositions(depth)
+	p.closeAxis(depth)
+	p.closeNamespaces()
+	p.flushQueue()
+}
+
+// satisfy marks child filter as satisfied and resolves the step if its condition is known then.
+func (p *Processor) satisfy(ch *childCheck) {
+	ch.satisfied = true
+
+	c := ch.owner
+	cond := c.conditions[ch.step]
+	if cond == nil { // the step is already resolved
+		return
+	}
+	value, ok := cond.evaluate(false)
+	if !ok {
+		return
+	}
+	p.resolve(c, ch.step, value)
+
+	p.flushQueue()
+}
+
+func (p *Processor) checkFilters(filters []domain.Filter, tag []byte) bool {
+	for _, f := range filters {
+		if f.IsChild() {
+			continue
+		}
+		if !p.checkFilter(f, tag) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *Processor) checkFilter(f domain.Filter, tag []byte) bool {
+	name, ok := p.attributeName(f.Attribute, f.Namespace, tag)
+	if !ok {
+		return false
+	}
+	av, err := pickAttributeValue(name, tag)
+	if err != nil {
+		return false // attribute isn't found
+	}
+
+	return p.compare(f, av)
+}
+
+// compare checks the value by filter. If the filter has string functions, it's enough one of their results
+// satisfies the filter, filter without operator is satisfied then by any result except `false`.
+func (p *Processor) compare(f domain.Filter, value string) bool {
+	if len(f.Functions) == 0 {
+		return p.compareValue(f, value)
+	}
+
+	for _, v := range p.query.functions[functionsKey(f.Functions)].Apply(value) {
+		if f.Operator == domain.FilterExists && v == "false" {
+			continue
+		}
+		if p.compareValue(f, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Processor) compareValue(f domain.Filter, value string) bool {
+	switch f.Operator {
+	case domain.FilterExists:
+		return true
+	case domain.FilterEqual:
+		return domain.CompareValues(value, f.Value) == 0
+	case domain.FilterNotEqual:
+		return domain.CompareValues(value, f.Value) != 0
+	case domain.FilterMatch:
+		re, ok := p.query.regexps[f.Value]
+		if !ok {
+			return false
+		}
+
+		return re.MatchString(value)
+	case domain.FilterLess:
+		return domain.CompareValues(value, f.Value) < 0
+	case domain.FilterLessOrEqual:
+		return domain.CompareValues(value, f.Value) <= 0
+	case domain.FilterGreater:
+		return domain.CompareValues(value, f.Value) > 0
+	case domain.FilterGreaterOrEqual:
+		return domain.CompareValues(value, f.Value) >= 0
+	}
+
+	return false
+}
+
+// print adds value to print list if its path matches the query. If it isn't known yet because of
+// child filters, the value waits in the queue.
+func (p *Processor) print(value string, unique bool, match matchFunc) {
+	p.printOr(value, "", unique, match)
+}
+
+// printOr prints value as `print` does, but the fallback is printed instead of the value if its path turns out
+// not to match the query.
+func (p *Processor) printOr(value, fallback string, unique bool, match matchFunc) {
+	p.enqueue(output{
+		value:    value,
+		fallback: fallback,
+		unique:   unique,
+		offset:   p.offset,
+		match:    match,
+	})
+}
+
+// enqueue adds the output found on current path to print list or to the queue if the path waits for child filters.
+// The output without state matches the query, it waits for the previous outputs only.
+func (p *Processor) enqueue(o output) {
+	if len(p.candidates) == 0 && len(p.children) == 0 && len(p.axes) == 0 {
+		if len(p.queue) == 0 {
+			p.addToPrintList(o.value, o.unique, o.offset)
+
+			return
+		}
+		p.queue = append(p.queue, o)
+		p.flushQueue()
+
+		return
+	}
+
+	if p.state == nil {
+		p.state = &pathState{
+			path:    append([]string{}, p.currentPath...),
+			passed:  append([][]bool{}, p.currentFilters...),
+			pending: append([][]bool{}, p.currentPending...),
+		}
+	}
+	o.state = p.state
+	p.queue = append(p.queue, o)
+	p.flushQueue()
+}
+
+// flushQueue moves values from the queue to print list keeping their order until the first value
+// which path still waits for child filters.
+func (p *Processor) flushQueue() {
+	var i int
+	for ; i < len(p.queue); i++ {
+		o := p.queue[i]
+		if o.waiting {
+			break
+		}
+		if o.state == nil || o.match(o.state.path, checkedFilters(o.state.passed, o.state.pending)) {
+			p.addToPrintList(o.value, o.unique, o.offset)
+
+			continue
+		}
+		if o.match(o.state.path, o.state.passed) { // still can match
+			break
+		}
+		if o.fallback != "" {
+			p.addToPrintList(o.fallback, false, o.offset)
+		}
+	}
+
+	p.queue = p.queue[i:]
+}
+
+func (p *Processor) addToPrintList(value string, unique bool, offset int) {
+	if p.query.searchType == domain.TagCount { // offsets are kept to count tags matched by several paths once
+		p.count++
+		p.printOffsets = append(p.printOffsets, offset)
+
+		return
+	}
+	if unique && slice.ContainsString(p.printList, value) {
+		return
+	}
+
+	p.printList = append(p.printList, value)
+	p.printOffsets = append(p.printOffsets, offset)
+}
+
+// settled returns the offset all the values found before are already in print list.
+func (p *Processor) settled() int {
+	if p.stop {
+		return math.MaxInt
+	}
+	settled := p.offset + 1
+	if len(p.queue) > 0 {
+		settled = p.queue[0].offset
+	}
+	if len(p.texts) > 0 && p.texts[0].offset < settled { // texts are printed at offsets of their open tags
+		settled = p.texts[0].offset
+	}
+
+	return settled
+}
+
+// checkedFilters returns flags of the steps filters which are passed and not pending.
+func checkedFilters(passed, pending [][]bool) [][]bool {
+	rows := make([][]bool, len(passed))
+	for i := range passed {
+		if i >= len(pending) || pending[i] == nil {
+			rows[i] = passed[i]
+
+			continue
+		}
+
+		rows[i] = make([]bool, len(passed[i]))
+		for j := range passed[i] {
+			rows[i][j] = passed[i][j] && !pending[i][j]
+		}
+	}
+
+	return rows
+}
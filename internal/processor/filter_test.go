@@ -0,0 +1,516 @@
+package processor
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tty2/xq/internal/domain"
+)
+
+func TestCompileFilters(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res, err := compileFilters([]domain.Step{
+			{
+				Name:  "tag",
+				Index: -1,
+				Filters: []domain.Filter{
+					{Attribute: "attr", Operator: domain.FilterMatch, Value: "^a"},
+					{Attribute: "attr", Operator: domain.FilterEqual, Value: "("},
+				},
+			},
+		})
+		rq.NoError(err)
+		rq.Len(res, 1)
+		rq.Contains(res, "^a")
+	})
+
+	t.Run("err: invalid regexp", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		_, err := compileFilters([]domain.Step{
+			{
+				Name:  "tag",
+				Index: -1,
+				Filters: []domain.Filter{
+					{Attribute: "attr", Operator: domain.FilterMatch, Value: "("},
+				},
+			},
+		})
+		rq.Error(err)
+	})
+}
+
+func TestCheckFilter(t *testing.T) {
+	t.Parallel()
+
+	p := Processor{
+		query: query{
+			regexps: map[string]*regexp.Regexp{
+				"^val": regexp.MustCompile("^val"),
+			},
+		},
+	}
+	tag := []byte(`<tagname attr1="value1" attr2="">`)
+
+	t.Run("exists", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.True(p.checkFilter(domain.Filter{Attribute: "attr1", Operator: domain.FilterExists}, tag))
+		rq.True(p.checkFilter(domain.Filter{Attribute: "attr2", Operator: domain.FilterExists}, tag))
+		rq.False(p.checkFilter(domain.Filter{Attribute: "attr3", Operator: domain.FilterExists}, tag))
+	})
+
+	t.Run("equal", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.True(p.checkFilter(domain.Filter{Attribute: "attr1", Operator: domain.FilterEqual, Value: "value1"}, tag))
+		rq.False(p.checkFilter(domain.Filter{Attribute: "attr1", Operator: domain.FilterEqual, Value: "value"}, tag))
+		rq.True(p.checkFilter(domain.Filter{Attribute: "attr2", Operator: domain.FilterEqual, Value: ""}, tag))
+	})
+
+	t.Run("not equal", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.False(p.checkFilter(domain.Filter{Attribute: "attr1", Operator: domain.FilterNotEqual, Value: "value1"}, tag))
+		rq.True(p.checkFilter(domain.Filter{Attribute: "attr1", Operator: domain.FilterNotEqual, Value: "value"}, tag))
+		rq.False(p.checkFilter(domain.Filter{Attribute: "attr3", Operator: domain.FilterNotEqual, Value: "value"}, tag))
+	})
+
+	t.Run("match", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.True(p.checkFilter(domain.Filter{Attribute: "attr1", Operator: domain.FilterMatch, Value: "^val"}, tag))
+		rq.False(p.checkFilter(domain.Filter{Attribute: "attr2", Operator: domain.FilterMatch, Value: "^val"}, tag))
+	})
+}
+
+func TestPassedFilters(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil: no filters", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{Name: "tag", Index: -1},
+				},
+			},
+			currentTag: tag{
+				bytes: []byte(`<tag>`),
+			},
+		}
+
+		passed, pending := p.passedFilters()
+		rq.Nil(passed)
+		rq.Nil(pending)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{Name: "tag", Index: -1},
+					{Name: "tag", Index: -1, Filters: []domain.Filter{{Attribute: "attr", Operator: domain.FilterExists}}},
+					{Name: "tag", Index: -1, Filters: []domain.Filter{{Attribute: "id", Operator: domain.FilterExists}}},
+				},
+			},
+			currentTag: tag{
+				bytes: []byte(`<tag attr="value">`),
+			},
+		}
+
+		passed, pending := p.passedFilters()
+		rq.Equal([]bool{true, true, false}, passed)
+		rq.Nil(pending)
+	})
+
+	t.Run("child filters", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{Name: "tag", Index: -1, Filters: []domain.Filter{{Child: []string{"child"}, Operator: domain.FilterExists}}},
+					{Name: "other", Index: -1, Filters: []domain.Filter{{Child: []string{"child"}, Operator: domain.FilterExists}}},
+					{Name: "tag", Index: -1, Filters: []domain.Filter{
+						{Attribute: "id", Operator: domain.FilterExists},
+						{Child: []string{"child"}, Operator: domain.FilterExists},
+					}},
+				},
+			},
+			currentTag: tag{
+				bytes: []byte(`<tag attr="value">`),
+				name:  "tag",
+			},
+		}
+
+		passed, pending := p.passedFilters()
+		rq.Equal([]bool{true, false, false}, passed)
+		rq.Equal([]bool{true, false, false}, pending)
+	})
+}
+
+// nolint lll: there are long strings on purpose
+func TestProcessWithFilters(t *testing.T) {
+	t.Parallel()
+
+	t.Run("tag value", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:  "objects",
+						Index: -1,
+					},
+					{
+						Name:    "object",
+						Index:   -1,
+						Filters: []domain.Filter{{Attribute: "lang", Operator: domain.FilterEqual, Value: "EN"}},
+					},
+				},
+				searchType: domain.TagValue,
+			},
+		}
+
+		err := p.process([]byte(`<objects><object lang="RU"><tg>1</tg></object><object lang="EN"><tg>2</tg></object></objects>`))
+		rq.NoError(err)
+		rq.Len(p.printList, 5)
+		rq.Equal(string(domain.ColorizeTag([]byte(`<object lang="EN">`))), p.printList[0])
+		rq.Equal(string(append([]byte("  "), domain.ColorizeTag([]byte("<tg>"))...)), p.printList[1])
+		rq.Equal("    2", p.printList[2])
+	})
+
+	t.Run("attr value on parent filter", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:    "object",
+						Index:   -1,
+						Filters: []domain.Filter{{Attribute: "lang", Operator: domain.FilterNotEqual, Value: "EN"}},
+					},
+					{
+						Name:  "tg",
+						Index: -1,
+					},
+				},
+				searchType: domain.AttrValue,
+				attribute:  "id",
+			},
+		}
+
+		err := p.process([]byte(`<object lang="RU"><tg id="1" /></object><object lang="EN"><tg id="2" /></object><object><tg id="3" /></object>`))
+		rq.NoError(err)
+		rq.Len(p.printList, 1)
+		rq.Equal("1", p.printList[0])
+	})
+
+	t.Run("index among filtered tags", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:    "tg",
+						Index:   1,
+						Filters: []domain.Filter{{Attribute: "id", Operator: domain.FilterExists}},
+					},
+				},
+				searchType: domain.AttrValue,
+				attribute:  "id",
+			},
+			index: index{
+				set: true,
+			},
+		}
+
+		err := p.process([]byte(`<tg id="1" /><tg /><tg id="2" /><tg id="3" />`))
+		rq.NoError(err)
+		rq.Len(p.printList, 1)
+		rq.Equal("2", p.printList[0])
+	})
+}
+
+func TestValidateFilters(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		err := validateFilters([]domain.Step{
+			{Name: "tag", Index: 1, Filters: []domain.Filter{{Attribute: "attr", Operator: domain.FilterExists}}},
+		})
+		rq.NoError(err)
+	})
+
+	t.Run("err: index with slice", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		err := validateFilters([]domain.Step{
+			{Name: "tag", Index: 1},
+			{Name: "child", Index: -1, Slice: &domain.Slice{Start: -1, Step: 1}},
+		})
+		rq.Error(err)
+	})
+
+	t.Run("err: index with child filter", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		err := validateFilters([]domain.Step{
+			{Name: "tag", Index: -1, Filters: []domain.Filter{{Child: []string{"child"}, Operator: domain.FilterExists}}},
+			{Name: "child", Index: 0},
+		})
+		rq.Error(err)
+	})
+}
+
+// nolint lll: there are long strings on purpose
+func TestProcessWithChildFilters(t *testing.T) {
+	t.Parallel()
+
+	t.Run("tag value", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:  "objects",
+						Index: -1,
+					},
+					{
+						Name:    "object",
+						Index:   -1,
+						Filters: []domain.Filter{{Child: []string{"key"}, Operator: domain.FilterEqual, Value: "2"}},
+					},
+				},
+				searchType: domain.TagValue,
+			},
+		}
+
+		err := p.process([]byte(`<objects><object><tg>1</tg><key>1</key></object><object><tg>2</tg><key> 2 </key></object></objects>`))
+		rq.NoError(err)
+		rq.Len(p.printList, 8)
+		rq.Equal(string(domain.ColorizeTag([]byte(`<object>`))), p.printList[0])
+		rq.Equal(string(append([]byte("  "), domain.ColorizeTag([]byte("<tg>"))...)), p.printList[1])
+		rq.Equal("    2", p.printList[2])
+		rq.Equal(string(domain.ColorizeTag([]byte(`</object>`))), p.printList[7])
+		rq.Empty(p.queue)
+	})
+
+	t.Run("deep child with number", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:  "items",
+						Index: -1,
+					},
+					{
+						Name:    "item",
+						Index:   -1,
+						Filters: []domain.Filter{{Child: []string{"info", "price"}, Operator: domain.FilterGreater, Value: "10"}},
+					},
+				},
+				searchType: domain.AttrValue,
+				attribute:  "id",
+			},
+		}
+
+		err := p.process([]byte(`<items><item id="1"><info><price>9.5</price></info></item><item id="2"><price>20</price></item><item id="3"><info><price>10.5</price><price>1</price></info></item></items>`))
+		rq.NoError(err)
+		rq.Len(p.printList, 1)
+		rq.Equal("3", p.printList[0])
+	})
+
+	t.Run("child exists", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:       "item",
+						Index:      -1,
+						Descendant: true,
+						Filters:    []domain.Filter{{Child: []string{"image"}, Operator: domain.FilterExists}},
+					},
+				},
+				searchType: domain.TagList,
+			},
+		}
+
+		err := p.process([]byte(`<items><item><name /></item><item><title /><image /></item><item><image /></item></items>`))
+		rq.NoError(err)
+		rq.Equal([]string{"title", "image"}, p.printList)
+	})
+
+	t.Run("nested candidates", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:       "a",
+						Index:      -1,
+						Descendant: true,
+						Filters:    []domain.Filter{{Child: []string{"key"}, Operator: domain.FilterEqual, Value: "yes"}},
+					},
+				},
+				searchType: domain.AttrValue,
+				attribute:  "id",
+			},
+		}
+
+		err := p.process([]byte(`<a id="1"><a id="2"><key>yes</key></a><key>no</key></a><a id="3"><a id="4"><key>no</key></a><key>yes</key></a>`))
+		rq.NoError(err)
+		rq.Equal([]string{"2", "3"}, p.printList)
+	})
+
+	t.Run("normalized text", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tt := range []struct {
+			value    string
+			data     string
+			expected []string
+		}{
+			{value: "12", data: `<a id="1"><b><c>1</c><c>2</c></b></a><a id="2"><b>12</b></a>`, expected: []string{"2"}},
+			{value: "1 2", data: `<a id="1"><b><c>1</c><c>2</c></b></a>`, expected: []string{"1"}},
+			{value: "AB", data: `<a id="1"><b>A<br/>B</b></a><a id="2"><b>AB</b></a>`, expected: []string{"2"}},
+			{value: "2", data: `<a id="1"><b><x>0</x>2</b></a><a id="2"><b>  2 </b></a>`, expected: []string{"2"}},
+			{value: "A & B", data: `<a id="1"><b>A &amp; B</b></a><a id="2"><b> A
+	&amp;  B</b></a>`, expected: []string{"1", "2"}},
+			{value: "x &amp; y", data: `<a id="1"><b><![CDATA[x &amp; y]]></b></a><a id="2"><b>x &amp; y</b></a>`, expected: []string{"1"}},
+		} {
+			p := Processor{
+				query: query{
+					path: []domain.Step{
+						{
+							Name:       "a",
+							Index:      -1,
+							Descendant: true,
+							Filters:    []domain.Filter{{Child: []string{"b"}, Operator: domain.FilterEqual, Value: tt.value}},
+						},
+					},
+					searchType: domain.AttrValue,
+					attribute:  "id",
+				},
+			}
+
+			require.NoError(t, p.process([]byte("<r>"+tt.data+"</r>")), tt.value)
+			require.Equal(t, tt.expected, p.printList, tt.value)
+		}
+	})
+}
+
+// nolint lll: there are long strings on purpose
+func TestProcessWithFilterFunctions(t *testing.T) {
+	t.Parallel()
+
+	process := func(t *testing.T, filter domain.Filter, data string) []string {
+		t.Helper()
+
+		p, err := New([]domain.Step{
+			{
+				Name:       "item",
+				Index:      -1,
+				Descendant: true,
+				Filters:    []domain.Filter{filter},
+			},
+		}, domain.Attribute{Name: "id"}, domain.AttrValue)
+		require.NoError(t, err)
+
+		err = p.process([]byte(data))
+		require.NoError(t, err)
+		require.Empty(t, p.queue)
+
+		return p.printList
+	}
+
+	t.Run("attribute", func(t *testing.T) {
+		t.Parallel()
+
+		res := process(t, domain.Filter{
+			Attribute: "id",
+			Operator:  domain.FilterEqual,
+			Value:     "a-1",
+			Functions: []domain.Function{{Name: "ascii_downcase"}},
+		}, `<items><item id="A-1" /><item id="B-1" /><item id="a-1" /></items>`)
+		require.Equal(t, []string{"A-1", "a-1"}, res)
+	})
+
+	t.Run("child", func(t *testing.T) {
+		t.Parallel()
+
+		res := process(t, domain.Filter{
+			Child:     []string{"tags"},
+			Operator:  domain.FilterEqual,
+			Value:     "sale",
+			Functions: []domain.Function{{Name: "split", Args: []string{","}}, {Name: "trim"}},
+		}, `<items><item id="1"><tags>new, sale</tags></item><item id="2"><tags>wholesale</tags></item></items>`)
+		require.Equal(t, []string{"1"}, res)
+	})
+
+	t.Run("test", func(t *testing.T) {
+		t.Parallel()
+
+		res := process(t, domain.Filter{
+			Child:     []string{"name"},
+			Operator:  domain.FilterExists,
+			Functions: []domain.Function{{Name: "test", Args: []string{"^baby", "i"}}},
+		}, `<items><item id="1"><name>Lawnmower</name></item><item id="2"><name>Baby Monitor</name></item><item id="3" /></items>`)
+		require.Equal(t, []string{"2"}, res)
+	})
+
+	t.Run("invalid function", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := New([]domain.Step{
+			{
+				Name:  "item",
+				Index: -1,
+				Filters: []domain.Filter{{
+					Attribute: "id",
+					Functions: []domain.Function{{Name: "test", Args: []string{"("}}},
+				}},
+			},
+		}, domain.Attribute{}, domain.TagValue)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,111 @@
+package processor
+
+import (
+	"strings"
+
+	"github.com/tty2/xq/internal/domain"
+)
+
+const (
+	xmlnsAttribute = "xmlns"
+	xmlPrefix      = "xml"
+	xmlNamespace   = "http://www.w3.org/XML/1998/namespace"
+)
+
+// hasNamespaces checks if the steps or the attributes of their filters are matched by namespace.
+func hasNamespaces(path []domain.Step) bool {
+	for i := range path {
+		if path[i].Namespace != "" {
+			return true
+		}
+		filters := path[i].Filters
+		if path[i].Condition != nil {
+			filters = append(append([]domain.Filter{}, filters...), path[i].Condition.Filters()...)
+		}
+		for _, f := range filters {
+			if f.Namespace != "" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// openNamespaces keeps namespaces declared by current tag: `xmlns="uri"` and `xmlns:prefix="uri"`.
+// The default namespace is kept with empty prefix.
+func (p *Processor) openNamespaces() {
+	var scope map[string]string
+	for _, name := range pickAttributesNames(p.currentTag.bytes) {
+		name = strings.TrimSpace(name)
+		var prefix string
+		switch {
+		case name == xmlnsAttribute:
+		case strings.HasPrefix(name, xmlnsAttribute+":"):
+			prefix = name[len(xmlnsAttribute)+1:]
+		default:
+			continue
+		}
+
+		uri, err := pickAttributeValue(name, p.currentTag.bytes)
+		if err != nil {
+			continue
+		}
+		if scope == nil {
+			scope = map[string]string{}
+		}
+		scope[prefix] = uri
+	}
+
+	p.namespaces = append(p.namespaces, scope)
+}
+
+func (p *Processor) closeNamespaces() {
+	if len(p.namespaces) > 0 {
+		p.namespaces = p.namespaces[:len(p.namespaces)-1]
+	}
+}
+
+// namespace returns URI of the namespace current tag belongs to or empty string if it has no namespace.
+func (p *Processor) namespace() string {
+	return p.namespaceURI(domain.Prefix(p.currentTag.name))
+}
+
+// namespaceURI returns URI the prefix is bound to by the tags of current path or empty string if it isn't bound.
+func (p *Processor) namespaceURI(prefix string) string {
+	for i := len(p.namespaces) - 1; i >= 0; i-- {
+		if uri, ok := p.namespaces[i][prefix]; ok {
+			return uri
+		}
+	}
+
+	if prefix == xmlPrefix {
+		return xmlNamespace
+	}
+
+	return ""
+}
+
+// attributeName returns name of the attribute as it's written in the tag. Attribute with namespace is found by
+// its local name and URI of its prefix whatever prefix the document uses, attributes without prefix don't belong
+// to any namespace.
+func (p *Processor) attributeName(name, namespace string, tag []byte) (string, bool) {
+	if namespace == "" {
+		return name, true
+	}
+
+	for _, n := range pickAttributesNames(tag) {
+		n = strings.TrimSpace(n)
+		prefix := domain.Prefix(n)
+		if prefix != "" && prefix != xmlnsAttribute && domain.LocalName(n) == name && p.namespaceURI(prefix) == namespace {
+			return n, true
+		}
+	}
+
+	return "", false
+}
+
+// inNamespace checks if current tag belongs to the namespace of the step if it's set.
+func (p *Processor) inNamespace(step domain.Step) bool {
+	return step.Namespace == "" || step.Namespace == p.namespace()
+}
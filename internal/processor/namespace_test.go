@@ -0,0 +1,107 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tty2/xq/internal/domain"
+)
+
+// nolint lll: there are long strings on purpose
+func TestProcessWithNamespaces(t *testing.T) {
+	t.Parallel()
+
+	t.Run("different prefixes", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{Name: "Envelope", Index: -1, Namespace: "urn:soap"},
+					{Name: "Body", Index: -1, Namespace: "urn:soap"},
+					{Name: "Item", Index: -1, Descendant: true, Namespace: "urn:prices"},
+				},
+				searchType: domain.AttrValue,
+				attribute:  "id",
+			},
+		}
+
+		err := p.process([]byte(`<s:Envelope xmlns:s="urn:soap"><s:Body><m:Item xmlns:m="urn:prices" id="1" /><Item id="2" /></s:Body></s:Envelope><env:Envelope xmlns:env="urn:soap"><env:Body xmlns="urn:prices"><Item id="3" /></env:Body></env:Envelope>`))
+		rq.NoError(err)
+		rq.Equal([]string{"1", "3"}, p.printList)
+		rq.Empty(p.namespaces)
+	})
+
+	t.Run("default namespace and scope", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{Name: domain.Wildcard, Index: -1, Descendant: true, Namespace: "urn:a"},
+				},
+				searchType: domain.TagList,
+			},
+		}
+
+		err := p.process([]byte(`<root xmlns="urn:a"><in><x /></in><out xmlns=""><y /></out></root><z />`))
+		rq.NoError(err)
+		rq.Equal([]string{"in", "x", "out"}, p.printList)
+	})
+
+	t.Run("xml prefix", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{Name: "space", Index: -1, Descendant: true, Namespace: "http://www.w3.org/XML/1998/namespace"},
+				},
+				searchType: domain.AttrList,
+			},
+		}
+
+		err := p.process([]byte(`<root><xml:space a="1" /></root>`))
+		rq.NoError(err)
+		rq.Equal([]string{"a"}, p.printList)
+	})
+
+	t.Run("attributes with different prefixes", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		doc := []byte(`<root xmlns:xl="urn:link" xmlns:o="urn:other"><a id="a" xl:href="1" o:href="x" /><a id="b" xmlns:link="urn:link" link:href="2" /><a id="c" href="3" /><a id="d" xmlns:xl="urn:other" xl:href="4" /></root>`)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{Name: "a", Index: -1, Descendant: true},
+				},
+				searchType: domain.AttrValue,
+				attribute:  "href",
+				namespace:  "urn:link",
+			},
+		}
+		err := p.process(doc)
+		rq.NoError(err)
+		rq.Equal([]string{"1", "2"}, p.printList)
+
+		p = Processor{
+			query: query{
+				path: []domain.Step{
+					{Name: "a", Index: -1, Descendant: true, Filters: []domain.Filter{
+						{Attribute: "href", Namespace: "urn:other"},
+					}},
+				},
+				searchType: domain.AttrValue,
+				attribute:  "id",
+			},
+		}
+		err = p.process(doc)
+		rq.NoError(err)
+		rq.Equal([]string{"a", "d"}, p.printList)
+	})
+}
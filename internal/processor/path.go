@@ -0,0 +1,181 @@
+package processor
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tty2/xq/internal/domain"
+)
+
+type (
+	// PathOptions sets how paths of the tags are printed.
+	PathOptions struct {
+		Prefix     bool // values are printed after their paths separated by tab: `.a[0].b[1]#id	42`
+		Attributes bool // `TagPath` search prints paths of attributes after the path of the tag: `.a[0]#id`
+		Values     bool // `TagPath` search prints values of attributes and text of the tags without nested tags
+	}
+
+	// paths keeps positions of the tags of current path among the tags with the same name inside their parents,
+	// so current path can be printed in the query syntax: `.objects[0].object[1]`.
+	paths struct {
+		options   PathOptions
+		positions []int            // position of every tag of current path
+		counts    []map[string]int // numbers of the child tags by name for every tag of current path and the root
+		leaf      *leaf            // the last open tag waiting for its text
+	}
+
+	// leaf keeps path of the tag printed by `TagPath` search with values until it's known if the tag has
+	// nested tags.
+	leaf struct {
+		depth      int
+		path       string
+		attributes []string // paths of the attributes with their values
+		text       []byte
+	}
+)
+
+// SetPathOptions sets how paths of the tags are printed.
+func (p *Processor) SetPathOptions(options PathOptions) {
+	p.paths.options = options
+}
+
+func (p *Processor) withPaths() bool {
+	return p.query.searchType == domain.TagPath || p.paths.options.Prefix
+}
+
+// openPath counts position of current tag among the tags with the same name inside its parent.
+func (p *Processor) openPath() {
+	if !p.withPaths() {
+		return
+	}
+	p.closeLeaf(false)
+
+	depth := len(p.currentPath)
+	for len(p.paths.counts) < depth {
+		p.paths.counts = append(p.paths.counts, map[string]int{})
+	}
+	parent := p.paths.counts[depth-1]
+	p.paths.positions = append(p.paths.positions, parent[p.currentTag.name])
+	parent[p.currentTag.name]++
+	p.paths.counts = append(p.paths.counts[:depth], map[string]int{})
+}
+
+// closePath prints the tag on `depth` waiting for its text and forgets its position.
+func (p *Processor) closePath(depth int) {
+	if !p.withPaths() || len(p.paths.positions) < depth {
+		return
+	}
+	if p.paths.leaf != nil && p.paths.leaf.depth == depth {
+		p.closeLeaf(true)
+	}
+
+	p.paths.positions = p.paths.positions[:depth-1]
+	p.paths.counts = p.paths.counts[:depth]
+}
+
+// printPath prints path of current tag and paths of its attributes. If values are printed, the tag waits
+// for its text.
+func (p *Processor) printPath() {
+	path := p.currentPathString()
+	var attributes []string
+	if p.paths.options.Attributes {
+		for _, name := range pickAttributesNames(p.currentTag.bytes) {
+			name = strings.TrimSpace(name)
+			attribute := path + "#" + quoteName(name)
+			if p.paths.options.Values {
+				value, _ := pickAttributeValue(name, p.currentTag.bytes) // nolint errcheck: the name is picked from the tag
+				attribute += "\t" + value
+			}
+			attributes = append(attributes, attribute)
+		}
+	}
+
+	if p.paths.options.Values {
+		p.paths.leaf = &leaf{
+			depth:      len(p.currentPath),
+			path:       path,
+			attributes: attributes,
+		}
+
+		return
+	}
+
+	p.print(path, false, p.matchInside)
+	for i := range attributes {
+		p.print(attributes[i], false, p.matchInside)
+	}
+}
+
+func (p *Processor) addToLeaf(s byte) {
+	p.paths.leaf.text = append(p.paths.leaf.text, s)
+}
+
+// closeLeaf prints path of the tag waiting for its text. Text is printed if there are no nested tags.
+func (p *Processor) closeLeaf(isLeaf bool) {
+	l := p.paths.leaf
+	if l == nil {
+		return
+	}
+	p.paths.leaf = nil
+
+	path := l.path
+	if text := strings.Join(strings.Fields(string(l.text)), " "); isLeaf && text != "" {
+		path += "\t" + text
+	}
+	p.print(path, false, p.matchInside)
+	for i := range l.attributes {
+		p.print(l.attributes[i], false, p.matchInside)
+	}
+}
+
+// withPath returns the value after current path separated by tab if values are printed with paths.
+// Path of attribute value ends with the attribute name: `.a[0].b[1]#id`.
+func (p *Processor) withPath(value, attribute string) string {
+	if !p.paths.options.Prefix {
+		return value
+	}
+
+	path := p.currentPathString()
+	if attribute != "" {
+		path += "#" + quoteName(attribute)
+	}
+
+	return path + "\t" + value
+}
+
+// currentPathString returns current path in the query syntax: `.objects[0].object[1]`.
+func (p *Processor) currentPathString() string {
+	var sb strings.Builder
+	for i, name := range p.currentPath {
+		sb.WriteByte('.')
+		sb.WriteString(quoteName(name))
+		sb.WriteByte('[')
+		sb.WriteString(strconv.Itoa(p.paths.positions[i]))
+		sb.WriteByte(']')
+	}
+
+	return sb.String()
+}
+
+// quoteName returns the name quoted if it can't be used in the query as is: `"config.v2"`.
+func quoteName(name string) string {
+	if name == "" {
+		return `""`
+	}
+
+	for i, r := range name {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+			continue
+		case i > 0 && (r == '-' || r >= '0' && r <= '9'):
+			continue
+		case i > 0 && r == ':' && i+1 < len(name) && name[i+1] != ':':
+			continue
+		}
+
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+	}
+
+	return name
+}
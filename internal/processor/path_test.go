@@ -0,0 +1,106 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tty2/xq/internal/domain"
+)
+
+// nolint lll: there are long strings on purpose
+func TestProcessPaths(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`<?xml version="1.0"?><objects><object id="1"><title lang="EN">A</title><title lang="RU">B <i>b</i></title></object><object id="2"><title/><x.y>C</x.y></object></objects>`)
+
+	t.Run("tags", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p, err := New([]domain.Step{{Name: "objects", Index: -1}, {Name: "object", Index: -1}}, domain.Attribute{}, domain.TagPath)
+		rq.NoError(err)
+
+		res, err := p.Evaluate(data)
+		rq.NoError(err)
+		rq.Equal([]string{
+			".objects[0].object[0]",
+			".objects[0].object[0].title[0]",
+			".objects[0].object[0].title[1]",
+			".objects[0].object[0].title[1].i[0]",
+			".objects[0].object[1]",
+			".objects[0].object[1].title[0]",
+			`.objects[0].object[1]."x.y"[0]`,
+		}, res)
+		rq.Empty(p.paths.positions)
+	})
+
+	t.Run("attributes and values", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p, err := New([]domain.Step{{Name: "title", Index: -1, Descendant: true}}, domain.Attribute{}, domain.TagPath)
+		rq.NoError(err)
+		p.SetPathOptions(PathOptions{Attributes: true, Values: true})
+
+		res, err := p.Evaluate(data)
+		rq.NoError(err)
+		rq.Equal([]string{
+			".objects[0].object[0].title[0]\tA",
+			".objects[0].object[0].title[0]#lang\tEN",
+			".objects[0].object[0].title[1]",
+			".objects[0].object[0].title[1]#lang\tRU",
+			".objects[0].object[0].title[1].i[0]\tb",
+			".objects[0].object[1].title[0]",
+		}, res)
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		path := []domain.Step{{Name: "objects", Index: -1}, {Name: "object", Index: -1}}
+		p, err := New(path, domain.Attribute{Name: "id"}, domain.AttrValue)
+		rq.NoError(err)
+		p.SetPathOptions(PathOptions{Prefix: true})
+
+		res, err := p.Evaluate(data)
+		rq.NoError(err)
+		rq.Equal([]string{".objects[0].object[0]#id\t1", ".objects[0].object[1]#id\t2"}, res)
+
+		p, err = New(append(path, domain.Step{Name: "title", Index: -1}), domain.Attribute{}, domain.TagText)
+		rq.NoError(err)
+		p.SetPathOptions(PathOptions{Prefix: true})
+
+		res, err = p.Evaluate(data)
+		rq.NoError(err)
+		rq.Equal([]string{".objects[0].object[0].title[0]\tA", ".objects[0].object[0].title[1]\tB b"}, res)
+
+		p, err = New(append(path, domain.Step{Name: "x.y", Index: -1}), domain.Attribute{}, domain.TagValue)
+		rq.NoError(err)
+		p.SetPathOptions(PathOptions{Prefix: true})
+
+		res, err = p.Evaluate(data)
+		rq.NoError(err)
+		rq.Equal(`.objects[0].object[1]."x.y"[0]`, res[0])
+		rq.Len(res, 4)
+	})
+}
+
+func TestQuoteName(t *testing.T) {
+	t.Parallel()
+	rq := require.New(t)
+
+	for name, expected := range map[string]string{
+		"tag":      "tag",
+		"ns:tag-1": "ns:tag-1",
+		"_имя":     "_имя",
+		"1tag":     `"1tag"`,
+		"a.b":      `"a.b"`,
+		"a::b":     `"a::b"`,
+		"a:":       `"a:"`,
+		`say"hi\`:  `"say\"hi\\"`,
+		"":         `""`,
+	} {
+		rq.Equal(expected, quoteName(name), name)
+	}
+}
@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"fmt"
+
+	"github.com/tty2/xq/internal/domain"
+)
+
+type (
+	// children keeps positions of child tags matched by the steps with slices.
+	children struct {
+		counts []int // number of child tags matched by every step
+		// child tags matched by every step waiting for the parent to be closed to know how many tags there are
+		waiting [][]*positionCheck
+	}
+
+	// positionCheck is a tag position for the step with slice counted from the end.
+	positionCheck struct {
+		position int
+		passed   []bool // the same row as the tag has in `currentFilters`
+		pending  []bool // the same row as the tag has in `currentPending`
+	}
+)
+
+func hasSlices(path []domain.Step) bool {
+	for i := range path {
+		if path[i].Slice != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkPositions sets flags of the steps with slices for current tag depending on its position among
+// the tags matched by the step inside the same parent. If the position is counted from the end, the step
+// is pending until the parent is closed. If the step child filters aren't checked yet, the tag gets its
+// position when they are satisfied. Select condition is checked after the position.
+func (p *Processor) checkPositions(passed, pending []bool) ([]bool, []bool) {
+	if !hasSlices(p.query.path) {
+		return passed, pending
+	}
+
+	depth := len(p.currentPath)
+	for len(p.children) < depth { // the first one is for the root tags
+		p.children = append(p.children, &children{
+			counts: make([]int, len(p.query.path)),
+		})
+	}
+	parent := p.children[depth-1]
+	p.children = append(p.children, &children{
+		counts: make([]int, len(p.query.path)),
+	})
+
+	passes := make([][]bool, 0, depth)
+	passes = append(passes, p.currentFilters...)
+	matched := domain.MatchedSteps(p.query.path, p.currentPath, append(passes, passed)...)
+	for i := range p.query.path {
+		if p.query.path[i].Slice == nil || !matched[i] {
+			continue
+		}
+
+		if passed == nil {
+			passed = make([]bool, len(p.query.path))
+			for j := range passed {
+				passed[j] = true
+			}
+		}
+		if pending == nil {
+			pending = make([]bool, len(p.query.path))
+		}
+
+		if pending[i] && p.query.path[i].Condition == nil { // child filters are checked before position
+			c := p.candidates[len(p.candidates)-1]
+			c.parent = parent
+			c.unplaced = append(c.unplaced, i)
+
+			continue
+		}
+
+		p.place(parent, i, passed, pending)
+	}
+
+	return passed, pending
+}
+
+// place counts position of the tag with flags `passed` and `pending` among the tags matched by the `step`
+// inside the `parent` and sets the step flags. Condition of select is checked after the position, so the tag
+// with the position can still wait for it. If only the last tags can be inside the slice, the tags before them
+// don't wait for the parent to be closed, so their values aren't kept: `[-1]` keeps the only tag.
+func (p *Processor) place(parent *children, step int, passed, pending []bool) {
+	sl := p.query.path[step].Slice
+	position := parent.counts[step]
+	parent.counts[step]++
+	if !sl.FromEnd() {
+		passed[step] = sl.Contains(position, 0)
+		if !passed[step] { // otherwise the step can wait for select condition
+			pending[step] = false
+		}
+
+		return
+	}
+
+	pending[step] = true
+	if parent.waiting == nil {
+		parent.waiting = make([][]*positionCheck, len(p.query.path))
+	}
+	waiting := append(parent.waiting[step], &positionCheck{
+		position: position,
+		passed:   passed,
+		pending:  pending,
+	})
+	if last := sl.Last(); last > 0 && len(waiting) > last { // the first one is before the last tags
+		out := waiting[0]
+		out.passed[step], out.pending[step] = false, false
+		waiting = append(waiting[:0], waiting[1:]...)
+	}
+	parent.waiting[step] = waiting
+}
+
+// closePositions checks positions of the child tags counted from the end when the tag on `depth` is closed.
+func (p *Processor) closePositions(depth int) {
+	if len(p.children) <= depth {
+		return
+	}
+
+	ch := p.children[depth]
+	p.children = p.children[:depth]
+	for step, waiting := range ch.waiting {
+		for _, pc := range waiting {
+			pc.passed[step] = pc.passed[step] && p.query.path[step].Slice.Contains(pc.position, ch.counts[step])
+			pc.pending[step] = false
+		}
+	}
+}
+
+// finish checks the tags which wait for the end of the document and prints the rest of the results. The modified
+// document can't end before all its tags are closed, while the results found in the truncated one are printed.
+func (p *Processor) finish() error {
+	if p.edit != nil {
+		if err := p.complete(); err != nil {
+			return err
+		}
+	}
+
+	p.closePositions(0)
+	p.flushDocument(true)
+	p.flushQueue()
+
+	return nil
+}
+
+// complete checks that all the tags of the document are closed.
+func (p *Processor) complete() error {
+	if p.insideTag {
+		return fmt.Errorf("incorrect xml structure: the document ends inside the tag `%s`", p.currentTag.bytes)
+	}
+	if ln := len(p.currentPath); ln > 0 {
+		return fmt.Errorf("incorrect xml structure: the document ends before the tag `%s` is closed",
+			p.currentPath[ln-1])
+	}
+
+	return nil
+}
@@ -0,0 +1,217 @@
+package processor
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tty2/xq/internal/domain"
+)
+
+// nolint lll: there are long strings on purpose
+func TestProcessWithSlices(t *testing.T) {
+	t.Parallel()
+
+	t.Run("last in every parent", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:       "tg",
+						Index:      -1,
+						Descendant: true,
+						Slice:      &domain.Slice{Start: -1, Step: 1},
+					},
+				},
+				searchType: domain.AttrValue,
+				attribute:  "id",
+			},
+		}
+
+		err := p.process([]byte(`<objects><object><tg id="1" /><tg id="2" /></object><object><tg id="3" /><data /></object></objects>`))
+		rq.NoError(err)
+		rq.NoError(p.finish())
+		rq.Equal([]string{"2", "3"}, p.printList)
+		rq.Empty(p.queue)
+	})
+
+	t.Run("tag value from end", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:  "objects",
+						Index: -1,
+					},
+					{
+						Name:  "object",
+						Index: -1,
+						Slice: &domain.Slice{Start: -2, End: -1, HasEnd: true, Step: 1},
+					},
+				},
+				searchType: domain.TagValue,
+			},
+		}
+
+		err := p.process([]byte(`<objects><object>1</object><object>2</object><object>3</object></objects>`))
+		rq.NoError(err)
+		rq.Len(p.printList, 3)
+		rq.Equal(string(domain.ColorizeTag([]byte(`<object>`))), p.printList[0])
+		rq.Equal("  2", p.printList[1])
+	})
+
+	t.Run("range is printed at once", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:  "objects",
+						Index: -1,
+					},
+					{
+						Name:  "object",
+						Index: -1,
+						Slice: &domain.Slice{Start: 1, Step: 2},
+					},
+				},
+				searchType: domain.AttrValue,
+				attribute:  "id",
+			},
+		}
+
+		err := p.process([]byte(`<objects><object id="0" /><other id="x" /><object id="1" /><object id="2" /><object id="3" />`))
+		rq.NoError(err)
+		rq.Equal([]string{"1", "3"}, p.printList)
+	})
+
+	t.Run("slices on several steps", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:  "objects",
+						Index: -1,
+					},
+					{
+						Name:  "object",
+						Index: -1,
+						Slice: &domain.Slice{Start: -1, Step: 1},
+					},
+					{
+						Name:  "tg",
+						Index: -1,
+						Slice: &domain.Slice{Start: 0, End: 1, HasEnd: true, Step: 1},
+					},
+				},
+				searchType: domain.AttrValue,
+				attribute:  "id",
+			},
+		}
+
+		err := p.process([]byte(`<objects><object><tg id="1" /><tg id="2" /></object><object><tg id="3" /><tg id="4" /></object></objects>`))
+		rq.NoError(err)
+		rq.NoError(p.finish())
+		rq.Equal([]string{"3"}, p.printList)
+	})
+	t.Run("position among tags with child filters", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:  "objects",
+						Index: -1,
+					},
+					{
+						Name:    "object",
+						Index:   -1,
+						Filters: []domain.Filter{{Child: []string{"year"}, Operator: domain.FilterGreater, Value: "1990"}},
+						Slice:   &domain.Slice{Start: 0, End: 1, HasEnd: true, Step: 1},
+					},
+				},
+				searchType: domain.AttrValue,
+				attribute:  "id",
+			},
+		}
+
+		err := p.process([]byte(`<objects><object id="1"><year>1980</year></object><object id="2"><year>1995</year></object><object id="3"><year>2000</year></object></objects>`))
+		rq.NoError(err)
+		rq.NoError(p.finish())
+		rq.Equal([]string{"2"}, p.printList)
+		rq.Empty(p.queue)
+	})
+
+	t.Run("last tag with child filters", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:    "object",
+						Index:   -1,
+						Filters: []domain.Filter{{Child: []string{"title"}, Operator: domain.FilterExists}},
+						Slice:   &domain.Slice{Start: -1, Step: 1},
+					},
+				},
+				searchType: domain.AttrValue,
+				attribute:  "id",
+			},
+		}
+
+		err := p.process([]byte(`<object id="1"><title /></object><object id="2"><title /></object><object id="3" />`))
+		rq.NoError(err)
+		rq.Empty(p.printList)
+		rq.NoError(p.finish())
+		rq.Equal([]string{"2"}, p.printList)
+	})
+
+	t.Run("only the last tags wait for the parent", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:  "objects",
+						Index: -1,
+					},
+					{
+						Name:  "object",
+						Index: -1,
+						Slice: &domain.Slice{Start: -2, Step: 1},
+					},
+				},
+				searchType: domain.TagValue,
+			},
+		}
+
+		rq.NoError(p.process([]byte(`<objects>`)))
+		for i := 0; i < 100; i++ {
+			rq.NoError(p.process([]byte(`<object><year>` + strconv.Itoa(i) + `</year></object>`)))
+			rq.LessOrEqual(len(p.children[1].waiting[1]), 2)
+			rq.LessOrEqual(len(p.queue), 14) // values of two objects
+		}
+		rq.NoError(p.process([]byte(`</objects>`)))
+		rq.NoError(p.finish())
+		rq.Equal([]string{"<\x1b[01;31mobject\x1b[00m>", "  <\x1b[01;31myear\x1b[00m>", "    98"}, p.printList[:3])
+		rq.Len(p.printList, 10)
+		rq.Empty(p.queue)
+	})
+}
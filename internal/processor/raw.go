@@ -0,0 +1,35 @@
+package processor
+
+// raw keeps markup of the tag matched by the query with its nested tags as it is in the data.
+type raw struct {
+	depth int // length of the current path with the tag
+	value []byte
+}
+
+// openRaw starts to keep markup of current tag.
+func (p *Processor) openRaw() {
+	p.raws = append(p.raws, &raw{
+		depth: len(p.currentPath),
+	})
+}
+
+func (p *Processor) addToRaws(s ...byte) {
+	for i := range p.raws {
+		p.raws[i].value = append(p.raws[i].value, s...)
+	}
+}
+
+// closeRaw prints markup of the tag on `depth` when the tag is closed.
+func (p *Processor) closeRaw(depth int) {
+	ln := len(p.raws)
+	if ln == 0 || p.raws[ln-1].depth != depth {
+		return
+	}
+
+	r := p.raws[ln-1]
+	p.raws = p.raws[:ln-1]
+	if !p.currentPathMatch() { // child filters of the tag aren't satisfied
+		return
+	}
+	p.print(string(r.value), false, p.matchCurrent)
+}
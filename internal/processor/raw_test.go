@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tty2/xq/internal/domain"
+)
+
+// nolint lll: there are long strings on purpose
+func TestProcessRaw(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nested tags", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{Name: "item", Index: -1, Descendant: true},
+				},
+				searchType: domain.TagRaw,
+			},
+		}
+
+		err := p.process([]byte("<items><item id=\"1\"><!-- a -->\n <item /><name>A</name></item><item>B</item></items>"))
+		rq.NoError(err)
+		rq.Equal([]string{"<item />", "<item id=\"1\"><!-- a -->\n <item /><name>A</name></item>", "<item>B</item>"}, p.printList)
+		rq.Empty(p.raws)
+	})
+
+	t.Run("child filter", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{Name: "book", Index: -1, Filters: []domain.Filter{
+						{Child: []string{"price"}, Operator: domain.FilterGreater, Value: "5"},
+					}},
+				},
+				searchType: domain.TagRaw,
+			},
+		}
+
+		err := p.process([]byte(`<book><price>10</price></book><book><price>1</price></book>`))
+		rq.NoError(err)
+		rq.Equal([]string{"<book><price>10</price></book>"}, p.printList)
+	})
+}
+
+// nolint lll: there are long strings on purpose
+func TestEvaluate(t *testing.T) {
+	t.Parallel()
+	rq := require.New(t)
+
+	p, err := New([]domain.Step{
+		{Name: domain.Wildcard, Index: -1},
+		{Name: "title", Index: -1, Slice: &domain.Slice{Start: -1, Step: 1}},
+	}, domain.Attribute{Name: "lang"}, domain.AttrValue)
+	rq.NoError(err)
+
+	res, err := p.Evaluate([]byte(`<object><title lang="EN">A</title><title lang="RU">B</title></object>`))
+	rq.NoError(err)
+	rq.Equal([]string{"RU"}, res)
+
+	res, err = p.Evaluate([]byte(`<object><title lang="DE">C</title></object>`))
+	rq.NoError(err)
+	rq.Equal([]string{"DE"}, res)
+
+	p, err = New([]domain.Step{{Name: domain.Wildcard, Index: -1}, {Name: "title", Index: -1}}, domain.Attribute{}, domain.TagCount)
+	rq.NoError(err)
+
+	res, err = p.Evaluate([]byte(`<object><title /><title /></object>`))
+	rq.NoError(err)
+	rq.Equal([]string{"2"}, res)
+}
@@ -8,11 +8,13 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/tty2/xq/internal/domain"
 	"github.com/tty2/xq/internal/domain/symbol"
-	"github.com/tty2/xq/pkg/slice"
+	"github.com/tty2/xq/internal/transform"
 )
 
 const indentItemSize int = 2
@@ -20,43 +22,109 @@ const indentItemSize int = 2
 type (
 	// Processor is a tag processor. Keeps needed attributes to process data and handle tag data.
 	Processor struct {
-		insideTag   bool
-		currentPath []string
-		printList   []string
-		currentTag  tag
-		query       query
-		indentation int
-		tagValue    []byte
-		stop        bool
-		index       index
+		insideTag      bool
+		currentPath    []string
+		currentFilters [][]bool // steps filters satisfied by every tag of current path
+		currentPending [][]bool // steps child filters that aren't checked yet for every tag of current path
+		matches        [][]bool // states of the query steps before the root and after every tag of current path
+		matched        int      // number of the tags of current path the states are known for
+		candidates     []*candidate
+		captures       []*capture
+		children       []*children         // positions of child tags for every tag of current path and the root
+		namespaces     []map[string]string // namespaces declared by every tag of current path: prefix -> URI
+		currentAnchor  [][]bool            // anchor steps filters satisfied by every tag of current path
+		axes           []*axisCandidate
+		siblings       []bool  // flags of the anchor matched among children for every tag of current path and the root
+		texts          []*text // texts of the tags of current path matched by the query
+		raws           []*raw  // markup of the tags of current path matched by the query
+		edit           *editor // modification of the tags matched by the query
+		paths          paths
+		queue          []output
+		state          *pathState // copy of the current path shared by the values added to the queue
+		printList      []string
+		printOffsets   []int // offsets of the symbols the values of print list are found at
+		count          int   // number of the matched tags if they are counted
+		offset         int   // number of the processed symbols
+		currentTag     tag
+		query          query
+		indentation    int
+		tagValue       []byte
+		stop           bool
+		index          index
+		err            error // error the processing stopped with
 	}
 
 	query struct {
 		path       []domain.Step
+		anchor     []domain.Step // steps before the axis step
+		axis       domain.Axis
 		attribute  string
+		namespace  string         // URI of the namespace the selected attribute belongs to
+		attributes *regexp.Regexp // names of the selected attributes if several ones can be selected
 		searchType domain.SearchType
+		regexps    map[string]*regexp.Regexp  // compiled patterns of filters
+		functions  map[string]transform.Chain // compiled string functions of filters
+		text       bool                       // values of attributes are printed with entities decoded
 	}
 
 	index struct {
 		set          bool
 		insideTarget bool
+		depth        int // length of the current path when target is found
 	}
 
 	tag struct {
 		bytes    []byte
 		name     string // tagname
 		closed   bool   // </tagname>
+		edited   bool   // modified markup of the tag is printed instead of it
 		brackets int    // stack to keep track open and close brackets
 	}
 )
 
 // New creates a new Processor with needed attributes.
-func New(path []domain.Step, attribute string, search domain.SearchType) (*Processor, error) {
+func New(path []domain.Step, attribute domain.Attribute, search domain.SearchType) (*Processor, error) {
+	err := domain.CheckAxis(path)
+	if err != nil {
+		return nil, err
+	}
+
+	anchor, path, axis := splitAxis(path)
+
+	err = validateFilters(append(append([]domain.Step{}, anchor...), path...))
+	if err != nil {
+		return nil, err
+	}
+
+	regexps, err := compileFilters(append(append([]domain.Step{}, anchor...), path...))
+	if err != nil {
+		return nil, err
+	}
+
+	functions, err := compileFunctions(append(append([]domain.Step{}, anchor...), path...))
+	if err != nil {
+		return nil, err
+	}
+
+	var attributes *regexp.Regexp
+	if attribute.IsMultiple() {
+		attributes, err = compileAttributes(attribute)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &Processor{
 		query: query{
 			path:       path,
-			attribute:  attribute,
+			anchor:     anchor,
+			axis:       axis,
+			attribute:  attribute.Name,
+			namespace:  attribute.Namespace,
+			attributes: attributes,
 			searchType: search,
+			regexps:    regexps,
+			functions:  functions,
 		},
 		index: index{
 			set: isIndexSearch(path),
@@ -75,11 +143,7 @@ func isIndexSearch(path []domain.Step) bool {
 }
 
 func (p *Processor) indexTagFound() bool {
-	if len(p.query.path) != len(p.currentPath) {
-		return false
-	}
-
-	if !domain.PathsMatch(p.query.path, p.currentPath) {
+	if !p.currentPathMatch() {
 		return false
 	}
 
@@ -91,6 +155,7 @@ func (p *Processor) indexTagFound() bool {
 
 	if !p.index.insideTarget {
 		p.index.insideTarget = true
+		p.index.depth = len(p.currentPath)
 	}
 
 	return true
@@ -108,9 +173,14 @@ func (p *Processor) Process(r *bufio.Reader) chan string {
 			n, err := r.Read(buf[:cap(buf)])
 			if err != nil {
 				if err == io.EOF {
+					p.err = p.finish()
+					if p.err != nil {
+						return
+					}
+
 					break
 				}
-				ch <- err.Error()
+				p.err = err
 
 				return
 			}
@@ -119,7 +189,7 @@ func (p *Processor) Process(r *bufio.Reader) chan string {
 
 			err = p.process(buf)
 			if err != nil {
-				ch <- err.Error()
+				p.err = err
 
 				return
 			}
@@ -127,12 +197,21 @@ func (p *Processor) Process(r *bufio.Reader) chan string {
 			for ; idx < len(p.printList); idx++ {
 				ch <- p.printList[idx]
 			}
+			if p.query.searchType == domain.TagCount || p.edit != nil { // printed values aren't kept
+				p.printList, p.printOffsets, idx = p.printList[:0], p.printOffsets[:0], 0
+			}
 
-			if p.stop {
-				return
+			if p.stop && p.edit == nil { // the rest of the document is printed if it's modified
+				break
 			}
 		}
 
+		if p.query.searchType == domain.TagCount {
+			ch <- strconv.Itoa(p.count)
+
+			return
+		}
+
 		for ; idx < len(p.printList); idx++ {
 			ch <- p.printList[idx]
 		}
@@ -141,8 +220,47 @@ func (p *Processor) Process(r *bufio.Reader) chan string {
 	return ch
 }
 
+// Err returns the error the processing stopped with. It's known when the channel returned by `Process` is closed.
+func (p *Processor) Err() error {
+	return p.err
+}
+
+// Evaluate returns the values selected in the data by the query of the processor. The data is processed by a new
+// processor, so the query compiled once can be evaluated against every tag found by another processor:
+// `group_by(.objects.object; .title#lang)`.
+func (p *Processor) Evaluate(data []byte) ([]string, error) {
+	e := Processor{
+		query: p.query,
+		index: index{
+			set: p.index.set,
+		},
+		paths: paths{
+			options: p.paths.options,
+		},
+	}
+	e.query.path = append([]domain.Step{}, p.query.path...) // indexes of steps are changed by processing
+
+	err := e.process(data)
+	if err != nil {
+		return nil, err
+	}
+	if !e.stop {
+		err = e.finish()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if e.query.searchType == domain.TagCount {
+		return []string{strconv.Itoa(e.count)}, nil
+	}
+
+	return e.printList, nil
+}
+
 func (p *Processor) process(chunk []byte) error {
 	for i := range chunk {
+		p.offset++
 		switch {
 		case p.insideTag:
 			p.addSymbolIntoTag(chunk[i])
@@ -153,6 +271,17 @@ func (p *Processor) process(chunk []byte) error {
 			p.insideTag = false
 
 			if p.skip() {
+				if len(p.raws) > 0 {
+					p.addToRaws(p.currentTag.bytes...)
+				}
+				if len(p.texts) > 0 {
+					p.addCDATAToTexts()
+				}
+				if len(p.captures) > 0 {
+					p.captureText(p.cdataContent()...)
+				}
+				p.keep(p.currentTag.bytes...)
+
 				continue
 			}
 
@@ -160,10 +289,16 @@ func (p *Processor) process(chunk []byte) error {
 			if err != nil {
 				return err
 			}
-			if p.stop {
+			if p.stop && p.edit == nil { // the modified document is read to the end to be printed
 				return nil
 			}
 		case chunk[i] == symbol.OpenBracket:
+			if len(p.texts) > 0 {
+				p.addToTexts(' ')
+			}
+			if len(p.captures) > 0 {
+				p.captureText(' ')
+			}
 			p.insideTag = true
 			p.currentTag = tag{
 				bytes:    []byte{symbol.OpenBracket},
@@ -180,11 +315,27 @@ func (p *Processor) process(chunk []byte) error {
 
 					continue
 				}
-				p.printList = append(p.printList, string(append(bytes.Repeat([]byte(" "),
-					indentItemSize*p.indentation+indentItemSize), p.tagValue...)))
+				p.print(string(append(bytes.Repeat([]byte(" "),
+					indentItemSize*p.indentation+indentItemSize), p.tagValue...)), false, p.matchInside)
 				p.tagValue = []byte{}
 			}
-		case p.query.searchType == domain.TagValue && p.queryIntoCurrentPath():
+		default:
+			p.keep(chunk[i])
+			if len(p.captures) > 0 {
+				p.captureText(chunk[i])
+			}
+			if len(p.texts) > 0 {
+				p.addToTexts(chunk[i])
+			}
+			if len(p.raws) > 0 {
+				p.addToRaws(chunk[i])
+			}
+			if p.paths.leaf != nil {
+				p.addToLeaf(chunk[i])
+			}
+			if p.query.searchType != domain.TagValue || !p.queryIntoCurrentPath() {
+				continue
+			}
 			if p.index.set {
 				if !p.index.insideTarget {
 					continue
@@ -196,6 +347,7 @@ func (p *Processor) process(chunk []byte) error {
 			p.tagValue = append(p.tagValue, chunk[i])
 		}
 	}
+	p.flushDocument(false)
 
 	return nil
 }
@@ -235,19 +387,40 @@ func (p *Processor) processCurrentTag() error {
 		if p.index.set && // process with index in path initialized
 			!p.stop && // target isn't parsed completely
 			p.index.insideTarget && // but current tag is target
-			domain.PathsMatch(p.query.path, p.currentPath) { // and this is the close tag for target
+			len(p.currentPath) == p.index.depth && // and this is the close tag for target
+			p.currentPathMatch() {
 			p.updatePrintList()
 			p.stop = true
 		}
 	} else {
 		p.currentPath = append(p.currentPath, p.currentTag.name)
+		p.state = nil
+		p.changeMatches(len(p.currentPath) - 1)
+		p.openFilters()
+		p.openPath()
 	}
 
 	p.updatePrintList()
+	if len(p.raws) > 0 {
+		p.addToRaws(p.currentTag.bytes...)
+	}
+	if !p.currentTag.edited {
+		p.keep(p.currentTag.bytes...)
+	}
 	if p.currentTagIsSingle() {
+		if p.index.insideTarget && len(p.currentPath) == p.index.depth { // single tag is target itself
+			p.stop = true
+		}
+		p.closeFilters()
 		p.currentPath = p.currentPath[:len(p.currentPath)-1]
+		p.currentFilters = p.currentFilters[:len(p.currentFilters)-1]
+		p.currentPending = p.currentPending[:len(p.currentPending)-1]
+		p.state = nil
+		p.changeMatches(len(p.currentPath))
 	}
 	if p.currentTag.closed {
+		p.closeFilters()
+
 		return p.decrementPath()
 	}
 
@@ -265,84 +438,151 @@ func (p *Processor) updatePrintList() {
 			p.indexTagFound()
 		}
 
-		if !p.index.insideTarget {
+		if !p.index.insideTarget || p.nestedIntoTarget() {
 			return
 		}
 	}
 	switch {
 	case p.query.searchType == domain.TagList && p.tagInQueryPath():
-		tn := p.currentTag.name
-		if !slice.ContainsString(p.printList, tn) {
-			p.printList = append(p.printList, tn)
-		}
-	case p.query.searchType == domain.AttrList && domain.PathsMatch(p.query.path, p.currentPath):
+		p.print(p.currentTag.name, true, p.matchParent)
+	case p.query.searchType == domain.AttrList && p.currentPathMatch():
 		list := pickAttributesNames(p.currentTag.bytes)
 		for i := range list {
-			an := strings.TrimSpace(list[i])
-			if !slice.ContainsString(p.printList, an) {
-				p.printList = append(p.printList, an)
+			name := strings.TrimSpace(list[i])
+			if p.query.attributes != nil && !p.query.attributes.MatchString(name) {
+				continue
 			}
+			p.print(name, true, p.matchCurrent)
 		}
-	case p.query.searchType == domain.AttrValue && domain.PathsMatch(p.query.path, p.currentPath):
-		av, err := pickAttributeValue(p.query.attribute, p.currentTag.bytes)
+	case p.query.searchType == domain.AttrValue && p.query.attributes != nil && p.currentPathMatch():
+		for _, pair := range pickAttributes(p.query.attributes, p.currentTag.bytes) {
+			p.print(p.withPath(p.attributeText(pair), ""), true, p.matchCurrent)
+		}
+	case p.query.searchType == domain.AttrValue && p.currentPathMatch():
+		name, ok := p.attributeName(p.query.attribute, p.query.namespace, p.currentTag.bytes)
+		if !ok {
+			return
+		}
+		av, err := pickAttributeValue(name, p.currentTag.bytes)
 		if err != nil {
 			return
 		}
 		if av == "" {
 			return
 		}
-		if !slice.ContainsString(p.printList, av) {
-			p.printList = append(p.printList, av)
-		}
+		p.print(p.withPath(p.attributeText(av), name), true, p.matchCurrent)
+	case p.query.searchType == domain.TagName && !p.currentTag.closed && p.currentPathMatch():
+		p.print(p.withPath(p.currentTag.name, ""), false, p.matchCurrent)
+	case p.query.searchType == domain.TagCount && !p.currentTag.closed && p.currentPathMatch():
+		p.print(p.currentTag.name, false, p.matchCurrent)
+	case p.query.searchType == domain.TagText && !p.currentTag.closed && p.currentPathMatch():
+		p.openText()
+	case p.query.searchType == domain.TagRaw && !p.currentTag.closed && p.currentPathMatch():
+		p.openRaw()
+	case p.query.searchType == domain.TagEdit && !p.currentTag.closed && p.currentPathMatch():
+		p.openEdit()
+	case p.query.searchType == domain.TagPath && !p.currentTag.closed && p.queryIntoCurrentPath():
+		p.printPath()
 	case p.query.searchType == domain.TagValue && p.queryIntoCurrentPath():
-		p.indentation = len(p.currentPath) - len(p.query.path)
-		p.printList = append(p.printList, string(append(bytes.Repeat([]byte(" "),
-			indentItemSize*p.indentation), domain.ColorizeTag(p.currentTag.bytes)...)))
+		if p.paths.options.Prefix && !p.currentTag.closed && p.currentPathMatch() {
+			p.print(p.currentPathString(), false, p.matchInside)
+		}
+		p.indentation = len(p.currentPath) - p.matchDepth()
+		p.print(string(append(bytes.Repeat([]byte(" "),
+			indentItemSize*p.indentation), domain.ColorizeTag(p.currentTag.bytes)...)), false, p.matchInside)
 	}
 }
 
-func (p *Processor) tagInQueryPath() bool {
-	// +1 because /query/path/tag + current_tag
-	if len(p.query.path)+1 != len(p.currentPath) {
-		return false
+// nestedIntoTarget checks if current tag is located deeper than index target and its child tags.
+// Such tags can match the query too if it contains descendant steps, but they are not a result.
+func (p *Processor) nestedIntoTarget() bool {
+	switch p.query.searchType {
+	case domain.TagList:
+		return len(p.currentPath) > p.index.depth+1
+	case domain.AttrList, domain.AttrValue, domain.TagCount, domain.TagName, domain.TagText, domain.TagRaw,
+		domain.TagEdit:
+		return len(p.currentPath) > p.index.depth
+	case domain.TagValue, domain.TagPath: // nested tags are part of the target value
 	}
 
-	// -1 because len - current tag
-	for i := 0; i < len(p.currentPath)-1; i++ {
-		if p.query.path[i].Name != p.currentPath[i] {
-			return false
-		}
-	}
+	return false
+}
 
-	return true
+func (p *Processor) tagInQueryPath() bool {
+	ln := len(p.currentPath)
+
+	return ln > 0 && p.matchStates()[ln-1][len(p.query.path)]
 }
 
 func (p *Processor) queryIntoCurrentPath() bool {
-	if len(p.query.path) > len(p.currentPath) {
-		return false
+	return p.matchDepth() > -1
+}
+
+// currentPathMatch checks if current path matches the query.
+func (p *Processor) currentPathMatch() bool {
+	return p.matchStates()[len(p.currentPath)][len(p.query.path)]
+}
+
+// matchStates returns states of the query steps before the root and after every tag of current path as
+// `domain.NextStates` returns them. The states are computed when a tag is opened or closed and kept for every depth,
+// so the text of the tags doesn't walk the path again.
+func (p *Processor) matchStates() [][]bool {
+	if len(p.matches) == 0 {
+		p.matches = append(p.matches, domain.InitialStates(p.query.path))
 	}
 
-	for i := 0; i < len(p.query.path); i++ {
-		if p.query.path[i].Name != p.currentPath[i] {
-			return false
+	for ; p.matched < len(p.currentPath); p.matched++ {
+		depth := p.matched
+		var passed []bool
+		if depth < len(p.currentFilters) {
+			passed = p.currentFilters[depth]
 		}
+		if depth+1 == len(p.matches) {
+			p.matches = append(p.matches, nil)
+		}
+		p.matches[depth+1] = domain.NextStates(p.query.path, p.matches[depth], p.currentPath[depth], passed,
+			p.matches[depth+1])
 	}
 
-	return true
+	return p.matches[:len(p.currentPath)+1]
+}
+
+// changeMatches drops the states of the query steps after `depth` tags of current path, they are computed again
+// when they are needed. It's called when the path or flags of its tags are changed.
+func (p *Processor) changeMatches(depth int) {
+	if p.matched > depth {
+		p.matched = depth
+	}
+}
+
+func (p *Processor) matchCurrent(path []string, passes [][]bool) bool {
+	return domain.PathsMatch(p.query.path, path, passes...)
 }
 
-func (p *Processor) pathIntoQuery() bool {
-	if len(p.currentPath) > len(p.query.path) {
+// matchParent checks if parent of the last tag in the `path` matches the query.
+func (p *Processor) matchParent(path []string, passes [][]bool) bool {
+	if len(path) == 0 {
 		return false
 	}
 
-	for i := 0; i < len(p.currentPath); i++ {
-		if p.query.path[i].Name != p.currentPath[i] {
-			return false
+	// -1 because len - current tag
+	return domain.PathsMatch(p.query.path, path[:len(path)-1], passes...)
+}
+
+// matchInside checks if the `path` is inside a tag which matches the query.
+func (p *Processor) matchInside(path []string, passes [][]bool) bool {
+	return domain.MatchDepth(p.query.path, path, passes...) > -1
+}
+
+// matchDepth returns the length of the current path part which matches the query.
+func (p *Processor) matchDepth() int {
+	for depth, states := range p.matchStates() {
+		if states[len(p.query.path)] {
+			return depth
 		}
 	}
 
-	return true
+	return -1
 }
 
 func (p *Processor) decrementPath() error {
@@ -357,6 +597,12 @@ func (p *Processor) decrementPath() error {
 	}
 
 	p.currentPath = p.currentPath[:ln-1]
+	p.state = nil
+	p.changeMatches(len(p.currentPath))
+	if len(p.currentFilters) > 0 {
+		p.currentFilters = p.currentFilters[:len(p.currentFilters)-1]
+		p.currentPending = p.currentPending[:len(p.currentPending)-1]
+	}
 
 	return nil
 }
@@ -382,7 +628,7 @@ func (t *tag) setName() error {
 	endName := startName
 
 	for ; endName < len(t.bytes)-1; endName++ {
-		if symbol.IsSpace(t.bytes[endName]) {
+		if symbol.IsSpace(t.bytes[endName]) || t.bytes[endName] == '/' { // `<tagname/>`
 			break
 		}
 	}
@@ -393,17 +639,10 @@ func (t *tag) setName() error {
 }
 
 func (p *Processor) decrementSearchIndex() {
-	if len(p.currentPath) > len(p.query.path) {
-		return
-	}
-	if len(p.currentPath) == 0 {
-		return
-	}
-	if p.query.path[len(p.currentPath)-1].Index == -1 {
-		return
-	}
-
-	if p.pathIntoQuery() {
-		p.query.path[len(p.currentPath)-1].Index--
+	matched := domain.MatchedSteps(p.query.path, p.currentPath, p.currentFilters...)
+	for i := range matched {
+		if matched[i] && p.query.path[i].Index > -1 {
+			p.query.path[i].Index--
+		}
 	}
 }
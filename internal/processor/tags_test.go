@@ -1,6 +1,8 @@
 package processor
 
 import (
+	"bufio"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -253,6 +255,50 @@ func TestTagInQueryPath(t *testing.T) {
 	})
 }
 
+func TestMatchStates(t *testing.T) {
+	t.Parallel()
+
+	t.Run("tags", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p, err := New([]domain.Step{{Name: "a", Index: -1}, {Name: "b", Index: -1}}, domain.Attribute{}, domain.TagValue)
+		rq.NoError(err)
+
+		rq.NoError(p.process([]byte("<a><b>")))
+		rq.True(p.currentPathMatch())
+		rq.Equal(2, p.matched)
+		states := p.matches[2]
+
+		rq.NoError(p.process([]byte("</b><c>")))
+		rq.False(p.currentPathMatch())
+		rq.Equal(-1, p.matchDepth())
+		rq.NoError(p.process([]byte("</c><b>")))
+		rq.True(p.currentPathMatch())
+		rq.Equal(&states[0], &p.matches[2][0]) // states of the depth are reused
+	})
+
+	t.Run("resolved filters", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p, err := New([]domain.Step{
+			{Name: "a", Index: -1, Condition: &domain.Condition{
+				Operator: domain.ConditionFilter,
+				Filter:   domain.Filter{Child: []string{"c"}, Operator: domain.FilterEqual, Value: "1"},
+			}},
+			{Name: "b", Index: -1},
+		}, domain.Attribute{}, domain.TagValue)
+		rq.NoError(err)
+
+		rq.NoError(p.process([]byte("<a><c>2</c><b>")))
+		rq.True(p.queryIntoCurrentPath()) // the condition isn't resolved yet
+		p.resolve(p.candidates[0], 0, false)
+		rq.False(p.queryIntoCurrentPath())
+		rq.False(p.currentPathMatch())
+	})
+}
+
 func TestUpdatePrintListForTags(t *testing.T) {
 	t.Parallel()
 
@@ -1134,7 +1180,7 @@ func TestNew(t *testing.T) {
 		t.Parallel()
 		rq := require.New(t)
 
-		_, err := New([]domain.Step{}, "", domain.TagList)
+		_, err := New([]domain.Step{}, domain.Attribute{}, domain.TagList)
 		rq.NoError(err)
 	})
 
@@ -1147,7 +1193,7 @@ func TestNew(t *testing.T) {
 				Name:  "tagname",
 				Index: -1,
 			},
-		}, "test", domain.TagList)
+		}, domain.Attribute{Name: "test"}, domain.TagList)
 
 		rq.NoError(err)
 		rq.Len(p.query.path, 1)
@@ -1755,3 +1801,189 @@ func TestProcessWithIndex(t *testing.T) {
 		rq.Equal(string(domain.ColorizeTag([]byte("</tg1>"))), p.printList[1])
 	})
 }
+
+// nolint lll: there are long strings on purpose
+func TestProcessDescendant(t *testing.T) {
+	t.Parallel()
+
+	t.Run("tag value", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:       "tg",
+						Index:      -1,
+						Descendant: true,
+					},
+				},
+				searchType: domain.TagValue,
+			},
+		}
+
+		err := p.process([]byte(`<objects><tg>1</tg><object><data><tg>2</tg></data></object></objects>`))
+		rq.NoError(err)
+		rq.Len(p.printList, 6)
+		rq.Equal(string(domain.ColorizeTag([]byte("<tg>"))), p.printList[0])
+		rq.Equal("  1", p.printList[1])
+		rq.Equal(string(domain.ColorizeTag([]byte("</tg>"))), p.printList[2])
+		rq.Equal(string(domain.ColorizeTag([]byte("<tg>"))), p.printList[3])
+		rq.Equal("  2", p.printList[4])
+		rq.Equal(string(domain.ColorizeTag([]byte("</tg>"))), p.printList[5])
+	})
+
+	t.Run("tag list", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:  "objects",
+						Index: -1,
+					},
+					{
+						Name:       "object",
+						Index:      -1,
+						Descendant: true,
+					},
+				},
+				searchType: domain.TagList,
+			},
+		}
+
+		err := p.process([]byte(`<objects><object><tg1></tg1></object><group><object><tg2 /></object></group></objects>`))
+		rq.NoError(err)
+		rq.Len(p.printList, 2)
+		rq.Equal("tg1", p.printList[0])
+		rq.Equal("tg2", p.printList[1])
+	})
+
+	t.Run("attr value with index", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:       "tg",
+						Index:      1,
+						Descendant: true,
+					},
+				},
+				searchType: domain.AttrValue,
+				attribute:  "attr",
+			},
+			index: index{
+				set: true,
+			},
+		}
+
+		err := p.process([]byte(`<objects><tg attr="1"></tg><object><tg attr="2"><tg attr="3"></tg></tg></object></objects>`))
+		rq.NoError(err)
+		rq.Len(p.printList, 1)
+		rq.Equal("2", p.printList[0])
+	})
+}
+
+// nolint lll: there are long strings on purpose
+func TestProcessWildcard(t *testing.T) {
+	t.Parallel()
+
+	t.Run("attr value", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:  "order",
+						Index: -1,
+					},
+					{
+						Name:  domain.Wildcard,
+						Index: -1,
+					},
+				},
+				searchType: domain.AttrValue,
+				attribute:  "type",
+			},
+		}
+
+		err := p.process([]byte(`<order><ShipTo type="ship"><name /></ShipTo><BillTo type="bill"></BillTo><name type="tag" /></order>`))
+		rq.NoError(err)
+		rq.Len(p.printList, 3)
+		rq.Equal("ship", p.printList[0])
+		rq.Equal("bill", p.printList[1])
+		rq.Equal("tag", p.printList[2])
+	})
+
+	t.Run("tag list with index", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{
+						Name:  "order",
+						Index: -1,
+					},
+					{
+						Name:  domain.Wildcard,
+						Index: 1,
+					},
+				},
+				searchType: domain.TagList,
+			},
+			index: index{
+				set: true,
+			},
+		}
+
+		err := p.process([]byte(`<order><ShipTo><name /></ShipTo><BillTo><street></street></BillTo></order>`))
+		rq.NoError(err)
+		rq.Len(p.printList, 1)
+		rq.Equal("street", p.printList[0])
+	})
+}
+
+// nolint lll: there are long strings on purpose
+func TestProcessNamesAndCount(t *testing.T) {
+	t.Parallel()
+
+	path := []domain.Step{
+		{Name: "shop", Index: -1},
+		{Name: domain.Wildcard, Index: -1},
+	}
+	data := `<shop><book><title /></book><magazine /><book /></shop>`
+
+	t.Run("names", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p, err := New(path, domain.Attribute{}, domain.TagName)
+		rq.NoError(err)
+
+		res := readAll(p.Process(bufio.NewReader(strings.NewReader(data))))
+		rq.Equal([]string{"book", "magazine", "book"}, res)
+	})
+
+	t.Run("count", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p, err := New(path, domain.Attribute{}, domain.TagCount)
+		rq.NoError(err)
+
+		res := readAll(p.Process(bufio.NewReader(strings.NewReader(data))))
+		rq.Equal([]string{"3"}, res)
+		rq.Empty(p.printList) // tags are counted without keeping them
+		rq.Empty(p.printOffsets)
+	})
+}
@@ -0,0 +1,145 @@
+package processor
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/tty2/xq/internal/domain"
+)
+
+const (
+	cdataStart = "<![CDATA["
+	cdataEnd   = "]]>"
+)
+
+// text keeps text of the tag matched by the query without markup of its nested tags.
+type text struct {
+	depth    int // length of the current path with the tag
+	offset   int // offset of the open tag, texts are printed in order of their tags
+	value    []byte
+	reserved bool // the text has a place in the queue before the texts of the nested tags
+}
+
+// SetText makes the processor print text records: values of the attributes are printed as text with entities decoded
+// as they are in text of the tags, and the tags without text are printed as empty values.
+func (p *Processor) SetText() {
+	p.query.text = true
+}
+
+// attributeText returns the value of the attribute as text if the processor prints text.
+func (p *Processor) attributeText(value string) string {
+	if !p.query.text {
+		return value
+	}
+
+	return domain.DecodeEntities(value)
+}
+
+// openText starts to keep text of current tag. Texts of the outer tags are printed when they are closed, but
+// before the text of current tag, so the places of these texts are reserved in the queue.
+func (p *Processor) openText() {
+	for _, t := range p.texts {
+		if !t.reserved {
+			p.reserveText(t)
+		}
+	}
+
+	p.texts = append(p.texts, &text{
+		depth:  len(p.currentPath),
+		offset: p.offset,
+	})
+}
+
+// reserveText adds the output waiting for the text of the outer tag to the queue. The output gets the state of the
+// tag path if it still waits for child filters.
+func (p *Processor) reserveText(t *text) {
+	o := output{
+		offset:  t.offset,
+		match:   p.matchCurrent,
+		waiting: true,
+	}
+	if len(p.candidates) > 0 || len(p.children) > 0 || len(p.axes) > 0 {
+		o.state = &pathState{
+			path:    append([]string{}, p.currentPath[:t.depth]...),
+			passed:  append([][]bool{}, p.currentFilters[:t.depth]...),
+			pending: append([][]bool{}, p.currentPending[:t.depth]...),
+		}
+	}
+	p.queue = append(p.queue, o)
+	t.reserved = true
+}
+
+func (p *Processor) addToTexts(s byte) {
+	for i := range p.texts {
+		p.texts[i].value = append(p.texts[i].value, s)
+	}
+}
+
+// addCDATAToTexts adds content of current tag to the texts if it's CDATA section.
+func (p *Processor) addCDATAToTexts() {
+	content := p.cdataContent()
+	for i := range content {
+		p.addToTexts(content[i])
+	}
+}
+
+// cdataContent returns content of current tag if it's CDATA section. Ampersands are escaped, so the content
+// is kept as it is when entities of the text are decoded.
+func (p *Processor) cdataContent() []byte {
+	b := p.currentTag.bytes
+	if !bytes.HasPrefix(b, []byte(cdataStart)) || !bytes.HasSuffix(b, []byte(cdataEnd)) {
+		return nil
+	}
+
+	return bytes.ReplaceAll(b[len(cdataStart):len(b)-len(cdataEnd)], []byte("&"), []byte("&amp;"))
+}
+
+// normalizeText returns the text with decoded entities and whitespaces collapsed to single spaces.
+func normalizeText(value []byte) string {
+	return domain.DecodeEntities(strings.Join(strings.Fields(string(value)), " "))
+}
+
+// closeText prints text of the tag on `depth` with whitespaces collapsed and entities decoded when the tag
+// is closed. Texts of the nested tags are separated by space.
+func (p *Processor) closeText(depth int) {
+	ln := len(p.texts)
+	if ln == 0 || p.texts[ln-1].depth != depth {
+		return
+	}
+
+	t := p.texts[ln-1]
+	p.texts = p.texts[:ln-1]
+	value := normalizeText(t.value)
+	skip := value == "" && !p.query.text // tags without text are printed only as text records
+	if t.reserved {
+		p.fillText(t.offset, p.withPath(value, ""), skip)
+
+		return
+	}
+	if skip || !p.currentPathMatch() { // child filters of the tag aren't satisfied
+		return
+	}
+	p.enqueue(output{
+		value:  p.withPath(value, ""),
+		offset: t.offset,
+		match:  p.matchCurrent,
+	})
+}
+
+// fillText sets the value of the output reserved for the text of the tag opened at `offset` or removes the output
+// if the text is skipped. Only the outputs of the nested tags follow the reserved one, so it's searched from the end.
+func (p *Processor) fillText(offset int, value string, skip bool) {
+	for i := len(p.queue) - 1; i >= 0; i-- {
+		if !p.queue[i].waiting || p.queue[i].offset != offset {
+			continue
+		}
+		if skip {
+			p.queue = append(p.queue[:i], p.queue[i+1:]...)
+		} else {
+			p.queue[i].value, p.queue[i].waiting = value, false
+		}
+
+		break
+	}
+	p.flushQueue()
+}
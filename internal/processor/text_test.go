@@ -0,0 +1,128 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tty2/xq/internal/domain"
+)
+
+// nolint lll: there are long strings on purpose
+func TestProcessText(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nested tags", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{Name: "title", Index: -1, Descendant: true},
+				},
+				searchType: domain.TagText,
+			},
+		}
+
+		err := p.process([]byte("<book><title lang=\"en\">A  <b>big</b>\n  book</title><title /><title>B</title></book>"))
+		rq.NoError(err)
+		rq.Equal([]string{"A big book", "B"}, p.printList)
+		rq.Empty(p.texts)
+	})
+
+	t.Run("child filter", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{Name: "book", Index: -1, Filters: []domain.Filter{
+						{Child: []string{"price"}, Operator: domain.FilterGreater, Value: "5"},
+					}},
+				},
+				searchType: domain.TagText,
+			},
+		}
+
+		err := p.process([]byte(`<book><title>A</title><price>10</price></book><book><title>B</title><price>1</price></book>`))
+		rq.NoError(err)
+		rq.Equal([]string{"A 10"}, p.printList)
+	})
+
+	t.Run("attributes", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		data := []byte(`<a href="x?a=1&amp;b=&#65;" c='&lt;'/>`)
+		p, err := New([]domain.Step{{Name: "a", Index: -1}}, domain.Attribute{Name: "href"}, domain.AttrValue)
+		rq.NoError(err)
+		p.SetText()
+		rq.NoError(p.process(data))
+		rq.Equal([]string{"x?a=1&b=A"}, p.printList)
+
+		p, err = New([]domain.Step{{Name: "a", Index: -1}}, domain.Attribute{Pattern: "."}, domain.AttrValue)
+		rq.NoError(err)
+		p.SetText()
+		rq.NoError(p.process(data))
+		rq.Equal([]string{"href=x?a=1&b=A", "c=<"}, p.printList)
+	})
+
+	t.Run("entities and CDATA", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		p := Processor{
+			query: query{
+				path: []domain.Step{
+					{Name: "title", Index: -1},
+				},
+				searchType: domain.TagText,
+			},
+		}
+
+		err := p.process([]byte(`<title>Tom &amp; Jerry &#169; <![CDATA[<b>1 &lt; 2</b>]]></title>`))
+		rq.NoError(err)
+		rq.Equal([]string{"Tom & Jerry © <b>1 &lt; 2</b>"}, p.printList)
+	})
+
+	t.Run("text records of nested and empty tags", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		data := []byte("<r><b>1<c/><b>2</b><b> 3 <c/></b></b><b>4</b><b><c/></b><b/></r>")
+		for _, tt := range []struct {
+			step     domain.Step
+			prefix   bool
+			expected []string
+		}{
+			{
+				step:     domain.Step{Name: "b", Index: -1, Descendant: true},
+				expected: []string{"1 2 3", "2", "3", "4", "", ""},
+			},
+			{
+				step:     domain.Step{Name: "b", Index: -1, Descendant: true},
+				prefix:   true,
+				expected: []string{".r[0].b[0]\t1 2 3", ".r[0].b[0].b[0]\t2", ".r[0].b[0].b[1]\t3", ".r[0].b[1]\t4", ".r[0].b[2]\t", ".r[0].b[3]\t"},
+			},
+			{
+				step:     domain.Step{Name: "b", Index: -1, Descendant: true, Filters: []domain.Filter{{Child: []string{"c"}, Operator: domain.FilterExists}}},
+				expected: []string{"1 2 3", "3", ""},
+			},
+		} {
+			p, err := New([]domain.Step{tt.step}, domain.Attribute{}, domain.TagText)
+			rq.NoError(err)
+			p.SetText()
+			p.SetPathOptions(PathOptions{Prefix: tt.prefix})
+			rq.NoError(p.process(data))
+			rq.NoError(p.finish())
+			rq.Equal(tt.expected, p.printList)
+			rq.Empty(p.queue)
+		}
+
+		p, err := New([]domain.Step{{Name: "b", Index: -1, Descendant: true}}, domain.Attribute{}, domain.TagText)
+		rq.NoError(err)
+		rq.NoError(p.process(data))
+		rq.Equal([]string{"1 2 3", "2", "3", "4"}, p.printList, "values aren't text records")
+	})
+}
@@ -0,0 +1,168 @@
+package processor
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/tty2/xq/internal/domain"
+)
+
+// Union processes the data by several processors in one pass and prints their results in document order.
+type Union struct {
+	processors []*Processor
+	sent       []int // number of values of every processor print list sent to the output
+	count      int   // number of the tags matched by any processor if tags are counted
+	counted    int   // offset of the last counted tag
+	err        error // error the processing stopped with
+}
+
+// NewUnion creates a new Union of the processors.
+func NewUnion(processors ...*Processor) *Union {
+	return &Union{
+		processors: processors,
+		sent:       make([]int, len(processors)),
+	}
+}
+
+// Process reads the data from `r` reader and processes it by all the processors.
+func (u *Union) Process(r *bufio.Reader) chan string {
+	buf := make([]byte, 0, 4*1024)
+	ch := make(chan string)
+
+	go func() {
+		defer close(ch)
+		for {
+			n, err := r.Read(buf[:cap(buf)])
+			if err != nil {
+				if err == io.EOF {
+					for _, p := range u.processors {
+						if p.stop {
+							continue
+						}
+						u.err = p.finish()
+						if u.err != nil {
+							return
+						}
+					}
+
+					break
+				}
+				u.err = err
+
+				return
+			}
+
+			buf = buf[:n]
+
+			err = u.process(buf)
+			if err != nil {
+				u.err = err
+
+				return
+			}
+
+			u.send(ch, u.settled())
+
+			if u.stopped() {
+				break
+			}
+		}
+
+		u.send(ch, math.MaxInt)
+		if u.counting() {
+			ch <- strconv.Itoa(u.count)
+		}
+	}()
+
+	return ch
+}
+
+// Err returns the error the processing stopped with. It's known when the channel returned by `Process` is closed.
+func (u *Union) Err() error {
+	return u.err
+}
+
+func (u *Union) process(chunk []byte) error {
+	for _, p := range u.processors {
+		if p.stop {
+			continue
+		}
+
+		err := p.process(chunk)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// send puts the values found before `limit` offset to `ch` in order of their offsets.
+func (u *Union) send(ch chan string, limit int) {
+	for {
+		next := -1
+		for i, p := range u.processors {
+			if u.sent[i] == len(p.printOffsets) {
+				continue
+			}
+			if next == -1 || p.printOffsets[u.sent[i]] < u.processors[next].printOffsets[u.sent[next]] {
+				next = i
+			}
+		}
+
+		if next == -1 || u.processors[next].printOffsets[u.sent[next]] >= limit {
+			u.trimCounted()
+
+			return
+		}
+
+		p := u.processors[next]
+
+		if !u.counting() {
+			ch <- p.printList[u.sent[next]]
+		} else if offset := p.printOffsets[u.sent[next]]; offset != u.counted { // tag matched by several paths
+			u.count++
+			u.counted = offset
+		}
+		u.sent[next]++
+	}
+}
+
+// trimCounted drops the offsets of the counted tags, only the number of them is kept.
+func (u *Union) trimCounted() {
+	if !u.counting() {
+		return
+	}
+	for i, p := range u.processors {
+		p.printOffsets = p.printOffsets[u.sent[i]:]
+		u.sent[i] = 0
+	}
+}
+
+// settled returns the offset all the processors found their values before.
+func (u *Union) settled() int {
+	limit := math.MaxInt
+	for _, p := range u.processors {
+		if s := p.settled(); s < limit {
+			limit = s
+		}
+	}
+
+	return limit
+}
+
+func (u *Union) counting() bool {
+	return len(u.processors) > 0 && u.processors[0].query.searchType == domain.TagCount
+}
+
+func (u *Union) stopped() bool {
+	for _, p := range u.processors {
+		if !p.stop {
+			return false
+		}
+	}
+
+	return true
+}
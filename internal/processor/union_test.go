@@ -0,0 +1,106 @@
+package processor
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tty2/xq/internal/domain"
+)
+
+func readAll(ch chan string) []string {
+	var res []string
+	for line := range ch {
+		res = append(res, line)
+	}
+
+	return res
+}
+
+// nolint lll: there are long strings on purpose
+func TestUnionProcess(t *testing.T) {
+	t.Parallel()
+
+	t.Run("document order", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		lang, err := New([]domain.Step{
+			{Name: "objects", Index: -1},
+			{Name: "object", Index: -1},
+			{Name: "title", Index: -1},
+		}, domain.Attribute{Name: "lang"}, domain.AttrValue)
+		rq.NoError(err)
+		id, err := New([]domain.Step{
+			{Name: "objects", Index: -1},
+			{Name: "object", Index: -1},
+			{Name: "c", Index: -1},
+		}, domain.Attribute{Name: "id"}, domain.AttrValue)
+		rq.NoError(err)
+
+		u := NewUnion(lang, id)
+		res := readAll(u.Process(bufio.NewReader(iotest.OneByteReader(strings.NewReader(
+			`<objects><object><title lang="EN" /><c id="1" /></object><object><c id="2" /><title lang="RU" /></object></objects>`)))))
+		rq.Equal([]string{"EN", "1", "2", "RU"}, res)
+	})
+
+	t.Run("count tags once", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		all, err := New([]domain.Step{
+			{Name: "c", Index: -1, Descendant: true},
+		}, domain.Attribute{}, domain.TagCount)
+		rq.NoError(err)
+		first, err := New([]domain.Step{
+			{Name: "objects", Index: -1},
+			{Name: "object", Index: -1},
+			{Name: "c", Index: -1},
+		}, domain.Attribute{}, domain.TagCount)
+		rq.NoError(err)
+
+		u := NewUnion(all, first)
+		res := readAll(u.Process(bufio.NewReader(iotest.OneByteReader(strings.NewReader(
+			`<objects><object><c /><d><c /></d></object><object><c /></object></objects>`)))))
+		rq.Equal([]string{"3"}, res)
+	})
+
+	t.Run("waiting values keep the order", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		last, err := New([]domain.Step{
+			{Name: "objects", Index: -1},
+			{Name: "object", Index: -1, Slice: &domain.Slice{Start: -1, Step: 1}},
+		}, domain.Attribute{Name: "id"}, domain.AttrValue)
+		rq.NoError(err)
+		c, err := New([]domain.Step{
+			{Name: "objects", Index: -1},
+			{Name: "object", Index: -1},
+			{Name: "c", Index: -1},
+		}, domain.Attribute{Name: "id"}, domain.AttrValue)
+		rq.NoError(err)
+
+		u := NewUnion(last, c)
+		res := readAll(u.Process(bufio.NewReader(iotest.OneByteReader(strings.NewReader(
+			`<objects><object id="a"><c id="1" /></object><object id="b"><c id="2" /></object></objects>`)))))
+		rq.Equal([]string{"1", "b", "2"}, res)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		a, err := New([]domain.Step{{Name: "a", Index: -1}}, domain.Attribute{}, domain.TagList)
+		rq.NoError(err)
+		b, err := New([]domain.Step{{Name: "b", Index: -1}}, domain.Attribute{}, domain.TagList)
+		rq.NoError(err)
+
+		u := NewUnion(a, b)
+		res := readAll(u.Process(bufio.NewReader(strings.NewReader(`<a><c></d></a>`))))
+		rq.Empty(res) // the error isn't a value
+		rq.EqualError(u.Err(), "incorrect xml structure: the last open tag is `c`, but close tag is `d`")
+	})
+}
@@ -0,0 +1,247 @@
+/*
+Package query parses queries into syntax trees.
+*/
+package query
+
+import (
+	"github.com/tty2/xq/internal/domain"
+)
+
+type (
+	// Node is a node of the query syntax tree.
+	Node interface {
+		node()
+	}
+
+	// Pipe is a sequence of queries where every next one is evaluated against the tags matched by the previous one:
+	// `.objects.object | .title#lang`.
+	Pipe struct {
+		Stages []Node
+	}
+
+	// Union is a set of queries evaluated at once: `.a.b, .a.c#id`.
+	Union struct {
+		Branches []Node
+	}
+
+	// Path selects tags by the steps and attributes of the tags if they are set: `.objects.object.title#lang`.
+	// Path without steps is the root or the tag matched by the previous pipe stage.
+	Path struct {
+		Steps     []domain.Step
+		Attribute domain.Attribute
+		axis      int // offset of the axis step in the query if one of the steps has axis
+	}
+
+	// Select keeps the tags matched by the previous pipe stage which satisfy the condition:
+	// `.Items.Item | select(.Quantity > 1 and .USPrice < 100)`.
+	Select struct {
+		Condition domain.Condition
+	}
+
+	// Call applies the function to the tags selected by the argument: `count(.objects.object)`.
+	// Functions grouping tags have the key relative to every tag: `group_by(.objects.object; .title#lang)`.
+	// Function applied to every group after `group_by` has no argument if it counts tags: `| count`.
+	Call struct {
+		Function string
+		Argument Node
+		Key      Node
+	}
+
+	// Order reorders the tags matched by the previous pipe stages. Functions ordering tags by the key have the key
+	// relative to every tag: `.objects.object | sort_by(.title#lang) | reverse`.
+	Order struct {
+		Function string
+		Key      Node
+	}
+
+	// Edit modifies text of the tags or value of the attribute selected by the target, deletes them or inserts
+	// the markup around or into the tags, the rest of the document is kept as it is:
+	// `.objects.object[0].title = "New"`, `.objects.object.poster#url |= sub("http:"; "https:")`,
+	// `del(.objects.object.poster)`, `.objects += <object/>`.
+	Edit struct {
+		Operator  domain.EditOperator
+		Target    Node
+		Value     string            // value set by `=` or the inserted markup
+		Functions []domain.Function // string functions applied to the value by `|=`
+	}
+
+	// Transform applies the string function to every value selected by the previous pipe stages:
+	// `.objects.object.title#lang | ascii_downcase`.
+	Transform struct {
+		Function domain.Function
+	}
+)
+
+func (Pipe) node()      {}
+func (Union) node()     {}
+func (Path) node()      {}
+func (Select) node()    {}
+func (Call) node()      {}
+func (Order) node()     {}
+func (Edit) node()      {}
+func (Transform) node() {}
+
+// Paths returns all the paths the query selects by. Paths of pipe stages are joined, so every path of the next
+// stage is relative to the tags matched by every path of the previous one.
+func Paths(n Node) []Path {
+	switch n := n.(type) {
+	case Path:
+		return []Path{n}
+	case Call:
+		return Paths(n.Argument)
+	case Edit:
+		return Paths(n.Target)
+	case Union:
+		var paths []Path
+		for i := range n.Branches {
+			paths = append(paths, Paths(n.Branches[i])...)
+		}
+
+		return paths
+	case Pipe:
+		if call, ok := n.Stages[0].(Call); ok { // the next stages are applied to the values of the function
+			return Paths(call)
+		}
+
+		paths := []Path{{
+			Steps: []domain.Step{},
+		}}
+		for i := range n.Stages {
+			switch n.Stages[i].(type) {
+			case Transform, Order:
+				continue
+			}
+			if sel, ok := n.Stages[i].(Select); ok {
+				for j := range paths {
+					paths[j] = paths[j].filter(sel.Condition)
+				}
+
+				continue
+			}
+
+			var next []Path
+			for _, stage := range Paths(n.Stages[i]) {
+				for j := range paths {
+					next = append(next, paths[j].join(stage))
+				}
+			}
+			paths = next
+		}
+
+		return paths
+	}
+
+	return nil
+}
+
+// Transforms returns the string functions applied to the values selected by the query.
+func Transforms(n Node) []domain.Function {
+	pipe, ok := n.(Pipe)
+	if !ok {
+		return nil
+	}
+
+	var functions []domain.Function
+	for i := range pipe.Stages {
+		if t, ok := pipe.Stages[i].(Transform); ok {
+			functions = append(functions, t.Function)
+		}
+	}
+
+	return functions
+}
+
+// Orders returns the functions reordering the tags matched by the query.
+func Orders(n Node) []Order {
+	pipe, ok := n.(Pipe)
+	if !ok {
+		return nil
+	}
+
+	var orders []Order
+	for i := range pipe.Stages {
+		if o, ok := pipe.Stages[i].(Order); ok {
+			orders = append(orders, o)
+		}
+	}
+
+	return orders
+}
+
+// Function returns the function applied to the tags selected by the query if it's set: `count(.a) | join(",")`.
+func Function(n Node) (Call, bool) {
+	if pipe, ok := n.(Pipe); ok {
+		n = pipe.Stages[0]
+	}
+	call, ok := n.(Call)
+
+	return call, ok
+}
+
+// Modification returns the modification of the document if the query sets it: `.a.b#id |= ascii_upcase`,
+// `del(.a.b)`, `wrap(.a.b; <c/>)`.
+func Modification(n Node) (Edit, bool) {
+	edit, ok := n.(Edit)
+
+	return edit, ok
+}
+
+// Aggregation returns the function applied to every group of `group_by` if it's set:
+// `group_by(.objects.object; .title#lang) | count`.
+func Aggregation(n Node) (Call, bool) {
+	pipe, ok := n.(Pipe)
+	if !ok || len(pipe.Stages) < 2 {
+		return Call{}, false
+	}
+	call, ok := pipe.Stages[1].(Call)
+
+	return call, ok
+}
+
+// join returns path with steps of `p` followed by steps of `next`.
+func (p Path) join(next Path) Path {
+	axis := p.axis
+	if hasAxis(next.Steps) {
+		axis = next.axis
+	}
+
+	return Path{
+		Steps:     append(append([]domain.Step{}, p.Steps...), next.Steps...),
+		Attribute: next.Attribute,
+		axis:      axis,
+	}
+}
+
+// hasAxis checks if one of the steps selects tags by an axis other than child.
+func hasAxis(steps []domain.Step) bool {
+	for i := range steps {
+		if steps[i].Axis != domain.AxisChild {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filter returns path which last step selects the tags satisfying the condition as well.
+func (p Path) filter(condition domain.Condition) Path {
+	steps := append([]domain.Step{}, p.Steps...)
+	if len(steps) == 0 {
+		return p
+	}
+
+	last := &steps[len(steps)-1]
+	if last.Condition != nil {
+		condition = domain.Condition{
+			Operator: domain.ConditionAnd,
+			Operands: []domain.Condition{*last.Condition, condition},
+		}
+	}
+	last.Condition = &condition
+
+	return Path{
+		Steps:     steps,
+		Attribute: p.Attribute,
+		axis:      p.axis,
+	}
+}
@@ -0,0 +1,113 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tty2/xq/internal/domain"
+)
+
+func names(p Path) []string {
+	res := make([]string, 0, len(p.Steps))
+	for i := range p.Steps {
+		res = append(res, p.Steps[i].Name)
+	}
+
+	return res
+}
+
+func TestPaths(t *testing.T) {
+	t.Parallel()
+
+	t.Run("path", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse(".a.b#id")
+		rq.NoError(err)
+
+		paths := Paths(n)
+		rq.Len(paths, 1)
+		rq.Equal([]string{"a", "b"}, names(paths[0]))
+		rq.Equal("id", paths[0].Attribute.Name)
+	})
+
+	t.Run("pipe", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse(".a[@re=~'a|b'] | ..b | .c#id")
+		rq.NoError(err)
+
+		paths := Paths(n)
+		rq.Len(paths, 1)
+		rq.Equal([]string{"a", "b", "c"}, names(paths[0]))
+		rq.True(paths[0].Steps[1].Descendant)
+		rq.False(paths[0].Steps[2].Descendant)
+		rq.Equal("id", paths[0].Attribute.Name)
+	})
+
+	t.Run("pipe to identity", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse(".a.b | .")
+		rq.NoError(err)
+
+		paths := Paths(n)
+		rq.Len(paths, 1)
+		rq.Equal([]string{"a", "b"}, names(paths[0]))
+	})
+
+	t.Run("pipe with union", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse(".a, .b | .c, .d#id")
+		rq.NoError(err)
+
+		paths := Paths(n)
+		rq.Len(paths, 4)
+		rq.Equal([]string{"a", "c"}, names(paths[0]))
+		rq.Equal([]string{"b", "c"}, names(paths[1]))
+		rq.Equal([]string{"a", "d"}, names(paths[2]))
+		rq.Equal([]string{"b", "d"}, names(paths[3]))
+		rq.Empty(paths[1].Attribute)
+		rq.Equal("id", paths[3].Attribute.Name)
+	})
+
+	t.Run("steps aren't shared", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse(".a | .b, .c")
+		rq.NoError(err)
+
+		paths := Paths(n)
+		rq.Len(paths, 2)
+		paths[0].Steps[0].Index = 5
+		rq.Equal(-1, paths[1].Steps[0].Index)
+	})
+	t.Run("select", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse(".a, .b | select(@x) | select(.c > 1) | .d")
+		rq.NoError(err)
+
+		paths := Paths(n)
+		rq.Len(paths, 2)
+		rq.Equal([]string{"a", "d"}, names(paths[0]))
+		rq.Equal([]string{"b", "d"}, names(paths[1]))
+		rq.Nil(paths[0].Steps[1].Condition)
+
+		cond := paths[1].Steps[0].Condition
+		rq.NotNil(cond)
+		rq.Equal(domain.ConditionAnd, cond.Operator)
+		rq.Equal([]domain.Filter{
+			{Attribute: "x", Operator: domain.FilterExists},
+			{Child: []string{"c"}, Operator: domain.FilterGreater, Value: "1"},
+		}, cond.Filters())
+		rq.Equal(paths[0].Steps[0].Condition, paths[1].Steps[0].Condition)
+	})
+}
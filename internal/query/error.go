@@ -0,0 +1,35 @@
+package query
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Error is a syntax error of the query or of the library.
+type Error struct {
+	File    string // file of the library, if it's known
+	Line    int    // line of the library the error is found at, starting from 1, or 0 for the query
+	Column  int    // number of the symbol the error is found at in the query or in the line, starting from 1
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("column %d: %s", e.Column, e.Message)
+	}
+
+	msg := fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+	if e.File == "" {
+		return msg
+	}
+
+	return fmt.Sprintf("library %s: %s", e.File, msg)
+}
+
+// newError creates an error found at byte `offset` of the query `src`.
+func newError(src string, offset int, format string, args ...interface{}) *Error {
+	return &Error{
+		Column:  utf8.RuneCountInString(src[:offset]) + 1,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
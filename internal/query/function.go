@@ -0,0 +1,92 @@
+package query
+
+import "github.com/tty2/xq/internal/domain"
+
+// Functions which can be applied to the tags selected by the query.
+const (
+	FunctionCount  = "count"  // number of the tags
+	FunctionLength = "length" // the same as count
+	FunctionName   = "name"   // names of the tags
+	FunctionText   = "text"   // text of the tags without nested tags markup
+	FunctionKeys   = "keys"   // names of the child tags
+	FunctionAttrs  = "attrs"  // names of the attributes
+	FunctionSum    = "sum"    // sum of the numbers
+	FunctionAvg    = "avg"    // average of the numbers
+	FunctionMin    = "min"    // the least value
+	FunctionMax    = "max"    // the greatest value
+	// groups of the tags by the key: `group_by(.objects.object; .title#lang) | count`
+	FunctionGroupBy = "group_by"
+	// the first tag of every group: `unique_by(.objects.object; .title#lang)`
+	FunctionUniqueBy = "unique_by"
+)
+
+func isFunction(name string) bool {
+	switch name {
+	case FunctionCount, FunctionLength, FunctionName, FunctionText, FunctionKeys, FunctionAttrs, FunctionSum,
+		FunctionAvg, FunctionMin, FunctionMax, FunctionGroupBy, FunctionUniqueBy:
+		return true
+	}
+
+	return false
+}
+
+// Functions which reorder the tags matched by the previous pipe stages: `.objects.object | sort_by(.title#lang)`.
+// `unique_by` applied as pipe stage keeps the first tag of every key ordered by the key: `| unique_by(.title#lang)`.
+const (
+	FunctionSortBy  = "sort_by" // tags ordered by the key
+	FunctionReverse = "reverse" // tags in reverse order
+	FunctionUnique  = "unique"  // tags without duplicates
+)
+
+// isOrder checks if the function reorders tags. Functions ordering by the key take it in parentheses.
+func isOrder(name string, withKey bool) bool {
+	switch name {
+	case FunctionSortBy, FunctionUniqueBy:
+		return withKey
+	case FunctionReverse, FunctionUnique:
+		return !withKey
+	}
+
+	return false
+}
+
+// takesKey checks if the function groups tags by the key set as the second argument.
+func takesKey(name string) bool {
+	return name == FunctionGroupBy || name == FunctionUniqueBy
+}
+
+// isAggregation checks if the function can be applied to every group of `group_by`: `| count`, `| sum(.USPrice)`.
+func isAggregation(name string) bool {
+	switch name {
+	case FunctionCount, FunctionLength, FunctionSum, FunctionAvg, FunctionMin, FunctionMax:
+		return true
+	}
+
+	return false
+}
+
+// Keywords of `select` condition.
+const (
+	keywordSelect = "select"
+	keywordAnd    = "and"
+	keywordOr     = "or"
+	keywordNot    = "not"
+)
+
+// editFunction returns the operator of the function modifying the document: `del(.a.b#id)`, `wrap(.a.b; <c/>)`.
+func editFunction(s string) (domain.EditOperator, bool) {
+	for _, op := range []domain.EditOperator{
+		domain.EditDelete, domain.EditBefore, domain.EditAfter, domain.EditWrap, domain.EditUnwrap,
+	} {
+		if s == op.String() {
+			return op, true
+		}
+	}
+
+	return 0, false
+}
+
+// takesMarkup checks if the operator inserts the markup set as its value.
+func takesMarkup(op domain.EditOperator) bool {
+	return op == domain.EditAppend || op == domain.EditBefore || op == domain.EditAfter || op == domain.EditWrap
+}
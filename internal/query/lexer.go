@@ -0,0 +1,463 @@
+package query
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tty2/xq/internal/domain/symbol"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF          tokenKind = iota
+	tokenDot                    // .
+	tokenDotDot                 // ..
+	tokenName                   // tag
+	tokenNumber                 // 10, -1.5
+	tokenString                 // 'value', "value"
+	tokenStar                   // *
+	tokenAt                     // @
+	tokenHash                   // #
+	tokenColon                  // :
+	tokenComma                  // ,
+	tokenPipe                   // |
+	tokenOpenBracket            // [
+	tokenCloseBracket           // ]
+	tokenOperator               // =, ==, !=, =~, <, <=, >, >=
+	tokenNamespace              // {uri}
+	tokenCaret                  // ^
+	tokenRegexp                 // /regexp/
+	tokenOpenParen              // (
+	tokenCloseParen             // )
+	tokenSemicolon              // ;
+	tokenVariable               // $name
+	tokenUpdate                 // |=
+	tokenAppend                 // +=
+	tokenMarkup                 // <tag>text</tag>
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokenEOF:
+		return "end of query"
+	case tokenDot:
+		return "`.`"
+	case tokenDotDot:
+		return "`..`"
+	case tokenName:
+		return "name"
+	case tokenNumber:
+		return "number"
+	case tokenString:
+		return "string"
+	case tokenStar:
+		return "`*`"
+	case tokenAt:
+		return "`@`"
+	case tokenHash:
+		return "`#`"
+	case tokenColon:
+		return "`:`"
+	case tokenComma:
+		return "`,`"
+	case tokenPipe:
+		return "`|`"
+	case tokenOpenBracket:
+		return "`[`"
+	case tokenCloseBracket:
+		return "`]`"
+	case tokenOperator:
+		return "operator"
+	case tokenNamespace:
+		return "namespace"
+	case tokenCaret:
+		return "`^`"
+	case tokenRegexp:
+		return "regular expression"
+	case tokenOpenParen:
+		return "`(`"
+	case tokenCloseParen:
+		return "`)`"
+	case tokenSemicolon:
+		return "`;`"
+	case tokenVariable:
+		return "variable"
+	case tokenUpdate:
+		return "`|=`"
+	case tokenAppend:
+		return "`+=`"
+	case tokenMarkup:
+		return "markup"
+	}
+
+	return "unknown token"
+}
+
+type token struct {
+	kind  tokenKind
+	value string // name, number, unquoted string, operator or name of variable
+	pos   int    // byte offset in the query
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenName, tokenNumber, tokenOperator:
+		return "`" + t.value + "`"
+	case tokenNamespace:
+		return "namespace `{" + t.value + "}`"
+	case tokenString:
+		return "string '" + t.value + "'"
+	case tokenRegexp:
+		return "regular expression `/" + t.value + "/`"
+	case tokenVariable:
+		return "variable `$" + t.value + "`"
+	case tokenMarkup:
+		return "markup `" + t.value + "`"
+	case tokenEOF, tokenDot, tokenDotDot, tokenStar, tokenAt, tokenHash, tokenColon, tokenComma, tokenPipe,
+		tokenOpenBracket, tokenCloseBracket, tokenCaret, tokenOpenParen, tokenCloseParen, tokenSemicolon,
+		tokenUpdate, tokenAppend:
+	}
+
+	return t.kind.String()
+}
+
+type lexer struct {
+	src    string
+	pos    int
+	tokens []token
+}
+
+// lex splits the query into tokens. The last token is always `tokenEOF`.
+func lex(src string) ([]token, error) {
+	l := lexer{
+		src: src,
+	}
+
+	for l.pos < len(l.src) {
+		err := l.next()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return append(l.tokens, token{kind: tokenEOF, pos: len(src)}), nil
+}
+
+func (l *lexer) next() error {
+	c := l.src[l.pos]
+	switch {
+	case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		l.pos++
+	case c == '.':
+		if l.pos+1 < len(l.src) && l.src[l.pos+1] == '.' {
+			l.emit(tokenDotDot, 2)
+		} else {
+			l.emit(tokenDot, 1)
+		}
+	case c == '*':
+		l.emit(tokenStar, 1)
+	case c == '@':
+		l.emit(tokenAt, 1)
+	case c == '#':
+		l.emit(tokenHash, 1)
+	case c == ':':
+		l.emit(tokenColon, 1)
+	case c == ',':
+		l.emit(tokenComma, 1)
+	case c == '|':
+		if l.pos+1 < len(l.src) && l.src[l.pos+1] == '=' {
+			l.emit(tokenUpdate, 2)
+		} else {
+			l.emit(tokenPipe, 1)
+		}
+	case c == '^':
+		l.emit(tokenCaret, 1)
+	case c == '[':
+		l.emit(tokenOpenBracket, 1)
+	case c == ']':
+		l.emit(tokenCloseBracket, 1)
+	case c == '(':
+		l.emit(tokenOpenParen, 1)
+	case c == ')':
+		l.emit(tokenCloseParen, 1)
+	case c == ';':
+		l.emit(tokenSemicolon, 1)
+	case c == '<' && l.isMarkupStart():
+		return l.markup()
+	case c == '+' && l.pos+1 < len(l.src) && l.src[l.pos+1] == '=':
+		l.emit(tokenAppend, 2)
+	case c == '=' || c == '!' || c == '<' || c == '>':
+		return l.operator()
+	case symbol.IsQuote(c):
+		return l.string()
+	case c == '/':
+		return l.regexp()
+	case c == '{':
+		return l.namespace()
+	case c == '$':
+		return l.variable()
+	case isDigit(c) || c == '-' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1]):
+		l.number()
+	default:
+		r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+		if !isNameStart(r) {
+			return newError(l.src, l.pos, "unexpected symbol `%c`", r)
+		}
+		l.name()
+	}
+
+	return nil
+}
+
+func (l *lexer) emit(kind tokenKind, size int) {
+	l.tokens = append(l.tokens, token{
+		kind:  kind,
+		value: l.src[l.pos : l.pos+size],
+		pos:   l.pos,
+	})
+	l.pos += size
+}
+
+func (l *lexer) operator() error {
+	size := 1
+	if l.pos+1 < len(l.src) {
+		switch l.src[l.pos : l.pos+2] {
+		case "==", "!=", "=~", "<=", ">=":
+			size = 2
+		}
+	}
+
+	if size == 1 && l.src[l.pos] == '!' {
+		return newError(l.src, l.pos, "unexpected symbol `!`")
+	}
+
+	l.emit(tokenOperator, size)
+
+	return nil
+}
+
+// string reads quoted string. Backslash escapes the quote and backslash itself, other symbols after backslash
+// are kept as is, so regular expressions don't need double escaping: `'^\d+'`.
+func (l *lexer) string() error {
+	quote := l.src[l.pos]
+	var sb strings.Builder
+	for i := l.pos + 1; i < len(l.src); i++ {
+		switch l.src[i] {
+		case '\\':
+			if i+1 < len(l.src) && (l.src[i+1] == quote || l.src[i+1] == '\\') {
+				i++
+			}
+		case quote:
+			l.tokens = append(l.tokens, token{
+				kind:  tokenString,
+				value: sb.String(),
+				pos:   l.pos,
+			})
+			l.pos = i + 1
+
+			return nil
+		}
+		sb.WriteByte(l.src[i])
+	}
+
+	return newError(l.src, l.pos, "string isn't closed")
+}
+
+// regexp reads regular expression between slashes: `/^data-/`. Backslash escapes the slash, other symbols
+// after backslash are kept as is.
+func (l *lexer) regexp() error {
+	var sb strings.Builder
+	for i := l.pos + 1; i < len(l.src); i++ {
+		switch l.src[i] {
+		case '\\':
+			if i+1 < len(l.src) && l.src[i+1] == '/' {
+				i++
+			}
+		case '/':
+			l.tokens = append(l.tokens, token{
+				kind:  tokenRegexp,
+				value: sb.String(),
+				pos:   l.pos,
+			})
+			l.pos = i + 1
+
+			return nil
+		}
+		sb.WriteByte(l.src[i])
+	}
+
+	return newError(l.src, l.pos, "regular expression isn't closed")
+}
+
+// namespace reads namespace URI of the step: `{http://schemas.xmlsoap.org/soap/envelope/}`.
+func (l *lexer) namespace() error {
+	end := strings.IndexByte(l.src[l.pos:], '}')
+	if end == -1 {
+		return newError(l.src, l.pos, "namespace isn't closed")
+	}
+
+	l.tokens = append(l.tokens, token{
+		kind:  tokenNamespace,
+		value: l.src[l.pos+1 : l.pos+end],
+		pos:   l.pos,
+	})
+	l.pos += end + 1
+
+	return nil
+}
+
+// variable reads name of variable after dollar sign: `$id`, `$ENV`.
+func (l *lexer) variable() error {
+	end := l.pos + 1
+	for end < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[end:])
+		if !isNameStart(r) && !isDigit(l.src[end]) {
+			break
+		}
+		end += size
+	}
+	if end == l.pos+1 || isDigit(l.src[l.pos+1]) {
+		return newError(l.src, l.pos, "variable name is expected after `$`")
+	}
+
+	l.tokens = append(l.tokens, token{
+		kind:  tokenVariable,
+		value: l.src[l.pos+1 : end],
+		pos:   l.pos,
+	})
+	l.pos = end
+
+	return nil
+}
+
+// isMarkupStart checks if `<` starts markup inserted into the document. Markup follows `+=` or `;` separating it
+// from the path: `.a += <b/>`, `wrap(.a; <b/>)`.
+func (l *lexer) isMarkupStart() bool {
+	if len(l.tokens) == 0 {
+		return false
+	}
+	k := l.tokens[len(l.tokens)-1].kind
+
+	return k == tokenAppend || k == tokenSemicolon
+}
+
+// markup reads the tags with their text: `<c id="1">x</c><d/>`. The markup ends after the close tag of the last
+// tag which isn't followed by another one.
+func (l *lexer) markup() error {
+	var names []string
+	i := l.pos
+	for i < len(l.src) {
+		if l.src[i] != symbol.OpenBracket {
+			if len(names) == 0 {
+				break
+			}
+			i++
+
+			continue
+		}
+
+		end := tagEnd(l.src, i)
+		if end == -1 {
+			return newError(l.src, i, "tag isn't closed")
+		}
+		tag := l.src[i : end+1]
+		switch {
+		case strings.HasPrefix(tag, "</"):
+			name := strings.TrimSpace(tag[2 : len(tag)-1])
+			if len(names) == 0 || names[len(names)-1] != name {
+				return newError(l.src, i, "unexpected close tag `%s`", tag)
+			}
+			names = names[:len(names)-1]
+		case strings.HasSuffix(tag, "/>"), strings.HasPrefix(tag, "<!"), strings.HasPrefix(tag, "<?"):
+		default:
+			names = append(names, strings.FieldsFunc(tag[1:len(tag)-1], unicode.IsSpace)[0])
+		}
+		i = end + 1
+
+		if len(names) > 0 {
+			continue
+		}
+		next := i
+		for next < len(l.src) && unicode.IsSpace(rune(l.src[next])) {
+			next++
+		}
+		if next == len(l.src) || l.src[next] != symbol.OpenBracket {
+			break
+		}
+		i = next
+	}
+	if len(names) > 0 {
+		return newError(l.src, l.pos, "tag `%s` isn't closed", names[len(names)-1])
+	}
+
+	l.tokens = append(l.tokens, token{
+		kind:  tokenMarkup,
+		value: l.src[l.pos:i],
+		pos:   l.pos,
+	})
+	l.pos = i
+
+	return nil
+}
+
+// tagEnd returns index of `>` closing the tag which starts at index `start`. Quoted values of the attributes can
+// contain `>`.
+func tagEnd(src string, start int) int {
+	var quote byte
+	for i := start + 1; i < len(src); i++ {
+		switch {
+		case quote != 0:
+			if src[i] == quote {
+				quote = 0
+			}
+		case symbol.IsQuote(src[i]):
+			quote = src[i]
+		case src[i] == symbol.CloseBracket:
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (l *lexer) number() {
+	end := l.pos + 1
+	for end < len(l.src) && isDigit(l.src[end]) {
+		end++
+	}
+	if end+1 < len(l.src) && l.src[end] == '.' && isDigit(l.src[end+1]) {
+		end++
+		for end < len(l.src) && isDigit(l.src[end]) {
+			end++
+		}
+	}
+
+	l.emit(tokenNumber, end-l.pos)
+}
+
+// name reads tag or attribute name. Colon is a part of the name (`ns:tag`) unless it's doubled.
+func (l *lexer) name() {
+	end := l.pos
+	for end < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[end:])
+		if r == ':' && (end+1 == len(l.src) || l.src[end+1] == ':') {
+			break
+		}
+		if !isNameStart(r) && !isDigit(l.src[end]) && r != '-' && r != ':' {
+			break
+		}
+		end += size
+	}
+
+	l.emit(tokenName, end-l.pos)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
@@ -0,0 +1,171 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func kinds(tokens []token) []tokenKind {
+	res := make([]tokenKind, 0, len(tokens))
+	for i := range tokens {
+		res = append(res, tokens[i].kind)
+	}
+
+	return res
+}
+
+func TestLex(t *testing.T) {
+	t.Parallel()
+
+	t.Run("path", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		tokens, err := lex("..a.*[-1:2]#id")
+		rq.NoError(err)
+		rq.Equal([]tokenKind{
+			tokenDotDot, tokenName, tokenDot, tokenStar, tokenOpenBracket, tokenNumber, tokenColon, tokenNumber,
+			tokenCloseBracket, tokenHash, tokenName, tokenEOF,
+		}, kinds(tokens))
+		rq.Equal("-1", tokens[5].value)
+		rq.Equal(6, tokens[5].pos)
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		tokens, err := lex(`[@a!="x y"][b.c>=1.5]`)
+		rq.NoError(err)
+		rq.Equal([]tokenKind{
+			tokenOpenBracket, tokenAt, tokenName, tokenOperator, tokenString, tokenCloseBracket,
+			tokenOpenBracket, tokenName, tokenDot, tokenName, tokenOperator, tokenNumber, tokenCloseBracket, tokenEOF,
+		}, kinds(tokens))
+		rq.Equal("!=", tokens[3].value)
+		rq.Equal("x y", tokens[4].value)
+		rq.Equal(">=", tokens[10].value)
+		rq.Equal("1.5", tokens[11].value)
+	})
+
+	t.Run("names", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		tokens, err := lex("ns:tag-1 имя a::b")
+		rq.NoError(err)
+		rq.Equal([]tokenKind{
+			tokenName, tokenName, tokenName, tokenColon, tokenColon, tokenName, tokenEOF,
+		}, kinds(tokens))
+		rq.Equal("ns:tag-1", tokens[0].value)
+		rq.Equal("имя", tokens[1].value)
+		rq.Equal("a", tokens[2].value)
+	})
+
+	t.Run("escaped strings", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, expected := range map[string]string{
+			`"config.v2"`:  "config.v2",
+			`"say \"hi\""`: `say "hi"`,
+			`'it\'s'`:      "it's",
+			`'a\\b'`:       `a\b`,
+			`'^\d+\.'`:     `^\d+\.`,
+			`"it\'s"`:      `it\'s`,
+		} {
+			tokens, err := lex(s)
+			rq.NoError(err, s)
+			rq.Equal([]tokenKind{tokenString, tokenEOF}, kinds(tokens), s)
+			rq.Equal(expected, tokens[0].value, s)
+		}
+	})
+
+	t.Run("regular expressions", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, expected := range map[string]string{
+			`/^data-/`: "^data-",
+			`/a\/b/`:   "a/b",
+			`/^\d+$/`:  `^\d+$`,
+			`/[#.,|]/`: "[#.,|]",
+		} {
+			tokens, err := lex(s)
+			rq.NoError(err, s)
+			rq.Equal([]tokenKind{tokenRegexp, tokenEOF}, kinds(tokens), s)
+			rq.Equal(expected, tokens[0].value, s)
+		}
+	})
+
+	t.Run("variables", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		tokens, err := lex("[@id=$id_2]|sub($ENV.HOME;'')")
+		rq.NoError(err)
+		rq.Equal([]tokenKind{
+			tokenOpenBracket, tokenAt, tokenName, tokenOperator, tokenVariable, tokenCloseBracket, tokenPipe, tokenName,
+			tokenOpenParen, tokenVariable, tokenDot, tokenName, tokenSemicolon, tokenString, tokenCloseParen, tokenEOF,
+		}, kinds(tokens))
+		rq.Equal("id_2", tokens[4].value)
+		rq.Equal(5, tokens[4].pos)
+		rq.Equal("ENV", tokens[9].value)
+	})
+
+	t.Run("edits", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		tokens, err := lex(`.a|=upper|trim .b="x"`)
+		rq.NoError(err)
+		rq.Equal([]tokenKind{
+			tokenDot, tokenName, tokenUpdate, tokenName, tokenPipe, tokenName, tokenDot, tokenName, tokenOperator,
+			tokenString, tokenEOF,
+		}, kinds(tokens))
+		rq.Equal(2, tokens[2].pos)
+		rq.Equal("=", tokens[8].value)
+	})
+
+	t.Run("markup", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		tokens, err := lex(`.a += <b id="<1>"><!-- c -->x<c/></b> <d/>`)
+		rq.NoError(err)
+		rq.Equal([]tokenKind{tokenDot, tokenName, tokenAppend, tokenMarkup, tokenEOF}, kinds(tokens))
+		rq.Equal(`<b id="<1>"><!-- c -->x<c/></b> <d/>`, tokens[3].value)
+
+		tokens, err = lex(`wrap(.a; <b/>) | .a[b<1]`)
+		rq.NoError(err)
+		rq.Equal([]tokenKind{
+			tokenName, tokenOpenParen, tokenDot, tokenName, tokenSemicolon, tokenMarkup, tokenCloseParen, tokenPipe,
+			tokenDot, tokenName, tokenOpenBracket, tokenName, tokenOperator, tokenNumber, tokenCloseBracket, tokenEOF,
+		}, kinds(tokens))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, column := range map[string]int{
+			".a#/^b":        4,
+			".a[@b='c]":     7,
+			".a!":           3,
+			".a$":           3,
+			".я-$":          4,
+			"[@a=$1]":       5,
+			`."a\"`:         2,
+			".a += <b>":     7,
+			".a += <b":      7,
+			".a += </b>":    7,
+			".a += <b></c>": 10,
+		} {
+			_, err := lex(s)
+
+			var qe *Error
+			rq.ErrorAs(err, &qe, s)
+			rq.Equal(column, qe.Column, s)
+		}
+	})
+}
@@ -0,0 +1,197 @@
+package query
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+const keywordDef = "def"
+
+// Library is a set of named queries: `def actors: .objects.object.actors.actor;`. The name can be used
+// instead of the query as a whole pipe stage or argument of function: `actors | .#name`, `count(actors)`.
+// Query of the definition can use the definitions loaded before it.
+type Library struct {
+	definitions map[string][]token // tokens of the queries without the last `tokenEOF`
+}
+
+// NewLibrary creates an empty Library.
+func NewLibrary() *Library {
+	return &Library{
+		definitions: map[string][]token{},
+	}
+}
+
+// Load parses the definitions separated by semicolons and adds them to the library. Definitions with
+// the same name replace the loaded ones. Errors are `*Error` pointing at line and column of the source `file`.
+func (l *Library) Load(file, src string) error {
+	err := l.load(src)
+	var qe *Error
+	if !errors.As(err, &qe) {
+		return err
+	}
+
+	before := string([]rune(src)[:qe.Column-1])
+
+	return &Error{
+		File:    file,
+		Line:    strings.Count(before, "\n") + 1,
+		Column:  utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:]) + 1,
+		Message: qe.Message,
+	}
+}
+
+func (l *Library) load(src string) error {
+	tokens, err := lex(src)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; tokens[i].kind != tokenEOF; {
+		t := tokens[i]
+		if t.kind != tokenName || t.value != keywordDef {
+			return newError(src, t.pos, "unexpected %s, expected `def`", t)
+		}
+
+		name := tokens[i+1]
+		if name.kind != tokenName {
+			return newError(src, name.pos, "unexpected %s, expected name of definition", name)
+		}
+		i += 2
+		// colon is lexed as a part of the name unless there is a space before it: `def actors:.objects.object;`
+		if c := strings.IndexByte(name.value, ':'); c > -1 {
+			if rest := name.value[c+1:]; rest != "" { // `def actors:objects | .actors.actor;`
+				i--
+				tokens[i] = token{
+					kind:  tokenName,
+					value: rest,
+					pos:   name.pos + c + 1,
+				}
+			}
+			name.value = name.value[:c]
+		} else {
+			if tokens[i].kind != tokenColon {
+				return newError(src, tokens[i].pos, "unexpected %s, expected `:`", tokens[i])
+			}
+			i++
+		}
+
+		end, err := definitionEnd(src, tokens, i)
+		if err != nil {
+			return err
+		}
+		if end == i {
+			return newError(src, name.pos, "definition `%s` is empty", name.value)
+		}
+
+		definition := l.expand(tokens[i:end])
+		err = check(src, definition, tokens[end].pos)
+		if err != nil {
+			return err
+		}
+		l.definitions[name.value] = definition
+		i = end + 1
+	}
+
+	return nil
+}
+
+// Parse parses the query which can use the definitions of the library and the variables.
+func (l *Library) Parse(src string, variables map[string]string) (Node, error) {
+	return parse(src, variables, l)
+}
+
+// check parses the query of the definition which ends at byte `end` of the source, so its syntax errors are found
+// when the library is loaded. The query can be a pipe stage which follows the other one: `def titles: .title | upper;`.
+func check(src string, definition []token, end int) error {
+	eof := token{kind: tokenEOF, pos: end}
+	p := parser{
+		src:    src,
+		tokens: append(append([]token{}, definition...), eof),
+		syntax: true,
+	}
+	_, err := p.parseAll()
+	if err == nil {
+		return nil
+	}
+
+	start := definition[0].pos
+	stage := parser{
+		src:    src,
+		tokens: append(append([]token{{kind: tokenDot, pos: start}, {kind: tokenPipe, pos: start}}, definition...), eof),
+		syntax: true,
+	}
+	if _, stageErr := stage.parseAll(); stageErr == nil {
+		return nil
+	}
+
+	return err
+}
+
+// definitionEnd returns index of the semicolon ending the definition which query starts at index `start`.
+// Semicolons inside parentheses separate arguments of functions.
+func definitionEnd(src string, tokens []token, start int) (int, error) {
+	var depth int
+	for i := start; ; i++ {
+		switch tokens[i].kind {
+		case tokenOpenParen:
+			depth++
+		case tokenCloseParen:
+			depth--
+		case tokenSemicolon:
+			if depth == 0 {
+				return i, nil
+			}
+		case tokenEOF:
+			return i, newError(src, tokens[i].pos, "definition isn't closed by `;`")
+		case tokenDot, tokenDotDot, tokenName, tokenNumber, tokenString, tokenStar, tokenAt, tokenHash, tokenColon,
+			tokenComma, tokenPipe, tokenOpenBracket, tokenCloseBracket, tokenOperator, tokenNamespace, tokenCaret,
+			tokenRegexp, tokenVariable, tokenUpdate, tokenAppend, tokenMarkup:
+		}
+	}
+}
+
+// expand replaces the names of definitions which are whole pipe stages with tokens of their queries. The tokens
+// get position of the name, so errors of the queries point at it.
+func (l *Library) expand(tokens []token) []token {
+	if len(l.definitions) == 0 {
+		return tokens
+	}
+
+	res := make([]token, 0, len(tokens))
+	for i, t := range tokens {
+		definition, ok := l.definitions[t.value]
+		if !ok || t.kind != tokenName || !isStageStart(tokens, i) || !isStageEnd(tokens, i+1) {
+			res = append(res, t)
+
+			continue
+		}
+
+		for _, d := range definition {
+			d.pos = t.pos
+			res = append(res, d)
+		}
+	}
+
+	return res
+}
+
+// isStageStart checks if the token at index `i` starts pipe stage or argument of function.
+func isStageStart(tokens []token, i int) bool {
+	if i == 0 {
+		return true
+	}
+	k := tokens[i-1].kind
+
+	return k == tokenPipe || k == tokenOpenParen || k == tokenSemicolon
+}
+
+// isStageEnd checks if pipe stage or argument of function ends before the token at index `i`.
+func isStageEnd(tokens []token, i int) bool {
+	if i == len(tokens) {
+		return true
+	}
+	k := tokens[i].kind
+
+	return k == tokenPipe || k == tokenCloseParen || k == tokenSemicolon || k == tokenEOF
+}
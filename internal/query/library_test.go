@@ -0,0 +1,139 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibrary(t *testing.T) {
+	t.Parallel()
+
+	t.Run("definitions", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		l := NewLibrary()
+		rq.NoError(l.Load("", `
+def objects: .objects.object;
+def actors : objects | .actors.actor;
+def years: group_by(objects; .info#year) | count;
+def by_id:objects | select(@id = $id);`))
+
+		n, err := l.Parse("actors | .#name", nil)
+		rq.NoError(err)
+		paths := Paths(n)
+		rq.Len(paths, 1)
+		rq.Equal([]string{"objects", "object", "actors", "actor"}, names(paths[0]))
+		rq.Equal("name", paths[0].Attribute.Name)
+
+		n, err = l.Parse("count(actors)", nil)
+		rq.NoError(err)
+		call, ok := Function(n)
+		rq.True(ok)
+		rq.Equal(FunctionCount, call.Function)
+		rq.Equal([]string{"objects", "object", "actors", "actor"}, names(Paths(n)[0]))
+
+		n, err = l.Parse("years", nil)
+		rq.NoError(err)
+		agg, ok := Aggregation(n)
+		rq.True(ok)
+		rq.Equal(FunctionCount, agg.Function)
+
+		n, err = l.Parse("by_id", map[string]string{"id": "1997"})
+		rq.NoError(err)
+		rq.Equal("1997", Paths(n)[0].Steps[1].Condition.Filter.Value)
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		l := NewLibrary()
+		rq.NoError(l.Load("", "def a: .x.y;"))
+
+		for s, expected := range map[string][]string{
+			"a":       {"x", "y"},
+			".a":      {"a"},
+			"a.b":     {"a", "b"},
+			"a[0]":    {"a"},
+			".b | a":  {"b", "x", "y"},
+			".b | .a": {"b", "a"},
+		} {
+			n, err := l.Parse(s, nil)
+			rq.NoError(err, s)
+			rq.Equal(expected, names(Paths(n)[0]), s)
+		}
+	})
+
+	t.Run("redefinition", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		l := NewLibrary()
+		rq.NoError(l.Load("", "def a: .x; def b: a | .y;"))
+		rq.NoError(l.Load("", "def a: .z;"))
+
+		n, err := l.Parse("a, b", nil)
+		rq.NoError(err)
+		rq.Equal([]string{"a"}, names(Paths(n)[0]))
+
+		n, err = l.Parse("b", nil)
+		rq.NoError(err)
+		rq.Equal([]string{"x", "y"}, names(Paths(n)[0]))
+	})
+
+	t.Run("query errors", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		l := NewLibrary()
+		rq.NoError(l.Load("", "def a: .x#id;"))
+
+		_, err := l.Parse(".b | a | .c", nil)
+		var qe *Error
+		rq.ErrorAs(err, &qe)
+		rq.Equal(6, qe.Column)
+	})
+
+	t.Run("load errors", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for src, expected := range map[string]string{
+			"a: .x;":                   "line 1, column 1: unexpected `a:`, expected `def`",
+			"def .x;":                  "line 1, column 5: unexpected `.`, expected name of definition",
+			"def a .x;":                "line 1, column 7: unexpected `.`, expected `:`",
+			"def a: ;":                 "line 1, column 5: definition `a` is empty",
+			"def a: .x;\ndef b: .y":    "line 2, column 10: definition isn't closed by `;`",
+			"def a: .x;\n  def b: !":   "line 2, column 10: unexpected symbol `!`",
+			"def a: sub(\"x\"; \"y\")": "line 1, column 21: definition isn't closed by `;`",
+		} {
+			err := NewLibrary().Load("", src)
+			rq.EqualError(err, expected, src)
+		}
+	})
+
+	t.Run("malformed definitions", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		err := NewLibrary().Load("lib.xq", "def a: .x;\ndef broken:\n  .objects.object[@id=;")
+		var qe *Error
+		rq.ErrorAs(err, &qe)
+		rq.Equal(Error{File: "lib.xq", Line: 3, Column: 23, Message: "unexpected end of query, expected value"}, *qe)
+		rq.EqualError(err, "library lib.xq: line 3, column 23: unexpected end of query, expected value")
+
+		for src, expected := range map[string]string{
+			"def a: .x | ;":          "line 1, column 13: unexpected end of query, expected path",
+			"def a: .x[0;":           "line 1, column 12: unexpected end of query, expected `:`",
+			"def a: count(.x) | .y;": "line 1, column 20: unexpected `.`, expected string function",
+		} {
+			err = NewLibrary().Load("", src)
+			rq.EqualError(err, expected, src)
+		}
+
+		// variables are set and stages follow the other ones when the definitions are used
+		rq.NoError(NewLibrary().Load("", "def a: select(@id = $id) | upper; def b: .x[@y = $ENV.XQ_UNSET];"))
+	})
+}
@@ -0,0 +1,1144 @@
+package query
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tty2/xq/internal/domain"
+	"github.com/tty2/xq/internal/transform"
+)
+
+type parser struct {
+	src       string
+	tokens    []token
+	pos       int  // index of the current token
+	attribute int  // offset of the attribute selector in the current pipe stage or -1
+	axis      int  // offset of the axis step in the current path or -1
+	stageAxis bool // the current pipe stage contains an axis step
+	pipedAxis bool // one of the previous pipe stages contains an axis step
+	argument  bool // the current pipe is an argument of function
+	variables map[string]string
+	syntax    bool // only syntax of the query is checked, values of the variables aren't known
+}
+
+// variableEnv is the variable which fields are the environment variables: `$ENV.HOME`.
+const variableEnv = "ENV"
+
+// Parse parses the query and returns its syntax tree.
+//
+// Grammar:
+//
+//	query     = function "(" pipe ")" { "|" transform } | group | modify | pipe [ edit ]
+//	edit      = "=" ( string | number | variable ) | "|=" transform { "|" transform } | "+=" insert
+//	modify    = ( "del" | "unwrap" ) "(" pipe ")" | ( "before" | "after" | "wrap" ) "(" pipe ";" insert ")"
+//	insert    = markup | string
+//	function  = "count" | "length" | "name" | "text" | "keys" | "attrs" | "sum" | "avg" | "min" | "max"
+//	group     = "group_by" "(" pipe ";" pipe ")" [ "|" aggregate ] { "|" transform } | "unique_by" "(" pipe ";" pipe ")"
+//	aggregate = "count" | "length" | ( "sum" | "avg" | "min" | "max" ) "(" pipe ")"
+//	pipe      = union { "|" ( union | select ) } ( { "|" transform } | { "|" order } )
+//	order     = ( "sort_by" | "unique_by" ) "(" pipe ")" | "reverse" | "unique"
+//	transform = name [ "(" argument { ";" argument } ")" ]
+//	argument  = string | number | regexp | variable
+//	select    = "select" "(" condition ")"
+//	condition = conjunct { "or" conjunct }
+//	conjunct  = negation { "and" negation }
+//	negation  = "not" "(" condition ")" | "(" condition ")" | [ "." ] filter | "." compare
+//	union     = path { "," path }
+//	path      = "." [ attribute ] | [ "." | ".." ] step { ( "." | ".." ) step | "^" } [ attribute ]
+//	attribute = "#" ( name | "*" | regexp )
+//	regexp    = "/" pattern "/"
+//	step      = [ axis "::" ] [ "{" uri "}" ] ( name | "*" ) { "[" ( filter | index | slice ) "]" }
+//	axis      = "child" | "parent" | "ancestor" | "following-sibling"
+//	name      = identifier | string
+//	index     = integer
+//	slice     = [ integer ] ":" [ integer ] [ ":" [ integer ] ]
+//	filter    = ( "@" name | name { "." name } [ "#" name ] ) compare
+//	compare   = { "|" transform } [ operator ( string | number | name | variable ) ]
+//	variable  = "$" identifier | "$ENV" "." name
+func Parse(src string) (Node, error) {
+	return ParseWithVariables(src, nil)
+}
+
+// ParseWithVariables parses the query which values can be set by the variables: `.object[@id=$id]`. Variable
+// `$ENV` is reserved for the environment variables: `$ENV.HOME`.
+func ParseWithVariables(src string, variables map[string]string) (Node, error) {
+	return parse(src, variables, nil)
+}
+
+func parse(src string, variables map[string]string, library *Library) (Node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	if library != nil {
+		tokens = library.expand(tokens)
+	}
+
+	p := parser{
+		src:       src,
+		tokens:    tokens,
+		variables: variables,
+	}
+
+	return p.parseAll()
+}
+
+// parseAll parses the query which takes all the tokens.
+func (p *parser) parseAll() (Node, error) {
+	n, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.unexpected(t, tokenEOF.String())
+	}
+
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// peekNext returns the token after the current one.
+func (p *parser) peekNext() token {
+	if p.pos+1 < len(p.tokens) {
+		return p.tokens[p.pos+1]
+	}
+
+	return p.tokens[len(p.tokens)-1]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, expected string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, p.unexpected(t, expected)
+	}
+
+	return t, nil
+}
+
+func (p *parser) unexpected(t token, expected string) error {
+	return newError(p.src, t.pos, "unexpected %s, expected %s", t, expected)
+}
+
+// parseQuery parses the query which can be an argument of the function: `count(.objects.object)`.
+func (p *parser) parseQuery() (Node, error) {
+	t := p.peek()
+	if !p.isCall(t) || t.value == keywordSelect || p.isTransform(t) || p.isOrder(t) && !isFunction(t.value) {
+		n, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+
+		return p.parseEdit(n)
+	}
+	if op, ok := editFunction(t.value); ok {
+		return p.parseModify(op)
+	}
+	if !isFunction(t.value) {
+		return nil, newError(p.src, t.pos, "unknown function `%s`", t.value)
+	}
+	call, err := p.parseCall()
+	if err != nil {
+		return nil, err
+	}
+
+	if t.value == FunctionUniqueBy { // the whole tags are printed, string functions can't be applied to them
+		return call, nil
+	}
+
+	stages := []Node{call}
+	if t.value == FunctionGroupBy && p.peek().kind == tokenPipe && p.isAggregation(p.peekNext()) {
+		p.next()
+		call, err = p.parseAggregation()
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, call)
+	}
+	for p.peek().kind == tokenPipe {
+		p.next()
+		if t := p.peek(); !p.isTransform(t) {
+			return nil, p.unexpected(t, "string function")
+		}
+		f, err := p.parseTransform()
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, Transform{
+			Function: f,
+		})
+	}
+
+	if len(stages) == 1 {
+		return stages[0], nil
+	}
+
+	return Pipe{
+		Stages: stages,
+	}, nil
+}
+
+// parseEdit parses the operator modifying the tags or the attribute selected by the target if it follows
+// the target: `.a.b = "x"`, `.a.b#id |= ascii_upcase`.
+func (p *parser) parseEdit(target Node) (Node, error) {
+	t := p.peek()
+	edit := Edit{
+		Target: target,
+	}
+	switch {
+	case t.kind == tokenOperator && t.value == domain.EditAssign.String():
+		edit.Operator = domain.EditAssign
+	case t.kind == tokenUpdate:
+		edit.Operator = domain.EditUpdate
+	case t.kind == tokenAppend:
+		edit.Operator = domain.EditAppend
+	default:
+		return target, nil
+	}
+
+	err := p.checkEditTarget(target, t)
+	if err != nil {
+		return nil, err
+	}
+	p.next()
+
+	if edit.Operator == domain.EditAppend {
+		edit.Value, err = p.parseInsert()
+
+		return edit, err
+	}
+	if edit.Operator == domain.EditAssign {
+		v := p.next()
+		if v.kind == tokenVariable {
+			edit.Value, err = p.variable(v)
+
+			return edit, err
+		}
+		if v.kind != tokenString && v.kind != tokenNumber {
+			return nil, p.unexpected(v, "value")
+		}
+		edit.Value = v.value
+
+		return edit, nil
+	}
+
+	for {
+		if f := p.peek(); !p.isTransform(f) {
+			return nil, p.unexpected(f, "string function")
+		}
+		f, err := p.parseTransform()
+		if err != nil {
+			return nil, err
+		}
+		edit.Functions = append(edit.Functions, f)
+
+		if p.peek().kind != tokenPipe {
+			break
+		}
+		p.next()
+	}
+
+	return edit, nil
+}
+
+// parseModify parses the function modifying the tags or the attribute selected by its first argument:
+// `del(.a.b#id)`, `after(.a.b; <c/>)`.
+func (p *parser) parseModify(op domain.EditOperator) (Node, error) {
+	t := p.next()
+	p.next()
+
+	p.argument = true
+	defer func() { p.argument = false }()
+
+	target, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	err = p.checkEditTarget(target, t)
+	if err != nil {
+		return nil, err
+	}
+
+	edit := Edit{
+		Operator: op,
+		Target:   target,
+	}
+	if takesMarkup(op) {
+		_, err = p.expect(tokenSemicolon, "`;`")
+		if err != nil {
+			return nil, err
+		}
+		edit.Value, err = p.parseInsert()
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = p.expect(tokenCloseParen, "`)`")
+	if err != nil {
+		return nil, err
+	}
+
+	return edit, nil
+}
+
+// parseInsert parses the markup inserted into the document. Quoted markup is inserted as it is: `"<c>x</c>"`.
+func (p *parser) parseInsert() (string, error) {
+	t := p.next()
+	if t.kind != tokenMarkup && t.kind != tokenString {
+		return "", p.unexpected(t, "markup")
+	}
+
+	return t.value, nil
+}
+
+// checkEditTarget checks that the operator `t` can modify the tags or the attribute selected by the target.
+func (p *parser) checkEditTarget(target Node, t token) error {
+	if len(Transforms(target)) > 0 || len(Orders(target)) > 0 {
+		return newError(p.src, t.pos, "`%s` can be applied only to the query selecting tags or attribute", t.value)
+	}
+
+	paths := Paths(target)
+	if len(paths) != 1 {
+		return newError(p.src, t.pos, "`%s` can modify the tags of the only path", t.value)
+	}
+	op, ok := editFunction(t.value)
+	if t.kind == tokenAppend || ok && op != domain.EditDelete {
+		if paths[0].Attribute.IsSet() {
+			return newError(p.src, t.pos, "`%s` can't modify the attribute", t.value)
+		}
+	}
+	if paths[0].Attribute.IsMultiple() {
+		return newError(p.src, t.pos, "`%s` can modify the only attribute", t.value)
+	}
+	for _, step := range paths[0].Steps {
+		if step.Axis != domain.AxisChild {
+			return newError(p.src, t.pos, "`%s` can't modify the tags selected by axis `%s`", t.value, step.Axis)
+		}
+	}
+
+	return nil
+}
+
+// parseCall parses the function with its arguments: `count(.objects.object)`,
+// `group_by(.objects.object; .title#lang)`.
+func (p *parser) parseCall() (Call, error) {
+	call := Call{
+		Function: p.next().value,
+	}
+	p.next()
+
+	p.argument = true
+	defer func() { p.argument = false }()
+
+	var err error
+	call.Argument, err = p.parsePipe()
+	if err != nil {
+		return call, err
+	}
+
+	if takesKey(call.Function) {
+		_, err = p.expect(tokenSemicolon, "`;` and the key")
+		if err != nil {
+			return call, err
+		}
+		call.Key, err = p.parsePipe()
+		if err != nil {
+			return call, err
+		}
+	}
+
+	_, err = p.expect(tokenCloseParen, "`)`")
+
+	return call, err
+}
+
+// isAggregation checks if the current token `t` is a function applied to every group of `group_by`.
+func (p *parser) isAggregation(t token) bool {
+	return t.kind == tokenName && isAggregation(t.value)
+}
+
+// parseAggregation parses the function applied to every group of `group_by`: `count`, `sum(.USPrice)`.
+func (p *parser) parseAggregation() (Call, error) {
+	t := p.peek()
+	if t.value == FunctionCount || t.value == FunctionLength {
+		p.next()
+
+		return Call{
+			Function: t.value,
+		}, nil
+	}
+
+	if p.peekNext().kind != tokenOpenParen {
+		return Call{}, p.unexpected(p.peekNext(), "`(`")
+	}
+
+	return p.parseCall()
+}
+
+func (p *parser) parsePipe() (Node, error) {
+	var stages []Node
+	attribute := -1 // offset of the attribute selected by the previous stages
+	var transformed, ordered bool
+	for {
+		t := p.peek()
+		isTransform := p.isTransform(t)
+		isOrder := p.isOrder(t)
+		switch {
+		case isTransform && len(stages) == 0:
+			return nil, newError(p.src, t.pos, "string function must follow the query selecting values")
+		case isOrder && len(stages) == 0:
+			return nil, newError(p.src, t.pos, "`%s` must follow the query matching tags to order", t.value)
+		case isOrder && p.argument:
+			return nil, newError(p.src, t.pos, "`%s` can't be used in argument of function", t.value)
+		case !isOrder && len(stages) > 0 && p.isFunction(t):
+			return nil, newError(p.src, t.pos, "`%s` can't follow pipe, the stages are joined into one path: apply it to "+
+				"the whole pipe or select tags with dot: `.%s`", t.value, t.value)
+		case transformed && !isTransform:
+			return nil, p.unexpected(t, "string function")
+		case ordered && !isOrder:
+			return nil, p.unexpected(t, "sort_by, reverse, unique or unique_by")
+		case attribute > -1 && !isTransform:
+			return nil, newError(p.src, attribute, "attribute can be selected only in the last stage of pipe")
+		}
+
+		p.attribute = -1
+		var n Node
+		var err error
+		switch {
+		case isTransform:
+			transformed = true
+			var f domain.Function
+			f, err = p.parseTransform()
+			n = Transform{
+				Function: f,
+			}
+		case isOrder:
+			ordered = true
+			n, err = p.parseOrder()
+		case p.isCall(t) && t.value == keywordSelect:
+			if len(stages) == 0 {
+				return nil, newError(p.src, t.pos, "select must follow the query matching tags to filter")
+			}
+			n, err = p.parseSelect()
+		default:
+			n, err = p.parseUnion()
+		}
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, n)
+		p.pipedAxis = p.pipedAxis || p.stageAxis
+		if p.attribute > -1 {
+			attribute = p.attribute
+		}
+
+		if p.peek().kind != tokenPipe {
+			break
+		}
+		p.next()
+	}
+
+	var n Node = Pipe{
+		Stages: stages,
+	}
+	if len(stages) == 1 {
+		n = stages[0]
+	}
+
+	return n, p.checkAxes(n)
+}
+
+// checkAxes checks the axis steps of the paths the pipe `n` is joined into, so the conditions selected by the next
+// stages are checked as well: `.a.b^ | select(.c)`.
+func (p *parser) checkAxes(n Node) error {
+	for _, path := range Paths(n) {
+		if err := domain.CheckAxis(path.Steps); err != nil {
+			return newError(p.src, path.axis, "%s", err)
+		}
+	}
+
+	return nil
+}
+
+// isCall checks if the current token `t` is a name of function or keyword followed by parentheses:
+// `count(`, `not(`.
+func (p *parser) isCall(t token) bool {
+	return t.kind == tokenName && p.peekNext().kind == tokenOpenParen
+}
+
+// isTransform checks if the current token `t` is a name of string function. Tags with such names can be selected
+// by path with dot or quoted names: `.a | .trim`, `.a | "trim"`.
+func (p *parser) isTransform(t token) bool {
+	return t.kind == tokenName && transform.Exists(t.value)
+}
+
+// isFunction checks if the current token `t` is a name of function which isn't a stage of pipe. Paths of the stages
+// are joined into one path, there is no tag the function could be applied to as to a new root. Tags with such names
+// can be selected by path with dot or quoted names: `.a | .count`, `.a | "count"`.
+func (p *parser) isFunction(t token) bool {
+	_, isEdit := editFunction(t.value)
+
+	return t.kind == tokenName && (isFunction(t.value) || isEdit)
+}
+
+// isOrder checks if the current token `t` is a name of function reordering tags. Tags with such names can be
+// selected by path with dot or quoted names: `.a | .reverse`, `.a | "reverse"`.
+func (p *parser) isOrder(t token) bool {
+	return t.kind == tokenName && isOrder(t.value, p.peekNext().kind == tokenOpenParen)
+}
+
+// parseOrder parses function reordering tags with its key: `reverse`, `sort_by(.title#lang)`.
+func (p *parser) parseOrder() (Node, error) {
+	order := Order{
+		Function: p.next().value,
+	}
+	if p.peek().kind != tokenOpenParen {
+		return order, nil
+	}
+	p.next()
+
+	// the key is relative to every tag, so it doesn't share the state of the pipe
+	pipedAxis, stageAxis := p.pipedAxis, p.stageAxis
+	p.pipedAxis, p.argument = false, true
+	defer func() {
+		p.pipedAxis, p.stageAxis, p.argument, p.attribute = pipedAxis, stageAxis, false, -1
+	}()
+
+	var err error
+	order.Key, err = p.parsePipe()
+	if err != nil {
+		return order, err
+	}
+	_, err = p.expect(tokenCloseParen, "`)`")
+
+	return order, err
+}
+
+// parseTransform parses string function with its arguments: `ascii_downcase`, `sub("^ID-"; "")`.
+func (p *parser) parseTransform() (domain.Function, error) {
+	t := p.next()
+	f := domain.Function{
+		Name: t.value,
+	}
+
+	if p.peek().kind == tokenOpenParen {
+		p.next()
+		for {
+			arg := p.next()
+			value := arg.value
+			switch arg.kind {
+			case tokenString, tokenNumber, tokenRegexp:
+			case tokenVariable:
+				var err error
+				value, err = p.variable(arg)
+				if err != nil {
+					return f, err
+				}
+				if isReplacement(f) { // value of the variable is set literally, `$1` isn't a capture group
+					value = strings.ReplaceAll(value, "$", "$$")
+				}
+			default:
+				return f, p.unexpected(arg, "string")
+			}
+			f.Args = append(f.Args, value)
+
+			if p.peek().kind != tokenSemicolon {
+				break
+			}
+			p.next()
+		}
+
+		_, err := p.expect(tokenCloseParen, "`;` or `)`")
+		if err != nil {
+			return f, err
+		}
+	}
+
+	err := transform.Check(f)
+	if err != nil {
+		return f, newError(p.src, t.pos, "%s", err)
+	}
+
+	return f, nil
+}
+
+// isReplacement checks if the next argument of the function `f` is the replacement of the regular expression
+// matches which can refer to capture groups: `sub("(\d+)"; "<$1>")`.
+func isReplacement(f domain.Function) bool {
+	return len(f.Args) == 1 && (f.Name == transform.Sub || f.Name == transform.Gsub)
+}
+
+// parseSelect parses condition of select: `select(.Quantity > 1 and .USPrice < 100)`.
+func (p *parser) parseSelect() (Node, error) {
+	p.next()
+	p.next()
+
+	condition, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.expect(tokenCloseParen, "`)`")
+	if err != nil {
+		return nil, err
+	}
+
+	return Select{
+		Condition: condition,
+	}, nil
+}
+
+// parseCondition parses operands joined by `or`.
+func (p *parser) parseCondition() (domain.Condition, error) {
+	return p.parseOperands(domain.ConditionOr, keywordOr, p.parseConjunction)
+}
+
+// parseConjunction parses operands joined by `and`.
+func (p *parser) parseConjunction() (domain.Condition, error) {
+	return p.parseOperands(domain.ConditionAnd, keywordAnd, p.parseNegation)
+}
+
+// parseOperands parses operands joined by `keyword` and combines them by `operator` if there are several ones.
+func (p *parser) parseOperands(operator domain.ConditionOperator, keyword string,
+	parseOperand func() (domain.Condition, error)) (domain.Condition, error) {
+	operand, err := parseOperand()
+	if err != nil {
+		return operand, err
+	}
+
+	operands := []domain.Condition{operand}
+	for t := p.peek(); t.kind == tokenName && t.value == keyword; t = p.peek() {
+		p.next()
+		operand, err = parseOperand()
+		if err != nil {
+			return operand, err
+		}
+		operands = append(operands, operand)
+	}
+
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+
+	return domain.Condition{
+		Operator: operator,
+		Operands: operands,
+	}, nil
+}
+
+// parseNegation parses `not(condition)`, condition in parentheses or a filter: `.Quantity > 1`, `@sku`.
+func (p *parser) parseNegation() (domain.Condition, error) {
+	t := p.peek()
+	switch {
+	case p.isCall(t) && t.value == keywordNot:
+		p.next()
+		p.next()
+		operand, err := p.parseCondition()
+		if err != nil {
+			return operand, err
+		}
+		_, err = p.expect(tokenCloseParen, "`)`")
+
+		return domain.Condition{
+			Operator: domain.ConditionNot,
+			Operands: []domain.Condition{operand},
+		}, err
+	case t.kind == tokenOpenParen:
+		p.next()
+		condition, err := p.parseCondition()
+		if err != nil {
+			return condition, err
+		}
+		_, err = p.expect(tokenCloseParen, "`)`")
+
+		return condition, err
+	case t.kind == tokenDot && isName(p.peekNext()): // `.child` is the same as `child`
+		p.next()
+	case t.kind == tokenDot: // text of the tag itself: `. > 15`
+		p.next()
+		f, err := p.parseComparison(domain.Filter{Self: true})
+
+		return domain.Condition{
+			Operator: domain.ConditionFilter,
+			Filter:   f,
+		}, err
+	case t.kind == tokenAt || isName(t):
+	default:
+		return domain.Condition{}, p.unexpected(t, "filter")
+	}
+
+	f, err := p.parseFilter()
+
+	return domain.Condition{
+		Operator: domain.ConditionFilter,
+		Filter:   f,
+	}, err
+}
+
+func (p *parser) parseUnion() (Node, error) {
+	var branches []Node
+	for {
+		n, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		branches = append(branches, n)
+
+		if p.peek().kind != tokenComma {
+			break
+		}
+		p.next()
+	}
+
+	if len(branches) == 1 {
+		return branches[0], nil
+	}
+
+	return Union{
+		Branches: branches,
+	}, nil
+}
+
+func (p *parser) parsePath() (Node, error) {
+	path := Path{
+		Steps: []domain.Step{},
+	}
+	p.axis = -1
+
+	if p.peek().kind == tokenDot && !isStepStart(p.peekNext()) { // `.` or `.#attr`
+		p.next()
+
+		return p.parseAttribute(path)
+	}
+
+	if isStepStart(p.peek()) { // the first step can be set without dot: `tag.child`
+		step, err := p.parseStep(false)
+		if err != nil {
+			return nil, err
+		}
+		path.Steps = append(path.Steps, step)
+	}
+
+	for {
+		var descendant bool
+		switch t := p.peek(); t.kind {
+		case tokenDot:
+		case tokenDotDot: // `..name`: the next step can be located at any depth
+			descendant = true
+		case tokenCaret: // parent of the tags matched by the previous steps
+			if len(path.Steps) == 0 {
+				return nil, p.unexpected(t, "path")
+			}
+			err := p.setAxis(t)
+			if err != nil {
+				return nil, err
+			}
+			p.next()
+			path.Steps = append(path.Steps, domain.Step{
+				Name:  domain.Wildcard,
+				Index: -1,
+				Axis:  domain.AxisParent,
+			})
+
+			continue
+		default:
+			if len(path.Steps) == 0 {
+				return nil, p.unexpected(p.peek(), "path")
+			}
+			path.axis = p.axis
+
+			return p.parseAttribute(path)
+		}
+		p.next()
+
+		step, err := p.parseStep(descendant)
+		if err != nil {
+			return nil, err
+		}
+		path.Steps = append(path.Steps, step)
+	}
+}
+
+func isStepStart(t token) bool {
+	return isName(t) || t.kind == tokenStar || t.kind == tokenNamespace
+}
+
+// isName checks if the token can be used as a name. Names with dots, hashes, etc. must be quoted: `"config.v2"`.
+func isName(t token) bool {
+	return t.kind == tokenName || t.kind == tokenString
+}
+
+func (p *parser) expectName(expected string) (token, error) {
+	t := p.next()
+	if !isName(t) {
+		return t, p.unexpected(t, expected)
+	}
+
+	return t, nil
+}
+
+func (p *parser) parseAttribute(path Path) (Node, error) {
+	if p.peek().kind != tokenHash {
+		return path, nil
+	}
+
+	if p.attribute == -1 {
+		p.attribute = p.peek().pos
+	}
+	p.next()
+
+	switch t := p.next(); {
+	case t.kind == tokenStar:
+		path.Attribute.Name = domain.Wildcard
+	case t.kind == tokenRegexp:
+		if t.value == "" {
+			return nil, newError(p.src, t.pos, "regular expression of attribute can't be empty")
+		}
+		path.Attribute.Pattern = t.value
+	case isName(t):
+		path.Attribute.Name = t.value
+	default:
+		return nil, p.unexpected(t, "attribute name, `*` or regular expression")
+	}
+
+	return path, nil
+}
+
+func (p *parser) parseStep(descendant bool) (domain.Step, error) {
+	axis := domain.AxisChild
+	if t := p.peek(); t.kind == tokenName && p.peekNext().kind == tokenColon {
+		var err error
+		axis, err = p.parseAxis(descendant)
+		if err != nil {
+			return domain.Step{}, err
+		}
+	}
+
+	var namespace string
+	if t := p.peek(); t.kind == tokenNamespace {
+		if t.value == "" {
+			return domain.Step{}, newError(p.src, t.pos, "namespace URI can't be empty")
+		}
+		namespace = t.value
+		p.next()
+	}
+
+	t := p.next()
+	if !isName(t) && t.kind != tokenStar {
+		return domain.Step{}, p.unexpected(t, "tag name")
+	}
+
+	step := domain.Step{
+		Name:       t.value,
+		Index:      -1,
+		Descendant: descendant,
+		Namespace:  namespace,
+		Axis:       axis,
+	}
+
+	for p.peek().kind == tokenOpenBracket {
+		p.next()
+
+		err := p.parsePredicate(&step)
+		if err != nil {
+			return domain.Step{}, err
+		}
+
+		_, err = p.expect(tokenCloseBracket, "`]`")
+		if err != nil {
+			return domain.Step{}, err
+		}
+	}
+
+	return step, nil
+}
+
+// parseAxis parses axis of the step: `ancestor::`, `following-sibling::`, etc.
+func (p *parser) parseAxis(descendant bool) (domain.Axis, error) {
+	t := p.next()
+	for i := 0; i < 2; i++ {
+		_, err := p.expect(tokenColon, "`::`")
+		if err != nil {
+			return domain.AxisChild, err
+		}
+	}
+
+	for _, axis := range []domain.Axis{
+		domain.AxisChild, domain.AxisParent, domain.AxisAncestor, domain.AxisFollowingSibling,
+	} {
+		if axis.String() != t.value {
+			continue
+		}
+		if axis == domain.AxisChild {
+			return axis, nil
+		}
+		if descendant {
+			return axis, newError(p.src, t.pos, "axis `%s` can't be used after `..`", axis)
+		}
+
+		return axis, p.setAxis(t)
+	}
+
+	return domain.AxisChild, newError(p.src, t.pos, "unknown axis `%s`", t.value)
+}
+
+// setAxis keeps the axis found at token `t`. Path can contain the only axis step including the paths
+// of the previous pipe stages it's joined with.
+func (p *parser) setAxis(t token) error {
+	if p.axis > -1 || p.pipedAxis {
+		return newError(p.src, t.pos, "path can contain the only axis step")
+	}
+	p.axis = t.pos
+	p.stageAxis = true
+
+	return nil
+}
+
+// parsePredicate parses index, slice or filter set in brackets after the step name.
+func (p *parser) parsePredicate(step *domain.Step) error {
+	t := p.peek()
+	isPosition := t.kind == tokenColon || t.kind == tokenNumber
+	if step.Index > -1 || step.Slice != nil {
+		if isPosition {
+			return newError(p.src, t.pos, "position of `%s` is already set", step.Name)
+		}
+
+		return newError(p.src, t.pos, "filters of `%s` must be set before its position", step.Name)
+	}
+
+	switch {
+	case t.kind == tokenNumber && p.peekNext().kind == tokenCloseBracket:
+		p.next()
+		idx, err := p.integer(t)
+		if err != nil {
+			return err
+		}
+		if idx < 0 {
+			step.Slice = negativeIndexSlice(idx)
+		} else {
+			step.Index = idx
+		}
+	case isPosition:
+		sl, err := p.parseSlice()
+		if err != nil {
+			return err
+		}
+		step.Slice = sl
+	default:
+		f, err := p.parseFilter()
+		if err != nil {
+			return err
+		}
+		step.Filters = append(step.Filters, f)
+	}
+
+	return nil
+}
+
+// negativeIndexSlice returns slice with the only tag counted from the end: `[-1]`, `[-2]`, etc.
+func negativeIndexSlice(idx int) *domain.Slice {
+	sl := domain.Slice{
+		Start: idx,
+		Step:  1,
+	}
+	if idx+1 < 0 {
+		sl.End = idx + 1
+		sl.HasEnd = true
+	}
+
+	return &sl
+}
+
+// parseSlice parses slice set in brackets: `2:5`, `-3:`, `::2`, etc.
+func (p *parser) parseSlice() (*domain.Slice, error) {
+	sl := domain.Slice{
+		Step: 1,
+	}
+
+	var err error
+	if t := p.peek(); t.kind == tokenNumber {
+		p.next()
+		sl.Start, err = p.integer(t)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = p.expect(tokenColon, "`:`")
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == tokenNumber {
+		p.next()
+		sl.End, err = p.integer(t)
+		if err != nil {
+			return nil, err
+		}
+		sl.HasEnd = true
+	}
+
+	if p.peek().kind != tokenColon {
+		return &sl, nil
+	}
+	p.next()
+
+	if t := p.peek(); t.kind == tokenNumber {
+		p.next()
+		sl.Step, err = p.integer(t)
+		if err != nil {
+			return nil, err
+		}
+		if sl.Step < 1 {
+			return nil, newError(p.src, t.pos, "slice step must be positive")
+		}
+	}
+
+	return &sl, nil
+}
+
+func (p *parser) integer(t token) (int, error) {
+	n, err := strconv.Atoi(t.value)
+	if err != nil {
+		return 0, newError(p.src, t.pos, "position must be an integer, got `%s`", t.value)
+	}
+
+	return n, nil
+}
+
+// parseFilter parses a filter set in brackets: `@attr`, `@attr='value'`, `child.tag>10`, etc.
+func (p *parser) parseFilter() (domain.Filter, error) {
+	var filter domain.Filter
+
+	isAttribute := p.peek().kind == tokenAt
+	if isAttribute {
+		p.next()
+		t, err := p.expectName("attribute name")
+		if err != nil {
+			return filter, err
+		}
+		filter.Attribute = t.value
+	} else {
+		t, err := p.expectName("index, slice or filter")
+		if err != nil {
+			return filter, err
+		}
+		filter.Child = []string{t.value}
+		for p.peek().kind == tokenDot {
+			p.next()
+			t, err = p.expectName("child tag name")
+			if err != nil {
+				return filter, err
+			}
+			filter.Child = append(filter.Child, t.value)
+		}
+		if p.peek().kind == tokenHash { // attribute of the child: `info#year`
+			p.next()
+			t, err = p.expectName("attribute name")
+			if err != nil {
+				return filter, err
+			}
+			filter.Attribute = t.value
+		}
+	}
+
+	return p.parseComparison(filter)
+}
+
+// parseComparison parses string functions, operator and value of the filter which target is parsed.
+func (p *parser) parseComparison(filter domain.Filter) (domain.Filter, error) {
+	for p.peek().kind == tokenPipe {
+		p.next()
+		if t := p.peek(); !p.isTransform(t) {
+			return filter, p.unexpected(t, "string function")
+		}
+		f, err := p.parseTransform()
+		if err != nil {
+			return filter, err
+		}
+		filter.Functions = append(filter.Functions, f)
+	}
+
+	if p.peek().kind != tokenOperator {
+		filter.Operator = domain.FilterExists
+
+		return filter, nil
+	}
+
+	filter.Operator = filterOperator(p.next().value)
+
+	t := p.next()
+	switch t.kind {
+	case tokenString, tokenNumber, tokenName:
+		filter.Value = t.value
+	case tokenVariable:
+		var err error
+		filter.Value, err = p.variable(t)
+		if err != nil {
+			return filter, err
+		}
+	case tokenEOF, tokenDot, tokenDotDot, tokenStar, tokenAt, tokenHash, tokenColon, tokenComma, tokenPipe,
+		tokenOpenBracket, tokenCloseBracket, tokenOperator, tokenNamespace, tokenCaret, tokenRegexp,
+		tokenOpenParen, tokenCloseParen, tokenSemicolon, tokenUpdate, tokenAppend, tokenMarkup:
+		return filter, p.unexpected(t, "value")
+	}
+
+	return filter, nil
+}
+
+// variable returns value of the variable `t` or of the environment variable if it's `$ENV.NAME`.
+func (p *parser) variable(t token) (string, error) {
+	if t.value != variableEnv {
+		value, ok := p.variables[t.value]
+		if !ok && !p.syntax {
+			return "", newError(p.src, t.pos, "variable `$%s` isn't set", t.value)
+		}
+
+		return value, nil
+	}
+
+	_, err := p.expect(tokenDot, "`.` and name of environment variable")
+	if err != nil {
+		return "", err
+	}
+	name, err := p.expectName("name of environment variable")
+	if err != nil {
+		return "", err
+	}
+	value, ok := os.LookupEnv(name.value)
+	if !ok && !p.syntax {
+		return "", newError(p.src, name.pos, "environment variable `%s` isn't set", name.value)
+	}
+
+	return value, nil
+}
+
+func filterOperator(s string) domain.FilterOperator {
+	if s == "==" {
+		return domain.FilterEqual
+	}
+
+	for _, op := range []domain.FilterOperator{
+		domain.FilterEqual, domain.FilterNotEqual, domain.FilterMatch, domain.FilterLess,
+		domain.FilterLessOrEqual, domain.FilterGreater, domain.FilterGreaterOrEqual,
+	} {
+		if op.String() == s {
+			return op
+		}
+	}
+
+	return domain.FilterExists
+}
@@ -0,0 +1,1190 @@
+package query
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tty2/xq/internal/domain"
+	"github.com/tty2/xq/internal/transform"
+)
+
+func parsePath(t *testing.T, s string) Path {
+	t.Helper()
+
+	n, err := Parse(s)
+	require.NoError(t, err, s)
+	path, ok := n.(Path)
+	require.True(t, ok, s)
+
+	return path
+}
+
+func parseStep(t *testing.T, s string) domain.Step {
+	t.Helper()
+
+	path := parsePath(t, s)
+	require.Len(t, path.Steps, 1, s)
+
+	return path.Steps[0]
+}
+
+func TestParseStep(t *testing.T) {
+	t.Parallel()
+
+	t.Run("clean tag", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := parseStep(t, "tag")
+
+		rq.Equal("tag", res.Name)
+		rq.Equal(-1, res.Index)
+	})
+
+	t.Run("with index", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := parseStep(t, "tag_name[3]")
+
+		rq.Equal("tag_name", res.Name)
+		rq.Equal(3, res.Index)
+	})
+
+	t.Run("wildcard with index", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := parseStep(t, "*[2]")
+
+		rq.Equal(domain.Wildcard, res.Name)
+		rq.Equal(2, res.Index)
+	})
+
+	t.Run("names", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for _, name := range []string{"tag-name", "ns:tag", "имя", "_tag1"} {
+			res := parseStep(t, "."+name)
+			rq.Equal(name, res.Name)
+		}
+	})
+}
+
+func TestParseQuotedNames(t *testing.T) {
+	t.Parallel()
+
+	t.Run("steps and attribute", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		path := parsePath(t, `."config.v2"."x-y"..'a b'#"data#x"`)
+
+		rq.Len(path.Steps, 3)
+		rq.Equal("config.v2", path.Steps[0].Name)
+		rq.Equal("x-y", path.Steps[1].Name)
+		rq.Equal("a b", path.Steps[2].Name)
+		rq.True(path.Steps[2].Descendant)
+		rq.Equal("data#x", path.Attribute.Name)
+	})
+
+	t.Run("escapes", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := parseStep(t, `."a\"b"`)
+
+		rq.Equal(`a"b`, res.Name)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := parseStep(t, `tag[@"a.b"='1']["config.v2".year>1990]`)
+
+		rq.Equal([]domain.Filter{
+			{Attribute: "a.b", Operator: domain.FilterEqual, Value: "1"},
+			{Child: []string{"config.v2", "year"}, Operator: domain.FilterGreater, Value: "1990"},
+		}, res.Filters)
+	})
+}
+
+func TestParseNamespaces(t *testing.T) {
+	t.Parallel()
+
+	t.Run("expanded names", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		path := parsePath(t, "{http://schemas.xmlsoap.org/soap/envelope/}Envelope..{urn:x}*.s:Body")
+
+		rq.Len(path.Steps, 3)
+		rq.Equal("Envelope", path.Steps[0].Name)
+		rq.Equal("http://schemas.xmlsoap.org/soap/envelope/", path.Steps[0].Namespace)
+		rq.Equal(domain.Wildcard, path.Steps[1].Name)
+		rq.Equal("urn:x", path.Steps[1].Namespace)
+		rq.True(path.Steps[1].Descendant)
+		rq.Equal("s:Body", path.Steps[2].Name)
+		rq.Empty(path.Steps[2].Namespace)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, column := range map[string]int{
+			".{}a":      2,
+			".{urn:a":   2,
+			".{urn:a}.": 9,
+		} {
+			_, err := Parse(s)
+
+			var qe *Error
+			rq.ErrorAs(err, &qe, s)
+			rq.Equal(column, qe.Column, s)
+		}
+	})
+}
+
+func TestParseAxes(t *testing.T) {
+	t.Parallel()
+
+	t.Run("parent", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		path := parsePath(t, "..price^.title#lang")
+
+		rq.Len(path.Steps, 3)
+		rq.Equal(domain.Step{Name: "price", Index: -1, Descendant: true}, path.Steps[0])
+		rq.Equal(domain.Step{Name: domain.Wildcard, Index: -1, Axis: domain.AxisParent}, path.Steps[1])
+		rq.Equal("title", path.Steps[2].Name)
+		rq.Equal(domain.AxisChild, path.Steps[2].Axis)
+		rq.Equal("lang", path.Attribute.Name)
+	})
+
+	t.Run("named axes", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		path := parsePath(t, "..price.ancestor::{urn:a}book[@id]")
+		rq.Len(path.Steps, 2)
+		rq.Equal(domain.AxisAncestor, path.Steps[1].Axis)
+		rq.Equal("book", path.Steps[1].Name)
+		rq.Equal("urn:a", path.Steps[1].Namespace)
+		rq.Len(path.Steps[1].Filters, 1)
+
+		path = parsePath(t, ".a.following-sibling::*")
+		rq.Equal(domain.AxisFollowingSibling, path.Steps[1].Axis)
+		rq.Equal(domain.Wildcard, path.Steps[1].Name)
+
+		path = parsePath(t, ".a.child::b")
+		rq.Equal(domain.Step{Name: "b", Index: -1}, path.Steps[1])
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, column := range map[string]int{
+			".a^^":                      4,
+			".a^.ancestor::b":           5,
+			".a.sibling::b":             4,
+			"..ancestor::b":             3,
+			".a.parent::":               12,
+			".a | .b^ | .c.ancestor::d": 15,
+		} {
+			_, err := Parse(s)
+
+			var qe *Error
+			rq.ErrorAs(err, &qe, s)
+			rq.Equal(column, qe.Column, s)
+		}
+	})
+
+	t.Run("steps which can't be matched when tag is opened", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, msg := range map[string]string{
+			".a[1].b^":                  "column 8: index can't be used together with axis",
+			".a.parent::d[c]":           "column 4: axis step `d` can have attribute filters only",
+			".a.b[c].parent::d":         "column 9: steps before axis can have attribute filters only, but `b` has other ones",
+			".x | .a[2:].ancestor::b":   "column 13: steps before axis can have attribute filters only, but `a` has other ones",
+			".a.b^ | select(.c)":        "column 5: axis step `*` can have attribute filters only",
+			"count(.a.b^ | select(.c))": "column 11: axis step `*` can have attribute filters only",
+			"group_by(.a; .b[1]^)":      "column 19: index can't be used together with axis",
+		} {
+			_, err := Parse(s)
+
+			var qe *Error
+			rq.ErrorAs(err, &qe, s)
+			rq.EqualError(err, msg, s)
+		}
+
+		_, err := Parse(".a.b[@id=1]^.c[@x]")
+		rq.NoError(err)
+	})
+}
+
+func TestParseAttribute(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		path := parsePath(t, "tag1.tag2#attr")
+
+		rq.Len(path.Steps, 2)
+		rq.Equal("attr", path.Attribute.Name)
+	})
+
+	t.Run("hash in filter", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		path := parsePath(t, "tag1[@attr='#value'].tag2#attr")
+
+		rq.Len(path.Steps, 2)
+		rq.Equal("#value", path.Steps[0].Filters[0].Value)
+		rq.Equal("attr", path.Attribute.Name)
+	})
+
+	t.Run("attribute of identity", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		path := parsePath(t, ".#attr")
+
+		rq.Empty(path.Steps)
+		rq.Equal("attr", path.Attribute.Name)
+	})
+
+	t.Run("all attributes", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		path := parsePath(t, "..g#*")
+
+		rq.Equal(domain.Attribute{Name: domain.Wildcard}, path.Attribute)
+		rq.True(path.Attribute.IsMultiple())
+	})
+
+	t.Run("attributes by regular expression", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		path := parsePath(t, `..*#/^data-\d/`)
+
+		rq.Equal(domain.Attribute{Pattern: `^data-\d`}, path.Attribute)
+		rq.True(path.Attribute.IsMultiple())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, column := range map[string]int{
+			".a#//":   4,
+			".a#":     4,
+			".a#[":    4,
+			".a#*#b":  5,
+			".a#/b/c": 7,
+		} {
+			_, err := Parse(s)
+
+			var qe *Error
+			rq.ErrorAs(err, &qe, s)
+			rq.Equal(column, qe.Column, s)
+		}
+	})
+}
+
+func TestParsePath(t *testing.T) {
+	t.Parallel()
+
+	t.Run("empty path", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		path := parsePath(t, ".")
+
+		rq.Len(path.Steps, 0)
+		rq.Empty(path.Attribute)
+	})
+
+	t.Run("without leading dot", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		st := parsePath(t, "tag1.tag2.tag3").Steps
+
+		rq.Len(st, 3)
+		rq.Equal("tag1", st[0].Name)
+		rq.Equal(-1, st[0].Index)
+		rq.Equal("tag2", st[1].Name)
+		rq.Equal(-1, st[1].Index)
+		rq.Equal("tag3", st[2].Name)
+		rq.Equal(-1, st[2].Index)
+	})
+
+	t.Run("leading dot", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		st := parsePath(t, ".tag1.tag2.tag3").Steps
+
+		rq.Len(st, 3)
+		rq.Equal("tag1", st[0].Name)
+		rq.Equal("tag2", st[1].Name)
+		rq.Equal("tag3", st[2].Name)
+	})
+
+	t.Run("descendant", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		st := parsePath(t, "..tag1.tag2..tag3[1]").Steps
+
+		rq.Len(st, 3)
+		rq.Equal("tag1", st[0].Name)
+		rq.True(st[0].Descendant)
+		rq.Equal("tag2", st[1].Name)
+		rq.False(st[1].Descendant)
+		rq.Equal("tag3", st[2].Name)
+		rq.Equal(1, st[2].Index)
+		rq.True(st[2].Descendant)
+	})
+}
+
+func TestParseFilters(t *testing.T) {
+	t.Parallel()
+
+	t.Run("attribute exists", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := parseStep(t, "tag[@attr]")
+
+		rq.Equal("tag", res.Name)
+		rq.Equal(-1, res.Index)
+		rq.Len(res.Filters, 1)
+		rq.Equal(domain.Filter{Attribute: "attr", Operator: domain.FilterExists}, res.Filters[0])
+	})
+
+	t.Run("equal", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := parseStep(t, "tag[@attr='1.0 #value']")
+
+		rq.Len(res.Filters, 1)
+		rq.Equal(domain.Filter{Attribute: "attr", Operator: domain.FilterEqual, Value: "1.0 #value"}, res.Filters[0])
+	})
+
+	t.Run("not equal", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := parseStep(t, `tag[@attr!="value"]`)
+
+		rq.Len(res.Filters, 1)
+		rq.Equal(domain.Filter{Attribute: "attr", Operator: domain.FilterNotEqual, Value: "value"}, res.Filters[0])
+	})
+
+	t.Run("regexp with index", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		path := parsePath(t, "tag[@attr=~'^v[a-z]+'][2]#attr")
+		res := path.Steps[0]
+
+		rq.Equal("tag", res.Name)
+		rq.Equal(2, res.Index)
+		rq.Len(res.Filters, 1)
+		rq.Equal(domain.Filter{Attribute: "attr", Operator: domain.FilterMatch, Value: "^v[a-z]+"}, res.Filters[0])
+		rq.Equal("attr", path.Attribute.Name)
+	})
+
+	t.Run("several filters", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := parseStep(t, "tag[@attr1][@attr2='value']")
+
+		rq.Len(res.Filters, 2)
+		rq.Equal("attr1", res.Filters[0].Attribute)
+		rq.Equal("attr2", res.Filters[1].Attribute)
+	})
+
+	t.Run("child exists", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := parseStep(t, "tag[title]")
+
+		rq.Equal([]domain.Filter{{Child: []string{"title"}, Operator: domain.FilterExists}}, res.Filters)
+	})
+
+	t.Run("child text", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := parseStep(t, "tag[title='Name']")
+
+		rq.Equal([]domain.Filter{{Child: []string{"title"}, Operator: domain.FilterEqual, Value: "Name"}}, res.Filters)
+	})
+
+	t.Run("deep child number", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := parseStep(t, "tag[info.year>=1990]")
+
+		rq.Equal([]domain.Filter{
+			{Child: []string{"info", "year"}, Operator: domain.FilterGreaterOrEqual, Value: "1990"},
+		}, res.Filters)
+	})
+
+	t.Run("comparison operators", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for op, expected := range map[string]domain.FilterOperator{
+			"=":  domain.FilterEqual,
+			"!=": domain.FilterNotEqual,
+			"=~": domain.FilterMatch,
+			"<":  domain.FilterLess,
+			"<=": domain.FilterLessOrEqual,
+			">":  domain.FilterGreater,
+			">=": domain.FilterGreaterOrEqual,
+		} {
+			res := parseStep(t, "tag[@attr"+op+"10]")
+
+			rq.Len(res.Filters, 1)
+			rq.Equal(expected, res.Filters[0].Operator)
+			rq.Equal("attr", res.Filters[0].Attribute)
+			rq.Equal("10", res.Filters[0].Value)
+		}
+	})
+}
+
+func TestParseSlice(t *testing.T) {
+	t.Parallel()
+
+	t.Run("last", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := parseStep(t, "tag[-1]")
+
+		rq.Equal("tag", res.Name)
+		rq.Equal(-1, res.Index)
+		rq.Equal(&domain.Slice{Start: -1, Step: 1}, res.Slice)
+	})
+
+	t.Run("negative index", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res := parseStep(t, "tag[-3]")
+
+		rq.Equal(&domain.Slice{Start: -3, End: -2, HasEnd: true, Step: 1}, res.Slice)
+	})
+
+	t.Run("slices", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, expected := range map[string]domain.Slice{
+			"tag[-3:]":    {Start: -3, Step: 1},
+			"tag[2:5]":    {Start: 2, End: 5, HasEnd: true, Step: 1},
+			"tag[::2]":    {Step: 2},
+			"tag[1:-1:3]": {Start: 1, End: -1, HasEnd: true, Step: 3},
+		} {
+			res := parseStep(t, s)
+			rq.Equal("tag", res.Name)
+			rq.Equal(-1, res.Index)
+			rq.Equal(&expected, res.Slice, s)
+		}
+	})
+}
+
+func TestParsePipeAndUnion(t *testing.T) {
+	t.Parallel()
+
+	t.Run("union", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse(".tag1.tag2, .tag1[@id='a,b'].tag3#attr")
+		rq.NoError(err)
+
+		u, ok := n.(Union)
+		rq.True(ok)
+		rq.Len(u.Branches, 2)
+		rq.Equal("a,b", u.Branches[1].(Path).Steps[0].Filters[0].Value)
+		rq.Equal("attr", u.Branches[1].(Path).Attribute.Name)
+	})
+
+	t.Run("pipe", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse(".tag1[@re=~'a|b'] | ..tag2, .tag3 | .")
+		rq.NoError(err)
+
+		pipe, ok := n.(Pipe)
+		rq.True(ok)
+		rq.Len(pipe.Stages, 3)
+		rq.Equal("a|b", pipe.Stages[0].(Path).Steps[0].Filters[0].Value)
+		rq.Len(pipe.Stages[1].(Union).Branches, 2)
+		rq.Empty(pipe.Stages[2].(Path).Steps)
+	})
+}
+
+func TestParseFunctions(t *testing.T) {
+	t.Parallel()
+
+	t.Run("call", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse("count(.objects.object[@id], ..item | .title)")
+		rq.NoError(err)
+
+		call, ok := n.(Call)
+		rq.True(ok)
+		rq.Equal(FunctionCount, call.Function)
+		rq.Len(Paths(call), 2)
+	})
+
+	t.Run("tag named as function", func(t *testing.T) {
+		t.Parallel()
+
+		path := parsePath(t, "count.text")
+		require.Len(t, path.Steps, 2)
+
+		n, err := Parse(`.a | .count | "text"`)
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "count", "text"}, names(Paths(n)[0]))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, column := range map[string]int{
+			"median(.a)":     1,
+			"count(.a":       9,
+			"count()":        7,
+			"count(.a) | .b": 13,
+			".a | count(.b)": 6,
+			".a | .b | name": 11,
+			".a | del(.b)":   6,
+		} {
+			_, err := Parse(s)
+
+			var qe *Error
+			rq.ErrorAs(err, &qe, s)
+			rq.Equal(column, qe.Column, s)
+		}
+	})
+}
+
+func TestParseAggregations(t *testing.T) {
+	t.Parallel()
+
+	t.Run("values", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse("sum(.PurchaseOrder.Items.Item.USPrice)")
+		rq.NoError(err)
+
+		call, ok := Function(n)
+		rq.True(ok)
+		rq.Equal(FunctionSum, call.Function)
+		rq.Nil(call.Key)
+		rq.Equal([]string{"PurchaseOrder", "Items", "Item", "USPrice"}, names(Paths(n)[0]))
+	})
+
+	t.Run("group", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse("group_by(.objects.object; .title#lang) | sum(.info#budget) | rtrimstr('.0')")
+		rq.NoError(err)
+
+		call, ok := Function(n)
+		rq.True(ok)
+		rq.Equal(FunctionGroupBy, call.Function)
+		rq.Equal([]string{"objects", "object"}, names(Paths(n)[0]))
+
+		key := Paths(call.Key)
+		rq.Len(key, 1)
+		rq.Equal([]string{"title"}, names(key[0]))
+		rq.Equal("lang", key[0].Attribute.Name)
+
+		agg, ok := Aggregation(n)
+		rq.True(ok)
+		rq.Equal(FunctionSum, agg.Function)
+		rq.Equal([]string{"info"}, names(Paths(agg.Argument)[0]))
+		rq.Len(Transforms(n), 1)
+	})
+
+	t.Run("group count", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse("group_by(.objects.object; .) | count")
+		rq.NoError(err)
+
+		agg, ok := Aggregation(n)
+		rq.True(ok)
+		rq.Equal(FunctionCount, agg.Function)
+		rq.Nil(agg.Argument)
+
+		n, err = Parse("unique_by(..item; .name | lower)")
+		rq.NoError(err)
+		_, ok = Aggregation(n)
+		rq.False(ok)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, column := range map[string]int{
+			"group_by(.a)":                     12,
+			"group_by(.a;)":                    13,
+			"sum(.a; .b)":                      7,
+			"group_by(.a; .b) | sum":           23,
+			"group_by(.a; .b) | .c":            20,
+			"unique_by(.a; .b) | count":        19,
+			"unique_by(.a; .b) | upper":        19,
+			"group_by(.a; .b) | count | count": 28,
+		} {
+			_, err := Parse(s)
+
+			var qe *Error
+			rq.ErrorAs(err, &qe, s)
+			rq.Equal(column, qe.Column, s)
+		}
+	})
+}
+
+func TestParseOrders(t *testing.T) {
+	t.Parallel()
+
+	t.Run("orders", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse(".objects.object | select(@id) | sort_by(.title#lang | lower) | reverse | unique")
+		rq.NoError(err)
+
+		paths := Paths(n)
+		rq.Len(paths, 1)
+		rq.Equal([]string{"objects", "object"}, names(paths[0]))
+		rq.Empty(Transforms(n))
+
+		orders := Orders(n)
+		rq.Len(orders, 3)
+		rq.Equal(FunctionSortBy, orders[0].Function)
+		key := Paths(orders[0].Key)
+		rq.Equal([]string{"title"}, names(key[0]))
+		rq.Equal("lang", key[0].Attribute.Name)
+		rq.Len(Transforms(orders[0].Key), 1)
+		rq.Equal(Order{Function: FunctionReverse}, orders[1])
+		rq.Equal(Order{Function: FunctionUnique}, orders[2])
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse(".a | .reverse | sort_by")
+		rq.NoError(err)
+		rq.Equal([]string{"a", "reverse", "sort_by"}, names(Paths(n)[0]))
+		rq.Empty(Orders(n))
+
+		n, err = Parse(".a | unique_by(.b) | unique_by(.c)")
+		rq.NoError(err)
+		rq.Len(Orders(n), 2)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, column := range map[string]int{
+			"reverse":                    1,
+			"sort_by(.a)":                1,
+			".a | reverse | .b":          16,
+			".a | unique | upper":        15,
+			".a | upper | unique":        14,
+			".a#id | reverse":            3,
+			"count(.a | reverse)":        12,
+			".a | sort_by(.b | reverse)": 19,
+			".a | sort_by(.b":            16,
+			".a | reverse(.b)":           13,
+		} {
+			_, err := Parse(s)
+
+			var qe *Error
+			rq.ErrorAs(err, &qe, s)
+			rq.Equal(column, qe.Column, s)
+		}
+	})
+}
+
+func TestParseVariables(t *testing.T) {
+	t.Parallel()
+
+	t.Run("values", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := ParseWithVariables(`.a[@id=$id] | select(.b != $b) | .c | sub($re; $ENV.PATH)`, map[string]string{
+			"id": "42",
+			"b":  "x y",
+			"re": `^\d+`,
+		})
+		rq.NoError(err)
+
+		steps := Paths(n)[0].Steps
+		rq.Equal("42", steps[0].Filters[0].Value)
+		rq.Equal("x y", steps[0].Condition.Filter.Value)
+		rq.Equal([]domain.Function{{Name: "sub", Args: []string{`^\d+`, os.Getenv("PATH")}}}, Transforms(n))
+	})
+
+	t.Run("literal replacement", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := ParseWithVariables(`.a | sub("(x)"; $r) | gsub("y"; $r)`, map[string]string{"r": "$1${2}"})
+		rq.NoError(err)
+
+		chain, err := transform.Compile(Transforms(n))
+		rq.NoError(err)
+		rq.Equal([]string{"$1${2}-$1${2}"}, chain.Apply("x-y"))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, column := range map[string]int{
+			".a[@id=$id]":                    8,
+			".a[@id=$ENV]":                   12,
+			".a[@id=$ENV.XQ_TEST_NOT_SET]":   13,
+			".a[$id]":                        4,
+			".a | ltrimstr($id)":             15,
+			".a | ltrimstr($ENV.PATH; $ENV)": 30,
+		} {
+			_, err := Parse(s)
+
+			var qe *Error
+			rq.ErrorAs(err, &qe, s)
+			rq.Equal(column, qe.Column, s)
+		}
+	})
+}
+
+func TestParseEdits(t *testing.T) {
+	t.Parallel()
+
+	t.Run("assign", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, value := range map[string]string{
+			`.objects.object[0].title = "New"`: "New",
+			`.objects.object[0].title = 42`:    "42",
+			`.objects.object[0].title = $v`:    "x y",
+		} {
+			n, err := ParseWithVariables(s, map[string]string{"v": "x y"})
+			rq.NoError(err, s)
+
+			edit, ok := Modification(n)
+			rq.True(ok, s)
+			rq.Equal(domain.EditAssign, edit.Operator, s)
+			rq.Equal(value, edit.Value, s)
+			rq.Len(Paths(n), 1, s)
+			rq.Len(Paths(n)[0].Steps, 3, s)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse(`.objects.object | .poster[@type="big"]#url |= sub("http:"; "https:") | trim`)
+		rq.NoError(err)
+
+		edit, ok := Modification(n)
+		rq.True(ok)
+		rq.Equal(domain.EditUpdate, edit.Operator)
+		rq.Equal([]domain.Function{
+			{Name: "sub", Args: []string{"http:", "https:"}},
+			{Name: "trim"},
+		}, edit.Functions)
+		rq.Empty(Transforms(n))
+
+		paths := Paths(n)
+		rq.Len(paths, 1)
+		rq.Equal("url", paths[0].Attribute.Name)
+		rq.Equal("poster", paths[0].Steps[2].Name)
+
+		n, err = Parse(".a[b=1]")
+		rq.NoError(err)
+		_, ok = Modification(n)
+		rq.False(ok)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse(`del(.objects.object | select(@id = 1) | .poster#url)`)
+		rq.NoError(err)
+
+		edit, ok := Modification(n)
+		rq.True(ok)
+		rq.Equal(domain.EditDelete, edit.Operator)
+
+		paths := Paths(n)
+		rq.Len(paths, 1)
+		rq.Len(paths[0].Steps, 3)
+		rq.NotNil(paths[0].Steps[1].Condition)
+		rq.Equal("url", paths[0].Attribute.Name)
+	})
+
+	t.Run("insert", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, expected := range map[string]Edit{
+			`.a.b += <c>x</c>`:        {Operator: domain.EditAppend, Value: "<c>x</c>"},
+			`before(.a.b; <c/> <d/>)`: {Operator: domain.EditBefore, Value: "<c/> <d/>"},
+			`after(.a.b; "<c>")`:      {Operator: domain.EditAfter, Value: "<c>"},
+			`wrap(.a.b; <c id="1"/>)`: {Operator: domain.EditWrap, Value: `<c id="1"/>`},
+			`unwrap(.a | select(.b))`: {Operator: domain.EditUnwrap},
+		} {
+			n, err := Parse(s)
+			rq.NoError(err, s)
+
+			edit, ok := Modification(n)
+			rq.True(ok, s)
+			rq.Equal(expected.Operator, edit.Operator, s)
+			rq.Equal(expected.Value, edit.Value, s)
+			rq.Len(Paths(n), 1, s)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, column := range map[string]int{
+			`.a, .b = "x"`:         8,
+			`.a | upper = "x"`:     12,
+			`.a | reverse |= "x"`:  14,
+			`.a#* = "x"`:           6,
+			`.a^ = "x"`:            5,
+			`.a = .b`:              6,
+			`.a |= "x"`:            7,
+			`.a |= upper |`:        14,
+			`count(.a) = 1`:        11,
+			`.a = "x" | upper`:     10,
+			`del(.a, .b)`:          1,
+			`del(.a | upper)`:      1,
+			`del(.a | reverse)`:    10,
+			`del(.a`:               7,
+			`del(.a) | upper`:      9,
+			`del(.a) = "x"`:        9,
+			`.a#id += <b/>`:        7,
+			`.a += 1`:              7,
+			`.a += <b/> | upper`:   12,
+			`after(.a#id; <b/>)`:   1,
+			`before(.a, .b; <c/>)`: 1,
+			`wrap(.a)`:             8,
+			`wrap(.a; 1)`:          10,
+			`unwrap(.a; <b/>)`:     10,
+		} {
+			_, err := Parse(s)
+
+			var qe *Error
+			rq.ErrorAs(err, &qe, s)
+			rq.Equal(column, qe.Column, s)
+		}
+	})
+}
+
+func TestParseSelect(t *testing.T) {
+	t.Parallel()
+
+	parseCondition := func(t *testing.T, s string) domain.Condition {
+		t.Helper()
+
+		n, err := Parse(s)
+		require.NoError(t, err, s)
+		paths := Paths(n)
+		require.Len(t, paths, 1, s)
+		steps := paths[0].Steps
+		require.NotNil(t, steps[len(steps)-1].Condition, s)
+
+		return *steps[len(steps)-1].Condition
+	}
+
+	filter := func(f domain.Filter) domain.Condition {
+		return domain.Condition{Operator: domain.ConditionFilter, Filter: f}
+	}
+
+	t.Run("comparisons", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		cond := parseCondition(t, ".Items.Item | select(.Quantity > 1 and .USPrice < 100)")
+
+		rq.Equal(domain.Condition{
+			Operator: domain.ConditionAnd,
+			Operands: []domain.Condition{
+				filter(domain.Filter{Child: []string{"Quantity"}, Operator: domain.FilterGreater, Value: "1"}),
+				filter(domain.Filter{Child: []string{"USPrice"}, Operator: domain.FilterLess, Value: "100"}),
+			},
+		}, cond)
+	})
+
+	t.Run("precedence", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		cond := parseCondition(t, ".a | select(@x == 1 or not(.b.c) and (d or @e))")
+
+		rq.Equal(domain.Condition{
+			Operator: domain.ConditionOr,
+			Operands: []domain.Condition{
+				filter(domain.Filter{Attribute: "x", Operator: domain.FilterEqual, Value: "1"}),
+				{
+					Operator: domain.ConditionAnd,
+					Operands: []domain.Condition{
+						{
+							Operator: domain.ConditionNot,
+							Operands: []domain.Condition{
+								filter(domain.Filter{Child: []string{"b", "c"}, Operator: domain.FilterExists}),
+							},
+						},
+						{
+							Operator: domain.ConditionOr,
+							Operands: []domain.Condition{
+								filter(domain.Filter{Child: []string{"d"}, Operator: domain.FilterExists}),
+								filter(domain.Filter{Attribute: "e", Operator: domain.FilterExists}),
+							},
+						},
+					},
+				},
+			},
+		}, cond)
+	})
+
+	t.Run("text and attributes of children", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		cond := parseCondition(t, ".a | select(. > 15 or .info#year > 2000 and not(b.c#id) or . | lower == 'x')")
+
+		rq.Equal(domain.Condition{
+			Operator: domain.ConditionOr,
+			Operands: []domain.Condition{
+				filter(domain.Filter{Self: true, Operator: domain.FilterGreater, Value: "15"}),
+				{
+					Operator: domain.ConditionAnd,
+					Operands: []domain.Condition{
+						filter(domain.Filter{Child: []string{"info"}, Attribute: "year", Operator: domain.FilterGreater, Value: "2000"}),
+						{
+							Operator: domain.ConditionNot,
+							Operands: []domain.Condition{
+								filter(domain.Filter{Child: []string{"b", "c"}, Attribute: "id", Operator: domain.FilterExists}),
+							},
+						},
+					},
+				},
+				filter(domain.Filter{
+					Self: true, Operator: domain.FilterEqual, Value: "x", Functions: []domain.Function{{Name: "lower"}},
+				}),
+			},
+		}, cond)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, column := range map[string]int{
+			".a | select(.info#)":     19,
+			".a | select(. >)":        16,
+			"select(.a)":              1,
+			".a | select()":           13,
+			".a | select(.b and)":     19,
+			".a | select(.b or)":      18,
+			".a | select(.b > 1":      19,
+			".a | select(..b)":        13,
+			".a | select(.b), .c":     16,
+			"count(select(.b))":       7,
+			".a | select(not(.b) .c)": 21,
+		} {
+			_, err := Parse(s)
+
+			var qe *Error
+			rq.ErrorAs(err, &qe, s)
+			rq.Equal(column, qe.Column, s)
+		}
+	})
+}
+
+func TestParseTransforms(t *testing.T) {
+	t.Parallel()
+
+	t.Run("values", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse(`.a.b#id | ascii_downcase | sub("^id-(\d+)"; "$1"; 'gi') | split(/,/)`)
+		rq.NoError(err)
+
+		rq.Equal([]domain.Function{
+			{Name: "ascii_downcase"},
+			{Name: "sub", Args: []string{`^id-(\d+)`, "$1", "gi"}},
+			{Name: "split", Args: []string{","}},
+		}, Transforms(n))
+		paths := Paths(n)
+		rq.Len(paths, 1)
+		rq.Equal([]string{"a", "b"}, names(paths[0]))
+		rq.Equal("id", paths[0].Attribute.Name)
+	})
+
+	t.Run("function", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse("text(.a) | trim | join(', ')")
+		rq.NoError(err)
+
+		call, ok := Function(n)
+		rq.True(ok)
+		rq.Equal(FunctionText, call.Function)
+		rq.Equal([]domain.Function{{Name: "trim"}, {Name: "join", Args: []string{", "}}}, Transforms(n))
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		step := parseStep(t, "a[title | lower | trim = 'name']")
+		rq.Equal([]domain.Filter{{
+			Child:     []string{"title"},
+			Operator:  domain.FilterEqual,
+			Value:     "name",
+			Functions: []domain.Function{{Name: "lower"}, {Name: "trim"}},
+		}}, step.Filters)
+
+		n, err := Parse(".a | select(@id | test('^a'; 'i'))")
+		rq.NoError(err)
+		rq.Equal([]domain.Filter{{
+			Attribute: "id",
+			Operator:  domain.FilterExists,
+			Functions: []domain.Function{{Name: "test", Args: []string{"^a", "i"}}},
+		}}, Paths(n)[0].Steps[0].Condition.Filters())
+		rq.Empty(Transforms(n))
+	})
+
+	t.Run("tags named as functions", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		n, err := Parse(`.a | .trim | "split"`)
+		rq.NoError(err)
+		rq.Equal([]string{"a", "trim", "split"}, names(Paths(n)[0]))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, column := range map[string]int{
+			"upper":                     1,
+			".a | upper | .b":           14,
+			".a | upper | select(@x)":   14,
+			".a#id | upper | .b":        17,
+			".a#id | .b | upper":        3,
+			".a | upper()":              12,
+			".a | upper('x')":           6,
+			".a | split":                6,
+			".a | test('(')":            6,
+			".a | match('a'; 'x')":      6,
+			".a | join(',' ',')":        15,
+			".a[@id | .b]":              10,
+			"count(.a) | upper | count": 21,
+		} {
+			_, err := Parse(s)
+
+			var qe *Error
+			rq.ErrorAs(err, &qe, s)
+			rq.Equal(column, qe.Column, s)
+		}
+	})
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("columns", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for s, column := range map[string]int{
+			"":                        1,
+			".a#b#c":                  5,
+			".a[":                     4,
+			".a[]":                    4,
+			".a[@]":                   5,
+			".a[='value']":            4,
+			".a[title~'value']":       9,
+			".a[ti tle]":              7,
+			".a[1:2:3:4]":             9,
+			".a[::0]":                 6,
+			".a[::-1]":                6,
+			".a[1.5]":                 4,
+			".a[1][2]":                7,
+			".a[1][@attr]":            7,
+			".a[@x='value]":           7,
+			".a | .b#c | .d":          8,
+			".a..":                    5,
+			"...a":                    3,
+			".имя[@атрибут=]":         15,
+			".a,":                     4,
+			".a[@attr=~'^a'] .b | $x": 22,
+		} {
+			_, err := Parse(s)
+			rq.Error(err, s)
+
+			var qe *Error
+			rq.ErrorAs(err, &qe, s)
+			rq.Equal(column, qe.Column, s)
+		}
+	})
+
+	t.Run("message", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		_, err := Parse(".a#b#c")
+		rq.EqualError(err, "column 5: unexpected `#`, expected end of query")
+	})
+}
@@ -0,0 +1,272 @@
+/*
+Package transform implements string functions applied to the values selected by the query.
+*/
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/tty2/xq/internal/domain"
+)
+
+// Names of the string functions.
+const (
+	Upper         = "upper"          // upper case
+	Lower         = "lower"          // lower case
+	ASCIIUpcase   = "ascii_upcase"   // upper case of ASCII letters only
+	ASCIIDowncase = "ascii_downcase" // lower case of ASCII letters only
+	Trim          = "trim"           // without leading and trailing whitespaces
+	Ltrimstr      = "ltrimstr"       // without the prefix: `ltrimstr("ID-")`
+	Rtrimstr      = "rtrimstr"       // without the suffix: `rtrimstr(".jpg")`
+	Replace       = "replace"        // all the substrings replaced: `replace("old"; "new")`
+	Split         = "split"          // values between separators: `split(", ")`
+	Join          = "join"           // all the values joined by separator: `join(", ")`
+	Test          = "test"           // `true` if the value matches regular expression: `test("^a"; "i")`
+	Match         = "match"          // capture groups of the match or the match itself: `match("(\d+)-(\d+)")`
+	Sub           = "sub"            // the first match replaced: `sub("(?P<y>\d+)"; "${y}")`
+	Gsub          = "gsub"           // all the matches replaced: `gsub("\s+"; " ")`
+)
+
+// Exists checks if there is a string function with the name.
+func Exists(name string) bool {
+	switch name {
+	case Upper, Lower, ASCIIUpcase, ASCIIDowncase, Trim, Ltrimstr, Rtrimstr, Replace, Split, Join, Test, Match,
+		Sub, Gsub:
+		return true
+	}
+
+	return false
+}
+
+type (
+	// Chain is a sequence of compiled string functions. Every function gets all the values the previous one
+	// returns: `split` can return several values and `join` returns the only one.
+	Chain []function
+
+	function func(values []string) []string
+)
+
+// Compile checks names and arguments of the functions and compiles their regular expressions.
+func Compile(functions []domain.Function) (Chain, error) {
+	chain := make(Chain, 0, len(functions))
+	for i := range functions {
+		fn, err := compile(functions[i])
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, fn)
+	}
+
+	return chain, nil
+}
+
+// Check checks name and arguments of the function.
+func Check(f domain.Function) error {
+	_, err := compile(f)
+
+	return err
+}
+
+// Apply returns results of the functions applied to the value.
+func (c Chain) Apply(value string) []string {
+	values := []string{value}
+	for _, fn := range c {
+		values = fn(values)
+	}
+
+	return values
+}
+
+func compile(f domain.Function) (function, error) {
+	switch f.Name {
+	case Upper, Lower, ASCIIUpcase, ASCIIDowncase, Trim:
+		return compileWithoutArgs(f)
+	case Ltrimstr, Rtrimstr, Replace, Split, Join:
+		return compileStrings(f)
+	case Test, Match, Sub, Gsub:
+		return compileRegexp(f)
+	}
+
+	return nil, fmt.Errorf("unknown function `%s`", f.Name)
+}
+
+// compileWithoutArgs compiles the functions without arguments.
+func compileWithoutArgs(f domain.Function) (function, error) {
+	err := arity(f, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	switch f.Name {
+	case Upper:
+		return each(strings.ToUpper), nil
+	case Lower:
+		return each(strings.ToLower), nil
+	case ASCIIUpcase:
+		return each(asciiCase('a', 'z', 'A'-'a')), nil
+	case ASCIIDowncase:
+		return each(asciiCase('A', 'Z', 'a'-'A')), nil
+	}
+
+	return each(strings.TrimSpace), nil
+}
+
+// compileStrings compiles the functions which arguments are strings.
+func compileStrings(f domain.Function) (function, error) {
+	args := 1
+	if f.Name == Replace {
+		args = 2
+	}
+	err := arity(f, args, args)
+	if err != nil {
+		return nil, err
+	}
+
+	switch f.Name {
+	case Ltrimstr:
+		return each(func(s string) string { return strings.TrimPrefix(s, f.Args[0]) }), nil
+	case Rtrimstr:
+		return each(func(s string) string { return strings.TrimSuffix(s, f.Args[0]) }), nil
+	case Replace:
+		return each(func(s string) string { return strings.ReplaceAll(s, f.Args[0], f.Args[1]) }), nil
+	case Split:
+		return func(values []string) []string {
+			var res []string
+			for i := range values {
+				res = append(res, strings.Split(values[i], f.Args[0])...)
+			}
+
+			return res
+		}, nil
+	}
+
+	return func(values []string) []string {
+		return []string{strings.Join(values, f.Args[0])}
+	}, nil
+}
+
+// compileRegexp compiles the functions which first argument is regular expression and the last optional one
+// is flags: `g` applies the function to all the matches, `i`, `m` and `s` are flags of the expression.
+func compileRegexp(f domain.Function) (function, error) {
+	args := 1
+	if f.Name == Sub || f.Name == Gsub {
+		args = 2
+	}
+	err := arity(f, args, args+1)
+	if err != nil {
+		return nil, err
+	}
+
+	global := f.Name == Gsub
+	var flags string
+	if len(f.Args) > args {
+		for _, flag := range f.Args[args] {
+			switch flag {
+			case 'g':
+				global = true
+			case 'i', 'm', 's':
+				flags += string(flag)
+			default:
+				return nil, fmt.Errorf("unknown flag `%c` of function `%s`", flag, f.Name)
+			}
+		}
+	}
+
+	pattern := f.Args[0]
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression of function `%s`: %w", f.Name, err)
+	}
+
+	switch f.Name {
+	case Test:
+		return each(func(s string) string { return fmt.Sprint(re.MatchString(s)) }), nil
+	case Match:
+		return matches(re, global), nil
+	}
+
+	replacement := f.Args[1]
+	if global {
+		return each(func(s string) string { return re.ReplaceAllString(s, replacement) }), nil
+	}
+
+	return each(func(s string) string {
+		loc := re.FindStringSubmatchIndex(s)
+		if loc == nil {
+			return s
+		}
+
+		return s[:loc[0]] + string(re.ExpandString(nil, replacement, s, loc)) + s[loc[1]:]
+	}), nil
+}
+
+// matches returns function which replaces every value with capture groups of the match or with the match itself
+// if there are no groups. Values that don't match are dropped.
+func matches(re *regexp.Regexp, global bool) function {
+	n := 1
+	if global {
+		n = -1
+	}
+
+	return func(values []string) []string {
+		var res []string
+		for i := range values {
+			for _, m := range re.FindAllStringSubmatch(values[i], n) {
+				if len(m) == 1 {
+					res = append(res, m[0])
+
+					continue
+				}
+				res = append(res, m[1:]...)
+			}
+		}
+
+		return res
+	}
+}
+
+// each returns function which applies `fn` to every value.
+func each(fn func(string) string) function {
+	return func(values []string) []string {
+		res := make([]string, len(values))
+		for i := range values {
+			res[i] = fn(values[i])
+		}
+
+		return res
+	}
+}
+
+// asciiCase returns function which shifts ASCII letters from `from` to `to` by `shift` leaving the other ones.
+func asciiCase(from, to, shift rune) func(string) string {
+	return func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if r >= from && r <= to {
+				return r + shift
+			}
+
+			return r
+		}, s)
+	}
+}
+
+// arity checks that number of the function arguments is between `minArgs` and `maxArgs`.
+func arity(f domain.Function, minArgs, maxArgs int) error {
+	if len(f.Args) >= minArgs && len(f.Args) <= maxArgs {
+		return nil
+	}
+
+	switch {
+	case minArgs == maxArgs && minArgs == 0:
+		return fmt.Errorf("function `%s` doesn't take arguments", f.Name)
+	case minArgs == maxArgs:
+		return fmt.Errorf("function `%s` takes %d argument(s), got %d", f.Name, minArgs, len(f.Args))
+	}
+
+	return fmt.Errorf("function `%s` takes %d to %d arguments, got %d", f.Name, minArgs, maxArgs, len(f.Args))
+}
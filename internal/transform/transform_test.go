@@ -0,0 +1,134 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tty2/xq/internal/domain"
+)
+
+// nolint lll: there are long strings on purpose
+func TestApply(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name      string
+		functions []domain.Function
+		value     string
+		expected  []string
+	}{
+		{
+			name:      "case",
+			functions: []domain.Function{{Name: Upper}},
+			value:     "ärger",
+			expected:  []string{"ÄRGER"},
+		},
+		{
+			name:      "ascii case",
+			functions: []domain.Function{{Name: ASCIIUpcase}},
+			value:     "ärger",
+			expected:  []string{"äRGER"},
+		},
+		{
+			name:      "ascii downcase",
+			functions: []domain.Function{{Name: ASCIIDowncase}},
+			value:     "ÄBC",
+			expected:  []string{"Äbc"},
+		},
+		{
+			name:      "trim",
+			functions: []domain.Function{{Name: Trim}, {Name: Ltrimstr, Args: []string{"ID-"}}, {Name: Rtrimstr, Args: []string{"/"}}},
+			value:     " ID-10/\n",
+			expected:  []string{"10"},
+		},
+		{
+			name:      "split and join",
+			functions: []domain.Function{{Name: Split, Args: []string{", "}}, {Name: Lower}, {Name: Join, Args: []string{";"}}},
+			value:     "A, B, C",
+			expected:  []string{"a;b;c"},
+		},
+		{
+			name:      "split",
+			functions: []domain.Function{{Name: Split, Args: []string{","}}},
+			value:     "a,,b",
+			expected:  []string{"a", "", "b"},
+		},
+		{
+			name:      "replace",
+			functions: []domain.Function{{Name: Replace, Args: []string{"a", "b"}}},
+			value:     "aaa",
+			expected:  []string{"bbb"},
+		},
+		{
+			name:      "test",
+			functions: []domain.Function{{Name: Test, Args: []string{"^a", "i"}}},
+			value:     "Abc",
+			expected:  []string{"true"},
+		},
+		{
+			name:      "match groups",
+			functions: []domain.Function{{Name: Match, Args: []string{`(\d+)-(\d+)`}}},
+			value:     "10-20, 30-40",
+			expected:  []string{"10", "20"},
+		},
+		{
+			name:      "match all",
+			functions: []domain.Function{{Name: Match, Args: []string{`\d+`, "g"}}},
+			value:     "10-20, 30",
+			expected:  []string{"10", "20", "30"},
+		},
+		{
+			name:      "no match",
+			functions: []domain.Function{{Name: Match, Args: []string{`\d+`}}, {Name: Join, Args: []string{","}}},
+			value:     "abc",
+			expected:  []string{""},
+		},
+		{
+			name:      "sub",
+			functions: []domain.Function{{Name: Sub, Args: []string{`(?P<n>\d+)`, "<${n}>"}}},
+			value:     "1 2",
+			expected:  []string{"<1> 2"},
+		},
+		{
+			name:      "gsub",
+			functions: []domain.Function{{Name: Gsub, Args: []string{`\s+`, " "}}},
+			value:     "a \n\tb  c",
+			expected:  []string{"a b c"},
+		},
+		{
+			name:      "sub with flags",
+			functions: []domain.Function{{Name: Sub, Args: []string{"a", "x", "gi"}}},
+			value:     "AbA",
+			expected:  []string{"xbx"},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			chain, err := Compile(tc.functions)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, chain.Apply(tc.value))
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	rq := require.New(t)
+
+	rq.NoError(Check(domain.Function{Name: Gsub, Args: []string{"a", "b", "g"}}))
+
+	for _, f := range []domain.Function{
+		{Name: "sum"},
+		{Name: Upper, Args: []string{"a"}},
+		{Name: Split},
+		{Name: Replace, Args: []string{"a"}},
+		{Name: Test, Args: []string{"a", "i", "g"}},
+		{Name: Test, Args: []string{"a", "x"}},
+		{Name: Match, Args: []string{"("}},
+	} {
+		rq.Error(Check(f), f.String())
+	}
+}
@@ -3,13 +3,17 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"os"
 )
 
 func main() {
 	q := getQuery()
-	q.parse()
+	err := q.parse()
+	if err != nil {
+		log.Fatal(queryError(q.request, err))
+	}
 
 	proc, err := getProcessor(q)
 	if err != nil {
@@ -18,6 +22,15 @@ func main() {
 
 	r := bufio.NewReader(os.Stdin)
 
+	if q.edit != nil {
+		err = printDocument(os.Stdout, proc, r)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
 	c := proc.Process(r)
 
 	for {
@@ -26,6 +39,49 @@ func main() {
 			break
 		}
 
+		if q.nul {
+			fmt.Print(line + "\x00") // nolint forbidigo: print is executed on purpose here
+
+			continue
+		}
 		fmt.Println(line) // nolint forbidigo: print is executed on purpose here
 	}
+
+	if err := proc.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// printDocument writes the document modified by the processor to `w`. The document is kept in a temporary file
+// while it's read, so nothing is written if the document turns out to be incorrect.
+func printDocument(w io.Writer, proc prc, r *bufio.Reader) error {
+	f, err := os.CreateTemp("", "xq-*.xml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	buf := bufio.NewWriter(f)
+	for part := range proc.Process(r) {
+		if err == nil {
+			_, err = buf.WriteString(part)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err = proc.Err(); err != nil {
+		return err
+	}
+
+	if err = buf.Flush(); err != nil {
+		return err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+
+	return err
 }
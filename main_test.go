@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// argsVariable keeps the arguments xq is run with by the test binary.
+const argsVariable = "XQ_TEST_ARGS"
+
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv(argsVariable); ok {
+		os.Args = append([]string{"xq"}, strings.Split(args, "\n")...)
+		main()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// xq runs xq with the arguments on the data and returns its output, error output and exit code.
+func xq(t *testing.T, data string, args ...string) (string, string, int) {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0]) // nolint gosec: the test binary runs itself
+	cmd.Env = append(os.Environ(), argsVariable+"="+strings.Join(args, "\n"))
+	cmd.Stdin = strings.NewReader(data)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return stdout.String(), stderr.String(), exitErr.ExitCode()
+	}
+	require.NoError(t, err)
+
+	return stdout.String(), stderr.String(), 0
+}
+
+// nolint lll: there are long strings on purpose
+func TestProcessingErrors(t *testing.T) {
+	t.Parallel()
+
+	malformed := "<a><c>x</c><c>y</d></a>"
+
+	t.Run("values found before the error are printed", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		data := "<a>" + strings.Repeat("<c>x</c>", 1000) + "<c>y</d></a>" // the values of the first chunks are printed
+		for _, args := range [][]string{{"-t", ".a.c"}, {".a.c | upper"}, {"-t", ".a.c, .a.b"}} {
+			stdout, stderr, code := xq(t, data, args...)
+			rq.Equal(1, code, args)
+			rq.True(strings.HasPrefix(strings.ToLower(stdout), "x\nx\n"), args)
+			rq.NotContains(stdout, "incorrect", args)
+			rq.Contains(stderr, "incorrect xml structure: the last open tag is `c`, but close tag is `d`", args)
+		}
+	})
+
+	t.Run("results of the whole document aren't printed", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for _, args := range [][]string{{"sum(.a.c)"}, {".a.c | sort_by(.)"}, {"group_by(.a.c; .)"}} {
+			stdout, stderr, code := xq(t, malformed, args...)
+			rq.Equal(1, code, args)
+			rq.Empty(stdout, args)
+			rq.Contains(stderr, "incorrect xml structure", args)
+		}
+	})
+
+	t.Run("functions can't be applied to values", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		stdout, stderr, code := xq(t, "<a><c>1</c><c>x</c></a>", "sum(.a.c)")
+		rq.Equal(1, code)
+		rq.Empty(stdout)
+		rq.Contains(stderr, "function `sum` can't be applied to `x`: value isn't a number")
+	})
+
+	t.Run("correct document", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		stdout, stderr, code := xq(t, "<a><c>1</c><c>2</c></a>", "sum(.a.c)")
+		rq.Equal(0, code)
+		rq.Equal("3\n", stdout)
+		rq.Empty(stderr)
+	})
+}
+
+func TestPathsCommand(t *testing.T) {
+	t.Parallel()
+	rq := require.New(t)
+
+	data := "<paths><a>1</a></paths>"
+
+	stdout, stderr, code := xq(t, data, "paths", ".")
+	rq.Equal(0, code)
+	rq.Equal(".paths[0]\n.paths[0].a[0]\n", stdout)
+	rq.Empty(stderr)
+
+	stdout, stderr, code = xq(t, data, "-t", "paths") // the query selecting the root tag `paths`
+	rq.Equal(0, code)
+	rq.Equal("1\n", stdout)
+	rq.Empty(stderr)
+}
@@ -2,24 +2,240 @@ package main
 
 import (
 	"bufio"
+	"strings"
 
+	"github.com/tty2/xq/internal/aggregate"
 	"github.com/tty2/xq/internal/domain"
 	"github.com/tty2/xq/internal/formatter"
 	"github.com/tty2/xq/internal/processor"
+	"github.com/tty2/xq/internal/query"
+	"github.com/tty2/xq/internal/transform"
 )
 
 const (
 	indentItemSize = 2
 )
 
+// prc prints the values found in the data. Errors aren't values, they are returned by `Err` when the channel
+// is closed.
 type prc interface {
 	Process(r *bufio.Reader) chan string
+	Err() error
 }
 
-func getProcessor(q query) (prc, error) {
+// transformer applies string functions to every value found by the processor.
+type transformer struct {
+	prc   prc
+	chain transform.Chain
+}
+
+func (t transformer) Process(r *bufio.Reader) chan string {
+	values := t.prc.Process(r)
+	c := make(chan string)
+
+	go func() {
+		defer close(c)
+		for value := range values {
+			for _, v := range t.chain.Apply(value) {
+				c <- v
+			}
+		}
+	}()
+
+	return c
+}
+
+func (t transformer) Err() error {
+	return t.prc.Err()
+}
+
+// formatted prints every tag found by the processor indented and colorized as the whole document is printed.
+type formatted struct {
+	prc prc
+	err error
+}
+
+func (f *formatted) Process(r *bufio.Reader) chan string {
+	tags := f.prc.Process(r)
+	c := make(chan string)
+
+	go func() {
+		defer close(c)
+		for tag := range tags {
+			if f.err != nil { // the processor is drained to let it finish
+				continue
+			}
+			fp, err := formatter.New(indentItemSize)
+			if err != nil {
+				f.err = err
+
+				continue
+			}
+			for line := range fp.Process(bufio.NewReader(strings.NewReader(tag))) {
+				c <- line
+			}
+			f.err = fp.Err()
+		}
+	}()
+
+	return c
+}
+
+func (f *formatted) Err() error {
+	if f.err != nil {
+		return f.err
+	}
+
+	return f.prc.Err()
+}
+
+func getProcessor(q search) (prc, error) {
+	p, err := getSearchProcessor(q)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case q.isAggregation():
+		p = aggregate.New(p, q.function)
+	case q.key != nil:
+		p, err = getGroups(q, p)
+		if err != nil {
+			return nil, err
+		}
+	case len(q.orders) > 0:
+		return getOrder(q, p)
+	}
+
+	if len(q.transforms) == 0 {
+		return p, nil
+	}
+
+	chain, err := transform.Compile(q.transforms)
+	if err != nil {
+		return nil, err
+	}
+
+	return transformer{
+		prc:   p,
+		chain: chain,
+	}, nil
+}
+
+func getSearchProcessor(q search) (prc, error) {
+	if len(q.union) > 0 {
+		processors := make([]*processor.Processor, 0, len(q.union))
+		for i := range q.union {
+			p, err := processor.New(q.union[i].path, q.union[i].attribute, q.union[i].searchType)
+			if err != nil {
+				return nil, err
+			}
+			p.SetPathOptions(q.paths)
+			if q.text || q.function == query.FunctionText {
+				p.SetText()
+			}
+			processors = append(processors, p)
+		}
+
+		return processor.NewUnion(processors...), nil
+	}
+
 	if len(q.path) == 0 && q.searchType == domain.TagValue {
 		return formatter.New(indentItemSize)
 	}
 
-	return processor.New(q.path, q.attribute, q.searchType)
+	p, err := processor.New(q.path, q.attribute, q.searchType)
+	if err != nil {
+		return nil, err
+	}
+	p.SetPathOptions(q.paths)
+	if q.text || q.function == query.FunctionText {
+		p.SetText()
+	}
+	if q.edit != nil {
+		err = p.SetEdit(*q.edit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// getGroups returns processor grouping the tags found by `source` by the key of the search.
+func getGroups(q search, source prc) (prc, error) {
+	key, err := getEvaluator(*q.key)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.function == query.FunctionUniqueBy { // the whole tags are printed as `| unique_by(key)` prints them
+		return &formatted{
+			prc: aggregate.NewOrder(source, aggregate.Stage{Function: aggregate.UniqueBy, Key: key}),
+		}, nil
+	}
+
+	var value aggregate.Evaluator
+	if q.value != nil {
+		value, err = getEvaluator(*q.value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	function := q.aggregation
+	if function == query.FunctionLength {
+		function = query.FunctionCount
+	}
+
+	return aggregate.NewGroups(source, key, value, function), nil
+}
+
+// getOrder returns processor printing the tags found by `source` reordered by the functions of the search.
+func getOrder(q search, source prc) (prc, error) {
+	stages := make([]aggregate.Stage, 0, len(q.orders))
+	for _, o := range q.orders {
+		stage := aggregate.Stage{
+			Function: o.function,
+		}
+		if o.key != nil {
+			key, err := getEvaluator(*o.key)
+			if err != nil {
+				return nil, err
+			}
+			stage.Key = key
+		}
+		stages = append(stages, stage)
+	}
+
+	return &formatted{
+		prc: aggregate.NewOrder(source, stages...),
+	}, nil
+}
+
+// getEvaluator returns function which evaluates the search relative to a tag.
+func getEvaluator(q search) (aggregate.Evaluator, error) {
+	p, err := processor.New(q.path, q.attribute, q.searchType)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := transform.Compile(q.transforms)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(tag []byte) ([]string, error) {
+		values, err := p.Evaluate(tag)
+		if err != nil || len(chain) == 0 {
+			return values, err
+		}
+
+		var res []string
+		for i := range values {
+			res = append(res, chain.Apply(values[i])...)
+		}
+
+		return res, nil
+	}, nil
 }
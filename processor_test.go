@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// run returns the values printed by the processor of the request and the error it stopped with. The data is read
+// by one byte, so the values found before the error are printed.
+func run(t *testing.T, request, data string) ([]string, error) {
+	t.Helper()
+	rq := require.New(t)
+
+	q := search{
+		request: request,
+	}
+	rq.NoError(q.parse())
+	p, err := getProcessor(q)
+	rq.NoError(err)
+
+	var res []string
+	for v := range p.Process(bufio.NewReader(iotest.OneByteReader(strings.NewReader(data)))) {
+		res = append(res, v)
+	}
+
+	return res, p.Err()
+}
+
+func TestProcessorErrors(t *testing.T) {
+	t.Parallel()
+
+	malformed := "<a><c>x y</c><c></d></a>"
+
+	t.Run("transforms", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res, err := run(t, `.a.c | upper | split(" ")`, malformed)
+		rq.EqualError(err, "incorrect xml structure: the last open tag is `c`, but close tag is `d`")
+		rq.Equal([]string{"X", "Y"}, res)
+	})
+
+	t.Run("aggregation and order", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for _, request := range []string{
+			"sum(.a.c)", "count(.a.c)", "group_by(.a.c; .) | count", ".a.c | sort_by(.)", ".a.c | reverse",
+		} {
+			res, err := run(t, request, malformed)
+			rq.Error(err, request)
+			rq.Empty(res, request)
+		}
+	})
+
+	t.Run("truncated document", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for request, expected := range map[string][]string{
+			".a.c | upper": {"X Y", "Z"},
+			"count(.a.c)":  {"3"},
+			"text(.a.c)":   {"x y", "z"},
+		} {
+			res, err := run(t, request, "<a><c>x y</c><c>z</c><c>unterminated")
+			rq.NoError(err, request)
+			rq.Equal(expected, res, request)
+		}
+	})
+}
+
+func TestPrintDocument(t *testing.T) {
+	t.Parallel()
+
+	edit := func(t *testing.T, request, data string) (string, error) {
+		t.Helper()
+		rq := require.New(t)
+
+		q := search{
+			request: request,
+		}
+		rq.NoError(q.parse())
+		p, err := getProcessor(q)
+		rq.NoError(err)
+
+		var w bytes.Buffer
+		err = printDocument(&w, p, bufio.NewReader(iotest.OneByteReader(strings.NewReader(data))))
+
+		return w.String(), err
+	}
+
+	t.Run("correct document", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res, err := edit(t, `.a.c = "x"`, "<a><b>1</b><c>2</c></a>\n")
+		rq.NoError(err)
+		rq.Equal("<a><b>1</b><c>x</c></a>\n", res)
+	})
+
+	t.Run("incorrect document", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for _, data := range []string{"<a><b>1</b><c>unterminated", "<a><b>1</b><c>2</d></a>"} {
+			res, err := edit(t, `.a.c = "x"`, data)
+			rq.Error(err, data)
+			rq.Empty(res, data)
+		}
+	})
+}
+
+func TestUniqueBy(t *testing.T) {
+	t.Parallel()
+	rq := require.New(t)
+
+	data := `<a><b k="2"><c>1</c></b><b k="1">2</b><b k="2">3</b></a>`
+
+	res, err := run(t, "unique_by(.a.b; .#k)", data)
+	rq.NoError(err)
+	colors := regexp.MustCompile("\x1b\\[[0-9;]*m")
+	rq.Equal([]string{`<b k="1">`, "  2", "</b>", `<b k="2">`, "  <c>", "    1", "  </c>", "</b>"},
+		strings.Split(colors.ReplaceAllString(strings.Join(res, "\n"), ""), "\n"))
+
+	piped, err := run(t, ".a.b | unique_by(.#k)", data)
+	rq.NoError(err)
+	rq.Equal(res, piped)
+}
+
+func TestPipe(t *testing.T) {
+	t.Parallel()
+
+	objects := `<objects><object><title lang="en">a</title><title lang="ru">b</title></object>` +
+		`<object><title>c</title><title lang="de">d</title></object></objects>`
+	x := "<x><y>1</y><y>2</y><z><y>3</y></z></x>"
+
+	t.Run("values", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		res, err := run(t, ".objects.object | .title#lang", objects)
+		rq.NoError(err)
+		rq.Equal([]string{"en", "ru", "de"}, res)
+
+		res, err = run(t, ".x | .y[0] | trim", x)
+		rq.NoError(err)
+		rq.Equal([]string{"1"}, res)
+	})
+
+	t.Run("joined paths", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for _, tt := range []struct {
+			request, joined, data string
+		}{
+			{request: ".objects.object | .title#lang", joined: ".objects.object.title#lang", data: objects},
+			{request: ".objects | .object | .title[-1]", joined: ".objects.object.title[-1]", data: objects},
+			{request: ".x | .y[0]", joined: ".x.y[0]", data: x},
+			{request: ".x | ..y", joined: ".x..y", data: x},
+		} {
+			res, err := run(t, tt.request, tt.data)
+			rq.NoError(err, tt.request)
+			expected, err := run(t, tt.joined, tt.data)
+			rq.NoError(err, tt.joined)
+			rq.NotEmpty(res, tt.request)
+			rq.Equal(expected, res, tt.request)
+		}
+	})
+}
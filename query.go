@@ -1,45 +1,130 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/tty2/xq/internal/domain"
+	"github.com/tty2/xq/internal/processor"
+	"github.com/tty2/xq/internal/query"
 )
 
-type query struct {
-	request    string
-	firstArg   string // xq <firstArg> <path.to.tag>
-	path       []domain.Step
-	attribute  string
-	searchType domain.SearchType
+type search struct {
+	request     string
+	firstArg    string // xq <firstArg> <path.to.tag>
+	path        []domain.Step
+	attribute   domain.Attribute
+	searchType  domain.SearchType
+	globalIndex bool       // `[n]` is the n-th tag in the whole document instead of the n-th tag inside every parent
+	union       []search   // searches of the paths separated by comma: `.a.b, .a.c#id`
+	namespaces  []string   // namespace prefixes bindings: `s=http://schemas.xmlsoap.org/soap/envelope/`
+	variables   []variable // variables set by `--arg id 42` and `--argjson id 42`
+	libraries   []string   // directories of the query libraries set by `-L dir`
+	missing     string     // flag which value isn't set: `xq .a --ns`, `xq .a --arg id`
+	function    string     // function applied to the tags selected by the path: `count(.a.b)`
+	text        bool       // `-t` prints text of the tags without markup instead of the tags
+	nul         bool       // `-0` separates printed values by NUL instead of new line
+	// paths of the tags printed by `--with-path`, `--with-attrs` and `--with-values`
+	paths processor.PathOptions
+	// string functions applied to every printed value: `.a.b#id | ascii_downcase`
+	transforms []domain.Function
+	// key of the tags grouped by `group_by` and `unique_by` relative to every tag: `.title#lang`
+	key         *search
+	aggregation string  // function applied to every group of `group_by`: `| count`, `| sum(.USPrice)`
+	value       *search // values aggregated in every group relative to every tag: `.USPrice`
+	orders      []order // functions reordering the tags: `| sort_by(.title#lang) | reverse`
+	// modification of the tags printed with the whole document: `.a.b = "x"`, `.a.b#id |= ascii_upcase`
+	edit *processor.Edit
 }
 
-func getQuery() query {
-	var q query
-	args := os.Args[1:]
-	switch len(args) {
-	case 1:
-		q = query{
-			request: args[0],
-		}
-	case 2:
-		q = query{
-			firstArg: args[0],
-			request:  args[1],
+// variable is a value of the query variable. JSON value can be a string, number or boolean.
+type variable struct {
+	name  string
+	value string
+	json  bool
+}
+
+// order is a function reordering the tags with the key relative to every tag if the function takes it.
+type order struct {
+	function string
+	key      *search
+}
+
+func getQuery() search {
+	var q search
+	args := []string{}
+	for i := 1; i < len(os.Args); i++ {
+		switch arg := os.Args[i]; {
+		case arg == "--global-index":
+			q.globalIndex = true
+		case arg == "-t":
+			q.text = true
+		case arg == "-0":
+			q.nul = true
+		case arg == "--with-path":
+			q.paths.Prefix = true
+		case arg == "--with-attrs":
+			q.paths.Attributes = true
+		case arg == "--with-values":
+			q.paths.Values = true
+		case arg == "--ns":
+			if i+1 == len(os.Args) {
+				q.missing = arg
+
+				break
+			}
+			i++
+			q.namespaces = append(q.namespaces, os.Args[i])
+		case arg == "-L":
+			if i+1 == len(os.Args) {
+				q.missing = arg
+
+				break
+			}
+			i++
+			q.libraries = append(q.libraries, os.Args[i])
+		case arg == "--arg" || arg == "--argjson":
+			if i+2 >= len(os.Args) {
+				q.missing = arg
+				i = len(os.Args) // the name isn't the query
+
+				break
+			}
+			q.variables = append(q.variables, variable{
+				name:  os.Args[i+1],
+				value: os.Args[i+2],
+				json:  arg == "--argjson",
+			})
+			i += 2
+		default:
+			args = append(args, arg)
 		}
+	}
+
+	switch {
+	case len(args) == 1:
+		q.request = args[0]
+	case len(args) == 2:
+		q.firstArg = args[0]
+		q.request = args[1]
 	default: // ex: only xq is called without any args
-		q = query{
-			request:    ".",
-			searchType: domain.TagValue,
-		}
+		q.request = "."
+		q.searchType = domain.TagValue
 	}
 
 	return q
 }
 
-func (q *query) parse() {
+func (q *search) parse() error {
+	if q.missing != "" {
+		return fmt.Errorf("flag `%s` requires a value", q.missing)
+	}
+
 	switch q.firstArg {
 	case "":
 		q.searchType = domain.TagValue
@@ -47,77 +132,490 @@ func (q *query) parse() {
 		q.searchType = domain.TagList
 	case "attr":
 		q.searchType = domain.AttrList
+	case "paths":
+		q.searchType = domain.TagPath
+	default:
+		return fmt.Errorf("unknown command `%s`", q.firstArg)
 	}
 
-	q.path = q.getPath()
-	if len(q.path) == 0 {
-		return
+	namespaces, err := getNamespaces(q.namespaces)
+	if err != nil {
+		return err
 	}
 
-	q.attribute = q.getAttribute()
-	if q.attribute != "" {
-		q.searchType = domain.AttrValue
+	variables, err := getVariables(q.variables)
+	if err != nil {
+		return err
+	}
+
+	library, err := getLibrary(q.libraries)
+	if err != nil {
+		return err
+	}
+
+	node, err := library.Parse(q.request, variables)
+	if err != nil {
+		return err
+	}
+
+	if call, ok := query.Function(node); ok {
+		err = q.setFunction(call.Function)
+		if err != nil {
+			return err
+		}
+		err = q.setGroups(node, call, namespaces)
+		if err != nil {
+			return err
+		}
+	}
+
+	q.transforms = query.Transforms(node)
+	if len(q.transforms) > 0 && q.searchType == domain.TagValue { // string functions are applied to text of tags
+		q.searchType = domain.TagText
+	}
+
+	err = q.setOrders(node, namespaces)
+	if err != nil {
+		return err
+	}
+
+	err = q.setText()
+	if err != nil {
+		return err
+	}
+
+	if e, ok := query.Modification(node); ok {
+		err = q.setEdit(e)
+		if err != nil {
+			return err
+		}
 	}
+
+	paths := query.Paths(node)
+	for i := range paths {
+		err = q.checkAttribute(paths[i].Attribute)
+		if err != nil {
+			return err
+		}
+	}
+	err = q.checkPaths(paths)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 1 {
+		q.setPath(paths[0], namespaces)
+
+		return nil
+	}
+
+	for i := range paths {
+		sub := search{
+			firstArg:    q.firstArg,
+			searchType:  q.searchType,
+			globalIndex: q.globalIndex,
+			paths:       q.paths,
+			function:    q.function,
+		}
+		sub.setPath(paths[i], namespaces)
+		q.union = append(q.union, sub)
+	}
+
+	return nil
 }
 
-func (q *query) getPath() []domain.Step {
-	if q.request == "." {
-		return []domain.Step{}
+// setFunction sets search type of the function.
+func (q *search) setFunction(function string) error {
+	if q.firstArg != "" {
+		return fmt.Errorf("function `%s` can't be used together with command `%s`", function, q.firstArg)
 	}
 
-	path := strings.Split(q.request, ".")
+	q.function = function
+	switch function {
+	case query.FunctionCount, query.FunctionLength:
+		q.searchType = domain.TagCount
+	case query.FunctionName:
+		q.searchType = domain.TagName
+	case query.FunctionText:
+		q.searchType = domain.TagText
+	case query.FunctionKeys:
+		q.searchType = domain.TagList
+	case query.FunctionAttrs:
+		q.searchType = domain.AttrList
+	case query.FunctionSum, query.FunctionAvg, query.FunctionMin, query.FunctionMax:
+		q.searchType = domain.TagText
+	case query.FunctionGroupBy, query.FunctionUniqueBy:
+		q.searchType = domain.TagRaw
+	default:
+		return fmt.Errorf("unknown function `%s`", function)
+	}
 
-	if len(path) > 0 && path[0] == "" {
-		path = path[1:]
+	return nil
+}
+
+// setGroups sets the key and the values of every group if the function groups tags.
+func (q *search) setGroups(node query.Node, call query.Call, namespaces map[string]string) error {
+	if call.Key == nil {
+		return nil
 	}
 
-	steps := []domain.Step{}
-	for i := range path {
-		step := getStep(path[i])
-		steps = append(steps, step)
+	var err error
+	q.key, err = relativeSearch(call.Key, namespaces)
+	if err != nil {
+		return fmt.Errorf("invalid key of `%s`: %w", call.Function, err)
+	}
+
+	aggregation, ok := query.Aggregation(node)
+	if !ok {
+		return nil
+	}
+	q.aggregation = aggregation.Function
+	if aggregation.Argument == nil {
+		return nil
+	}
+	q.value, err = relativeSearch(aggregation.Argument, namespaces)
+	if err != nil {
+		return fmt.Errorf("invalid argument of `%s`: %w", aggregation.Function, err)
 	}
 
-	return steps
+	return nil
 }
 
-func getStep(s string) domain.Step {
-	var name string
-	var inBrackets bool
-	var num []byte
-	var i int
-	for ; i < len(s); i++ {
-		if s[i] == '#' {
-			break
+// setOrders sets the functions reordering the tags. The tags are found with their nested tags to be printed
+// whole after all of them are reordered.
+func (q *search) setOrders(node query.Node, namespaces map[string]string) error {
+	orders := query.Orders(node)
+	if len(orders) == 0 {
+		return nil
+	}
+	if q.firstArg != "" {
+		return fmt.Errorf("function `%s` can't be used together with command `%s`", orders[0].Function, q.firstArg)
+	}
+
+	for _, o := range orders {
+		ord := order{
+			function: o.Function,
 		}
-		if inBrackets {
-			if s[i] == ']' {
-				break
+		if o.Key != nil {
+			var err error
+			ord.key, err = relativeSearch(o.Key, namespaces)
+			if err != nil {
+				return fmt.Errorf("invalid key of `%s`: %w", o.Function, err)
 			}
-			num = append(num, s[i])
 		}
-		if s[i] == '[' {
-			name = s[:i]
-			inBrackets = true
+		q.orders = append(q.orders, ord)
+	}
+	q.searchType = domain.TagRaw
+
+	return nil
+}
+
+// setText sets search of text of the tags if it's requested by `-t`. Values of attributes are printed as usual.
+func (q *search) setText() error {
+	if !q.text {
+		return nil
+	}
+	if q.firstArg != "" || len(q.orders) > 0 || (q.function != "" && q.function != query.FunctionText) {
+		return errors.New("`-t` can be used only with queries selecting tags and attributes")
+	}
+	q.searchType = domain.TagText
+
+	return nil
+}
+
+// setEdit sets the modification of the tags. The whole document is printed, so the query can't contain
+// commands or `-t`.
+func (q *search) setEdit(e query.Edit) error {
+	if q.firstArg != "" {
+		return fmt.Errorf("`%s` can't be used together with command `%s`", e.Operator, q.firstArg)
+	}
+	if q.text {
+		return fmt.Errorf("`%s` can't be used together with `-t`", e.Operator)
+	}
+
+	q.edit = &processor.Edit{
+		Operator:  e.Operator,
+		Value:     e.Value,
+		Functions: e.Functions,
+	}
+	q.searchType = domain.TagEdit
+
+	return nil
+}
+
+// relativeSearch returns search of the values selected by the query relative to a tag: text of the tag by `.`,
+// its attribute by `.#attr`, text of its child by `.child`, etc.
+func relativeSearch(node query.Node, namespaces map[string]string) (*search, error) {
+	paths := query.Paths(node)
+	if len(paths) != 1 {
+		return nil, errors.New("there must be the only path")
+	}
+	if paths[0].Attribute.IsMultiple() {
+		return nil, errors.New("the only attribute can be selected")
+	}
+
+	q := search{
+		searchType: domain.TagText,
+		transforms: query.Transforms(node),
+	}
+	path := paths[0]
+	path.Steps = append([]domain.Step{{Name: domain.Wildcard, Index: -1}}, path.Steps...) // the tag itself
+	q.setPath(path, namespaces)
+
+	return &q, nil
+}
+
+// checkAttribute checks that the attribute can be selected by the query. Functions select tags, except
+// `attrs` which can select names of the attributes: `attrs(.a#/^data-/)` and the functions aggregating values
+// which can be attributes: `sum(.a#price)`.
+func (q *search) checkAttribute(attribute domain.Attribute) error {
+	if q.function == "" || !attribute.IsSet() {
+		return nil
+	}
+	if q.function == query.FunctionAttrs && attribute.IsMultiple() {
+		return nil
+	}
+	if q.isAggregation() && !attribute.IsMultiple() {
+		return nil
+	}
+
+	return fmt.Errorf("attribute can't be selected in argument of function `%s`", q.function)
+}
+
+// checkPaths checks that paths can be printed for the query: `paths` command prints paths of the tags and
+// `--with-path` prefixes values of the tags and attributes.
+func (q *search) checkPaths(paths []query.Path) error {
+	if q.firstArg == "paths" {
+		for i := range paths {
+			if paths[i].Attribute.IsSet() {
+				return errors.New("attribute can't be selected by command `paths`, use `--with-attrs`")
+			}
+		}
+
+		return nil
+	}
+
+	if q.paths.Attributes || q.paths.Values {
+		return errors.New("`--with-attrs` and `--with-values` can be used only with command `paths`")
+	}
+	if q.paths.Prefix && (q.firstArg != "" || q.function != "" || len(q.transforms) > 0 || len(q.orders) > 0 ||
+		q.edit != nil) {
+		return errors.New("`--with-path` can be used only with queries selecting tags and attributes")
+	}
+
+	return nil
+}
+
+// isAggregation checks if all the values found by the search are aggregated to the only one.
+func (q *search) isAggregation() bool {
+	switch q.function {
+	case query.FunctionSum, query.FunctionAvg, query.FunctionMin, query.FunctionMax:
+		return true
+	}
+
+	return false
+}
+
+func (q *search) setPath(path query.Path, namespaces map[string]string) {
+	q.path = path.Steps
+	q.attribute = path.Attribute
+	// the root tag: `text(.)`, `. = "x"`
+	if len(q.path) == 0 && (q.searchType == domain.TagText || q.searchType == domain.TagEdit) {
+		q.path = []domain.Step{{Name: domain.Wildcard, Index: -1}}
+	}
+	// `xq attr .tag#/^data-/` lists names of the selected attributes, otherwise their values are printed
+	if q.attribute.IsSet() && q.searchType != domain.TagEdit &&
+		!(q.searchType == domain.AttrList && q.attribute.IsMultiple()) {
+		q.searchType = domain.AttrValue
+	}
+	if !q.globalIndex {
+		positionsInParent(q.path)
+	}
+	bindNamespaces(q.path, namespaces)
+	q.attribute.Name, q.attribute.Namespace = bindAttribute(q.attribute.Name, namespaces)
+}
+
+// getNamespaces parses namespace prefixes bindings set by `--ns prefix=uri`.
+func getNamespaces(bindings []string) (map[string]string, error) {
+	namespaces := map[string]string{}
+	for _, b := range bindings {
+		i := strings.IndexByte(b, '=')
+		if i < 1 || i == len(b)-1 {
+			return nil, fmt.Errorf("invalid namespace binding `%s`, expected `prefix=uri`", b)
+		}
+		namespaces[b[:i]] = b[i+1:]
+	}
+
+	return namespaces, nil
+}
+
+// defaultLibrary is the library loaded if directories of the libraries aren't set, relative to the home directory.
+const defaultLibrary = ".config/xq/lib.xq"
+
+// getLibrary loads the definitions of all `*.xq` files of the directories or of the default library if the directories
+// aren't set and the default library exists.
+func getLibrary(dirs []string) (*query.Library, error) {
+	var files []string
+	if len(dirs) == 0 {
+		if home, err := os.UserHomeDir(); err == nil {
+			file := filepath.Join(home, defaultLibrary)
+			if info, err := os.Stat(file); err == nil && !info.IsDir() {
+				files = append(files, file)
+			}
+		}
+	}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid library directory: %w", err)
+		}
+		for _, entry := range entries { // names of the directory aren't patterns, so it isn't globbed
+			if !entry.IsDir() && filepath.Ext(entry.Name()) == ".xq" {
+				files = append(files, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+
+	library := query.NewLibrary()
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		err = library.Load(file, string(src))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return library, nil
+}
+
+// getVariables returns values of the query variables set by `--arg name value` and `--argjson name json`.
+func getVariables(variables []variable) (map[string]string, error) {
+	values := make(map[string]string, len(variables))
+	for _, v := range variables {
+		if v.name == "ENV" {
+			return nil, errors.New("variable `$ENV` is reserved for the environment variables")
+		}
+
+		value := v.value
+		if v.json {
+			var err error
+			value, err = jsonValue(v.value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSON value of variable `$%s`: %w", v.name, err)
+			}
 		}
+		values[v.name] = value
 	}
 
-	count, err := strconv.Atoi(string(num))
+	return values, nil
+}
+
+// jsonValue returns JSON string, number or boolean as it's compared by the query: `"42"` and `42` are `42`.
+func jsonValue(s string) (string, error) {
+	if !json.Valid([]byte(s)) {
+		return "", errors.New("value can't be parsed")
+	}
+
+	d := json.NewDecoder(strings.NewReader(s))
+	d.UseNumber()
+	var v interface{}
+	err := d.Decode(&v)
 	if err != nil {
-		count = -1
-		name = s[:i]
+		return "", err
+	}
+
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+
+	return "", errors.New("value must be a string, number or boolean")
+}
+
+// bindNamespaces sets namespaces of the steps which names have prefixes bound by the caller, so `s:Body`
+// matches `Body` tag of the namespace whatever prefix the document uses. Prefixes that aren't bound are
+// kept as a part of the name.
+func bindNamespaces(path []domain.Step, namespaces map[string]string) {
+	for i := range path {
+		for j := range path[i].Filters {
+			bindFilter(&path[i].Filters[j], namespaces)
+		}
+		if path[i].Condition != nil {
+			bindCondition(path[i].Condition, namespaces)
+		}
+		if path[i].Namespace != "" {
+			continue
+		}
+		uri, ok := namespaces[domain.Prefix(path[i].Name)]
+		if !ok {
+			continue
+		}
+		path[i].Namespace = uri
+		path[i].Name = domain.LocalName(path[i].Name)
+	}
+}
+
+// bindCondition binds prefixes of the attributes of the condition filters to the namespaces.
+func bindCondition(c *domain.Condition, namespaces map[string]string) {
+	if c.Operator == domain.ConditionFilter {
+		bindFilter(&c.Filter, namespaces)
+
+		return
+	}
+
+	for i := range c.Operands {
+		bindCondition(&c.Operands[i], namespaces)
+	}
+}
+
+// bindFilter binds prefix of the attribute of the filter to the namespace: `[@xl:href]`.
+func bindFilter(f *domain.Filter, namespaces map[string]string) {
+	if f.Namespace == "" {
+		f.Attribute, f.Namespace = bindAttribute(f.Attribute, namespaces)
+	}
+}
+
+// bindAttribute returns local name of the attribute and URI of the namespace its prefix is bound to. Names without
+// prefix or with the prefix which isn't bound are returned as is, attributes without prefix have no namespace.
+func bindAttribute(name string, namespaces map[string]string) (string, string) {
+	prefix := domain.Prefix(name)
+	uri, ok := namespaces[prefix]
+	if prefix == "" || !ok {
+		return name, ""
 	}
 
-	return domain.Step{
-		Name:  name,
-		Index: count,
+	return domain.LocalName(name), uri
+}
+
+// positionsInParent replaces indexes of the steps with slices selecting the only tag, so `[n]` selects
+// the n-th tag inside every parent as slices do.
+func positionsInParent(path []domain.Step) {
+	for i := range path {
+		if path[i].Index < 0 {
+			continue
+		}
+		path[i].Slice = &domain.Slice{
+			Start:  path[i].Index,
+			End:    path[i].Index + 1,
+			HasEnd: true,
+			Step:   1,
+		}
+		path[i].Index = -1
 	}
 }
 
-func (q *query) getAttribute() string {
-	sa := strings.Split(q.request, "#")
-	if len(sa) != 2 {
-		return ""
+// queryError returns error message pointing at the place of the request the error is found at.
+func queryError(request string, err error) string {
+	var qe *query.Error
+	if !errors.As(err, &qe) || qe.Line > 0 { // errors of the library don't point at the request
+		return "invalid query: " + err.Error()
 	}
 
-	return sa[1]
+	return fmt.Sprintf("invalid query: %s\n\t%s\n\t%s^", qe, request, strings.Repeat(" ", qe.Column-1))
 }
@@ -1,164 +1,177 @@
 package main
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 	"github.com/tty2/xq/internal/domain"
+	"github.com/tty2/xq/internal/processor"
+	"github.com/tty2/xq/internal/query"
 )
 
-func TestGetStep(t *testing.T) {
+func TestGetQuery(t *testing.T) {
 	t.Parallel()
 
-	t.Run("clean tag", func(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
 		t.Parallel()
 		rq := require.New(t)
-		tg := "tag"
 
-		res := getStep(tg)
+		os.Args = []string{"xq"}
+
+		q := getQuery()
 
-		rq.Equal(tg, res.Name)
-		rq.Equal(-1, res.Index)
+		rq.Equal(".", q.request)
+		rq.Empty(q.firstArg)
 	})
 
-	t.Run("with index", func(t *testing.T) {
+	t.Run("path only", func(t *testing.T) {
 		t.Parallel()
 		rq := require.New(t)
-		tg := "tag_name[3]"
 
-		res := getStep(tg)
+		os.Args = []string{"xq", ".tag1.tag2"}
+
+		q := getQuery()
 
-		rq.Equal("tag_name", res.Name)
-		rq.Equal(3, res.Index)
+		rq.Equal(".tag1.tag2", q.request)
+		rq.Empty(q.firstArg)
 	})
-}
 
-func TestGetAttribute(t *testing.T) {
-	t.Parallel()
-
-	t.Run("ok", func(t *testing.T) {
+	t.Run("path only", func(t *testing.T) {
 		t.Parallel()
 		rq := require.New(t)
 
-		q := query{
-			request: "tag1.tag2#attr",
-		}
-
-		q.path = q.getPath()
-		rq.Len(q.path, 2)
+		os.Args = []string{"xq", "tags", ".tag1.tag2"}
 
-		rq.Len(q.path, 2)
+		q := getQuery()
 
-		res := q.getAttribute()
-		rq.Equal("attr", res)
+		rq.Equal(".tag1.tag2", q.request)
+		rq.Equal("tags", q.firstArg)
 	})
-}
-
-func TestGetPath(t *testing.T) {
-	t.Parallel()
 
-	t.Run("empty path", func(t *testing.T) {
+	t.Run("path only", func(t *testing.T) {
 		t.Parallel()
 		rq := require.New(t)
 
-		q := query{
-			request: ".",
-		}
+		os.Args = []string{"xq", "attr", ".tag1.tag2#val"}
 
-		st := q.getPath()
+		q := getQuery()
 
-		rq.Len(st, 0)
+		rq.Equal(".tag1.tag2#val", q.request)
+		rq.Equal("attr", q.firstArg)
 	})
 
-	t.Run("without leading dot", func(t *testing.T) {
+	t.Run("global index", func(t *testing.T) {
 		t.Parallel()
 		rq := require.New(t)
 
-		q := query{
-			request: "tag1.tag2.tag3",
-		}
+		os.Args = []string{"xq", "--global-index", "tags", ".tag1[1]"}
 
-		st := q.getPath()
+		q := getQuery()
 
-		rq.Len(st, 3)
-		rq.Equal("tag1", st[0].Name)
-		rq.Equal(-1, st[0].Index)
-		rq.Equal("tag2", st[1].Name)
-		rq.Equal(-1, st[1].Index)
-		rq.Equal("tag3", st[2].Name)
-		rq.Equal(-1, st[2].Index)
+		rq.Equal(".tag1[1]", q.request)
+		rq.Equal("tags", q.firstArg)
+		rq.True(q.globalIndex)
 	})
 
-	t.Run("leading dot", func(t *testing.T) {
+	t.Run("variables", func(t *testing.T) {
 		t.Parallel()
 		rq := require.New(t)
 
-		q := query{
-			request: ".tag1.tag2.tag3",
-		}
+		os.Args = []string{"xq", "--arg", "id", "42", ".a[@id=$id]", "--argjson", "n", "1.5"}
 
-		st := q.getPath()
+		q := getQuery()
 
-		rq.Len(st, 3)
-		rq.Equal("tag1", st[0].Name)
-		rq.Equal(-1, st[0].Index)
-		rq.Equal("tag2", st[1].Name)
-		rq.Equal(-1, st[1].Index)
-		rq.Equal("tag3", st[2].Name)
-		rq.Equal(-1, st[2].Index)
-	})
-}
+		rq.Equal(".a[@id=$id]", q.request)
+		rq.Equal([]variable{{name: "id", value: "42"}, {name: "n", value: "1.5", json: true}}, q.variables)
 
-func TestGetQuery(t *testing.T) {
-	t.Parallel()
+		os.Args = []string{"xq", ".a[@id=$id]", "--arg", "id"}
 
-	t.Run("empty", func(t *testing.T) {
+		q = getQuery()
+
+		rq.Equal(".a[@id=$id]", q.request)
+		rq.EqualError(q.parse(), "flag `--arg` requires a value")
+	})
+
+	t.Run("paths", func(t *testing.T) {
 		t.Parallel()
 		rq := require.New(t)
 
-		os.Args = []string{"xq"}
+		os.Args = []string{"xq", "--with-attrs", "paths", "--with-values", "."}
 
 		q := getQuery()
 
 		rq.Equal(".", q.request)
+		rq.Equal("paths", q.firstArg)
+		rq.Equal(processor.PathOptions{Attributes: true, Values: true}, q.paths)
+
+		os.Args = []string{"xq", "paths"} // the root tag `paths`
+
+		q = getQuery()
+
+		rq.Equal("paths", q.request)
+		rq.Empty(q.firstArg)
+
+		os.Args = []string{"xq", "--with-path", ".a#id"}
+
+		q = getQuery()
+
+		rq.Equal(".a#id", q.request)
 		rq.Empty(q.firstArg)
+		rq.True(q.paths.Prefix)
 	})
 
-	t.Run("path only", func(t *testing.T) {
+	t.Run("text", func(t *testing.T) {
 		t.Parallel()
 		rq := require.New(t)
 
-		os.Args = []string{"xq", ".tag1.tag2"}
+		os.Args = []string{"xq", "-t", ".a.b", "-0"}
 
 		q := getQuery()
 
-		rq.Equal(".tag1.tag2", q.request)
-		rq.Empty(q.firstArg)
+		rq.Equal(".a.b", q.request)
+		rq.True(q.text)
+		rq.True(q.nul)
 	})
 
-	t.Run("path only", func(t *testing.T) {
+	t.Run("libraries", func(t *testing.T) {
 		t.Parallel()
 		rq := require.New(t)
 
-		os.Args = []string{"xq", "tags", ".tag1.tag2"}
+		os.Args = []string{"xq", "-L", "lib", "actors", "-L", "/usr/share/xq"}
 
 		q := getQuery()
 
-		rq.Equal(".tag1.tag2", q.request)
-		rq.Equal("tags", q.firstArg)
+		rq.Equal("actors", q.request)
+		rq.Equal([]string{"lib", "/usr/share/xq"}, q.libraries)
+
+		os.Args = []string{"xq", "actors", "-L"}
+
+		q = getQuery()
+
+		rq.Equal("actors", q.request)
+		rq.EqualError(q.parse(), "flag `-L` requires a value")
 	})
 
-	t.Run("path only", func(t *testing.T) {
+	t.Run("namespaces", func(t *testing.T) {
 		t.Parallel()
 		rq := require.New(t)
 
-		os.Args = []string{"xq", "attr", ".tag1.tag2#val"}
+		os.Args = []string{"xq", "--ns", "s=urn:soap", ".s:Body", "--ns", "m=urn:m"}
 
 		q := getQuery()
 
-		rq.Equal(".tag1.tag2#val", q.request)
-		rq.Equal("attr", q.firstArg)
+		rq.Equal(".s:Body", q.request)
+		rq.Equal([]string{"s=urn:soap", "m=urn:m"}, q.namespaces)
+
+		os.Args = []string{"xq", ".s:Body", "--ns"}
+
+		q = getQuery()
+
+		rq.Equal(".s:Body", q.request)
+		rq.EqualError(q.parse(), "flag `--ns` requires a value")
 	})
 }
 
@@ -169,11 +182,11 @@ func TestParseQuery(t *testing.T) {
 		t.Parallel()
 		rq := require.New(t)
 
-		q := query{
+		q := search{
 			request: ".",
 		}
 
-		q.parse()
+		rq.NoError(q.parse())
 
 		rq.Len(q.path, 0)
 		rq.Equal(domain.TagValue, q.searchType)
@@ -183,11 +196,11 @@ func TestParseQuery(t *testing.T) {
 		t.Parallel()
 		rq := require.New(t)
 
-		q := query{
+		q := search{
 			request: ".tag1.tag2",
 		}
 
-		q.parse()
+		rq.NoError(q.parse())
 
 		rq.Len(q.path, 2)
 		rq.Equal("tag1", q.path[0].Name)
@@ -199,12 +212,12 @@ func TestParseQuery(t *testing.T) {
 		t.Parallel()
 		rq := require.New(t)
 
-		q := query{
+		q := search{
 			request:  ".tag1.tag2",
 			firstArg: "tags",
 		}
 
-		q.parse()
+		rq.NoError(q.parse())
 
 		rq.Len(q.path, 2)
 		rq.Equal("tag1", q.path[0].Name)
@@ -216,12 +229,12 @@ func TestParseQuery(t *testing.T) {
 		t.Parallel()
 		rq := require.New(t)
 
-		q := query{
+		q := search{
 			request:  ".tag1.tag2",
 			firstArg: "attr",
 		}
 
-		q.parse()
+		rq.NoError(q.parse())
 
 		rq.Len(q.path, 2)
 		rq.Equal("tag1", q.path[0].Name)
@@ -233,16 +246,550 @@ func TestParseQuery(t *testing.T) {
 		t.Parallel()
 		rq := require.New(t)
 
-		q := query{
+		q := search{
 			request: ".tag1.tag2#attr_name",
 		}
 
-		q.parse()
+		rq.NoError(q.parse())
 
 		rq.Len(q.path, 2)
 		rq.Equal("tag1", q.path[0].Name)
 		rq.Equal("tag2", q.path[1].Name)
-		rq.Equal("attr_name", q.attribute)
+		rq.Equal(domain.Attribute{Name: "attr_name"}, q.attribute)
+		rq.Equal(domain.AttrValue, q.searchType)
+	})
+
+	t.Run("with several attributes", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		q := search{
+			request: ".tag1#/^data-/",
+		}
+		rq.NoError(q.parse())
+		rq.Equal(domain.Attribute{Pattern: "^data-"}, q.attribute)
+		rq.Equal(domain.AttrValue, q.searchType)
+
+		q = search{
+			request:  ".tag1#*",
+			firstArg: "attr",
+		}
+		rq.NoError(q.parse())
+		rq.Equal(domain.Attribute{Name: domain.Wildcard}, q.attribute)
+		rq.Equal(domain.AttrList, q.searchType)
+	})
+
+	t.Run("union", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		q := search{
+			request:  ".tag1.tag2, .tag1[@id='a,b'].tag3#attr_name",
+			firstArg: "tags",
+		}
+
+		rq.NoError(q.parse())
+
+		rq.Len(q.union, 2)
+		rq.Equal([]string{"tag1", "tag2"}, []string{q.union[0].path[0].Name, q.union[0].path[1].Name})
+		rq.Equal(domain.TagList, q.union[0].searchType)
+		rq.Len(q.union[1].path, 2)
+		rq.Equal("a,b", q.union[1].path[0].Filters[0].Value)
+		rq.Equal(domain.Attribute{Name: "attr_name"}, q.union[1].attribute)
+		rq.Equal(domain.AttrValue, q.union[1].searchType)
+	})
+
+	t.Run("pipe", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		q := search{
+			request: ".tag1[@re=~'a|b'] | ..tag2 | .tag3#attr_name",
+		}
+
+		rq.NoError(q.parse())
+
+		rq.Empty(q.union)
+		rq.Len(q.path, 3)
+		rq.Equal("tag1", q.path[0].Name)
+		rq.Equal("a|b", q.path[0].Filters[0].Value)
+		rq.Equal("tag2", q.path[1].Name)
+		rq.True(q.path[1].Descendant)
+		rq.Equal("tag3", q.path[2].Name)
+		rq.False(q.path[2].Descendant)
+		rq.Equal(domain.Attribute{Name: "attr_name"}, q.attribute)
 		rq.Equal(domain.AttrValue, q.searchType)
 	})
+
+	t.Run("pipe to identity", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		q := search{
+			request:  ".tag1.tag2 | .",
+			firstArg: "tags",
+		}
+
+		rq.NoError(q.parse())
+
+		rq.Len(q.path, 2)
+		rq.Equal(domain.TagList, q.searchType)
+	})
+
+	t.Run("functions", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for request, searchType := range map[string]domain.SearchType{
+			"count(.a.b)":        domain.TagCount,
+			"length(.a.b)":       domain.TagCount,
+			"name(.a.*)":         domain.TagName,
+			"text(.a.b)":         domain.TagText,
+			"keys(.a)":           domain.TagList,
+			"attrs(.a)":          domain.AttrList,
+			"attrs(.a#/^data-/)": domain.AttrList,
+		} {
+			q := search{
+				request: request,
+			}
+			rq.NoError(q.parse(), request)
+			rq.Equal(searchType, q.searchType, request)
+		}
+
+		q := search{
+			request: "count(.a.b, .a.c)",
+		}
+		rq.NoError(q.parse())
+		rq.Len(q.union, 2)
+		rq.Equal(domain.TagCount, q.union[1].searchType)
+	})
+
+	t.Run("invalid functions", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for _, q := range []search{
+			{request: "count(.a#id)"},
+			{request: "attrs(.a#id)"},
+			{request: "count(.a)", firstArg: "tags"},
+		} {
+			rq.Error(q.parse(), q.request)
+		}
+	})
+
+	t.Run("string functions", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		q := search{
+			request: ".tag1.tag2 | trim",
+		}
+		rq.NoError(q.parse())
+		rq.Equal([]domain.Function{{Name: "trim"}}, q.transforms)
+		rq.Equal(domain.TagText, q.searchType)
+
+		q = search{
+			request: ".tag1#id, .tag2#id | split(',')",
+		}
+		rq.NoError(q.parse())
+		rq.Len(q.union, 2)
+		rq.Equal(domain.AttrValue, q.union[1].searchType)
+
+		q = search{
+			request: "name(.tag1.*) | upper",
+		}
+		rq.NoError(q.parse())
+		rq.Equal(domain.TagName, q.searchType)
+		rq.Len(q.transforms, 1)
+	})
+
+	t.Run("aggregations", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		q := search{
+			request: "sum(.a.b#price)",
+		}
+		rq.NoError(q.parse())
+		rq.Equal(domain.AttrValue, q.searchType)
+		rq.True(q.isAggregation())
+
+		q = search{
+			request: "group_by(.a.b; .#type) | avg(.c)",
+		}
+		rq.NoError(q.parse())
+		rq.Equal(domain.TagRaw, q.searchType)
+		rq.Equal([]string{"a", "b"}, []string{q.path[0].Name, q.path[1].Name})
+		rq.Equal(domain.AttrValue, q.key.searchType)
+		rq.Equal(domain.Attribute{Name: "type"}, q.key.attribute)
+		rq.Equal([]string{domain.Wildcard}, []string{q.key.path[0].Name})
+		rq.Equal("avg", q.aggregation)
+		rq.Equal(domain.TagText, q.value.searchType)
+		rq.Len(q.value.path, 2)
+
+		for _, request := range []string{
+			"group_by(.a#id; .b)",
+			"group_by(.a; .b, .c)",
+			"group_by(.a; .#*)",
+			"sum(.a#*)",
+		} {
+			q = search{
+				request: request,
+			}
+			rq.Error(q.parse(), request)
+		}
+	})
+
+	t.Run("variables", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		q := search{
+			request: ".a[@id=$id][@n=$n][@ok=$ok]",
+			variables: []variable{
+				{name: "id", value: `"42"`, json: true},
+				{name: "n", value: "1e3", json: true},
+				{name: "ok", value: "true", json: true},
+			},
+		}
+		rq.NoError(q.parse())
+		filters := q.path[0].Filters
+		rq.Equal([]string{"42", "1e3", "true"}, []string{filters[0].Value, filters[1].Value, filters[2].Value})
+
+		for _, v := range []variable{
+			{name: "id", value: "[42]", json: true},
+			{name: "id", value: "null", json: true},
+			{name: "id", value: "42 43", json: true},
+			{name: "ENV", value: "42"},
+		} {
+			q = search{
+				request:   ".a[@id=$id]",
+				variables: []variable{v},
+			}
+			rq.Error(q.parse(), v.value)
+		}
+	})
+
+	t.Run("libraries", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		dir := filepath.Join(t.TempDir(), "lib[1]*?") // names aren't patterns
+		rq.NoError(os.Mkdir(dir, 0o700))
+		rq.NoError(os.WriteFile(filepath.Join(dir, "a.xq"), []byte("def objects: .objects.object;"), 0o600))
+		rq.NoError(os.WriteFile(filepath.Join(dir, "b.xq"), []byte("def actors: objects | .actors.actor;"), 0o600))
+		rq.NoError(os.WriteFile(filepath.Join(dir, "c.txt"), []byte("actors"), 0o600))
+
+		q := search{
+			request:   "count(actors)",
+			libraries: []string{dir},
+		}
+		rq.NoError(q.parse())
+		rq.Equal(domain.TagCount, q.searchType)
+		rq.Len(q.path, 4)
+
+		q = search{
+			request:   "actors",
+			libraries: []string{dir, filepath.Join(dir, "a.xq")},
+		}
+		rq.Error(q.parse())
+
+		rq.NoError(os.WriteFile(filepath.Join(dir, "d.xq"), []byte("actors"), 0o600))
+		q = search{
+			request:   "actors",
+			libraries: []string{dir},
+		}
+		rq.EqualError(q.parse(), "library "+filepath.Join(dir, "d.xq")+": line 1, column 1: unexpected `actors`, "+
+			"expected `def`")
+
+		rq.NoError(os.WriteFile(filepath.Join(dir, "d.xq"), []byte("def broken: .objects.object[@id=;"), 0o600))
+		err := q.parse()
+		rq.Equal("invalid query: library "+filepath.Join(dir, "d.xq")+": line 1, column 33: unexpected end of query, "+
+			"expected value", queryError(q.request, err))
+	})
+
+	t.Run("paths", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		q := search{
+			firstArg: "paths",
+			request:  ".a, .b",
+			paths:    processor.PathOptions{Values: true},
+		}
+		rq.NoError(q.parse())
+		rq.Equal(domain.TagPath, q.union[0].searchType)
+		rq.Equal(processor.PathOptions{Values: true}, q.union[1].paths)
+
+		q = search{
+			request: ".a.b#id",
+			paths:   processor.PathOptions{Prefix: true},
+		}
+		rq.NoError(q.parse())
+		rq.Equal(domain.AttrValue, q.searchType)
+
+		for _, q := range []search{
+			{firstArg: "paths", request: ".a#id"},
+			{request: ".a", paths: processor.PathOptions{Attributes: true}},
+			{firstArg: "tags", request: ".a", paths: processor.PathOptions{Prefix: true}},
+			{request: "count(.a)", paths: processor.PathOptions{Prefix: true}},
+			{request: ".a | upper", paths: processor.PathOptions{Prefix: true}},
+		} {
+			rq.Error(q.parse(), q.request)
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for request, searchType := range map[string]domain.SearchType{
+			".a.b":       domain.TagText,
+			"text(.a.b)": domain.TagText,
+			".a.b#id":    domain.AttrValue,
+		} {
+			q := search{
+				request: request,
+				text:    true,
+			}
+			rq.NoError(q.parse(), request)
+			rq.Equal(searchType, q.searchType, request)
+		}
+
+		q := search{
+			request: "text(.)",
+		}
+		rq.NoError(q.parse())
+		rq.Equal([]domain.Step{{Name: domain.Wildcard, Index: -1}}, q.path)
+
+		for _, q := range []search{
+			{request: ".a", firstArg: "tags", text: true},
+			{request: "count(.a)", text: true},
+			{request: ".a | reverse", text: true},
+		} {
+			rq.Error(q.parse(), q.request)
+		}
+	})
+
+	t.Run("orders", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		q := search{
+			request: ".a.b, .a.c | sort_by(.#id) | reverse",
+		}
+		rq.NoError(q.parse())
+		rq.Len(q.union, 2)
+		rq.Equal(domain.TagRaw, q.union[1].searchType)
+		rq.Len(q.orders, 2)
+		rq.Equal(query.FunctionSortBy, q.orders[0].function)
+		rq.Equal(domain.AttrValue, q.orders[0].key.searchType)
+		rq.Equal(order{function: query.FunctionReverse}, q.orders[1])
+
+		q = search{
+			firstArg: "tags",
+			request:  ".a | unique",
+		}
+		rq.Error(q.parse())
+
+		q = search{
+			request: ".a | sort_by(.b, .c)",
+		}
+		rq.Error(q.parse())
+	})
+
+	t.Run("edits", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		q := search{
+			request: `.a.b#url |= sub("http:"; "https:")`,
+		}
+		rq.NoError(q.parse())
+		rq.Equal(domain.TagEdit, q.searchType)
+		rq.Equal("url", q.attribute.Name)
+		rq.Equal(&processor.Edit{
+			Operator:  domain.EditUpdate,
+			Functions: []domain.Function{{Name: "sub", Args: []string{"http:", "https:"}}},
+		}, q.edit)
+
+		q = search{
+			request: `del(.a.b)`,
+		}
+		rq.NoError(q.parse())
+		rq.Equal(domain.TagEdit, q.searchType)
+		rq.Equal(&processor.Edit{Operator: domain.EditDelete}, q.edit)
+
+		q = search{
+			request: `wrap(.a.b; <c/>)`,
+		}
+		rq.NoError(q.parse())
+		rq.Equal(domain.TagEdit, q.searchType)
+		rq.Equal(&processor.Edit{Operator: domain.EditWrap, Value: "<c/>"}, q.edit)
+
+		q = search{
+			request: `. = "x"`,
+		}
+		rq.NoError(q.parse())
+		rq.Equal([]domain.Step{{Name: domain.Wildcard, Index: -1}}, q.path)
+
+		for _, q := range []search{
+			{request: `.a = "x"`, firstArg: "tags"},
+			{request: `.a = "x"`, text: true},
+			{request: `.a = "x"`, paths: processor.PathOptions{Prefix: true}},
+			{request: `del(.a)`, firstArg: "attr"},
+			{request: `.a += <b/>`, text: true},
+		} {
+			rq.Error(q.parse(), q.request)
+		}
+	})
+
+	t.Run("select", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		q := search{
+			request: ".tag1.tag2[1:] | select(.price < 10 or not(@id))",
+		}
+
+		rq.NoError(q.parse())
+
+		rq.Len(q.path, 2)
+		rq.NotNil(q.path[1].Condition)
+		rq.Equal(domain.ConditionOr, q.path[1].Condition.Operator)
+		rq.Equal(&domain.Slice{Start: 1, Step: 1}, q.path[1].Slice)
+	})
+
+	t.Run("index inside every parent", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		q := search{
+			request: ".tag1.tag2[1]",
+		}
+
+		rq.NoError(q.parse())
+
+		rq.Len(q.path, 2)
+		rq.Equal(-1, q.path[1].Index)
+		rq.Equal(&domain.Slice{Start: 1, End: 2, HasEnd: true, Step: 1}, q.path[1].Slice)
+	})
+
+	t.Run("global index", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		q := search{
+			request:     ".tag1.tag2[1]",
+			globalIndex: true,
+		}
+
+		rq.NoError(q.parse())
+
+		rq.Len(q.path, 2)
+		rq.Equal(1, q.path[1].Index)
+		rq.Nil(q.path[1].Slice)
+	})
+}
+
+func TestParseQueryNamespaces(t *testing.T) {
+	t.Parallel()
+
+	t.Run("bound prefixes", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		q := search{
+			request:    ".s:Envelope.s:Body.m:Item.{urn:x}s:Data",
+			namespaces: []string{"s=urn:soap", "x=urn:unused"},
+		}
+
+		rq.NoError(q.parse())
+
+		rq.Len(q.path, 4)
+		rq.Equal(domain.Step{Name: "Envelope", Index: -1, Namespace: "urn:soap"}, q.path[0])
+		rq.Equal(domain.Step{Name: "Body", Index: -1, Namespace: "urn:soap"}, q.path[1])
+		rq.Equal(domain.Step{Name: "m:Item", Index: -1}, q.path[2])
+		rq.Equal(domain.Step{Name: "s:Data", Index: -1, Namespace: "urn:x"}, q.path[3])
+	})
+
+	t.Run("bound prefixes of attributes", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		q := search{
+			request:    ".a[@x:href][@m:id] | select(@x:role = 'a' or @id) | .#x:title",
+			namespaces: []string{"x=http://www.w3.org/1999/xlink"},
+		}
+
+		rq.NoError(q.parse())
+
+		rq.Len(q.path, 1)
+		filters := q.path[0].Filters
+		rq.Len(filters, 2)
+		rq.Equal("href", filters[0].Attribute)
+		rq.Equal("http://www.w3.org/1999/xlink", filters[0].Namespace)
+		rq.Equal("m:id", filters[1].Attribute)
+		rq.Empty(filters[1].Namespace)
+		condition := q.path[0].Condition.Filters()
+		rq.Len(condition, 2)
+		rq.Equal("role", condition[0].Attribute)
+		rq.Equal("http://www.w3.org/1999/xlink", condition[0].Namespace)
+		rq.Equal("id", condition[1].Attribute)
+		rq.Empty(condition[1].Namespace)
+		rq.Equal(domain.Attribute{Name: "title", Namespace: "http://www.w3.org/1999/xlink"}, q.attribute)
+	})
+
+	t.Run("invalid binding", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		for _, b := range []string{"s", "=urn:a", "s="} {
+			q := search{
+				request:    ".a",
+				namespaces: []string{b},
+			}
+
+			rq.Error(q.parse(), b)
+		}
+	})
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("invalid query", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		q := search{
+			request: ".a#b#c",
+		}
+
+		err := q.parse()
+		rq.Error(err)
+		rq.Equal("invalid query: column 5: unexpected `#`, expected end of query\n\t.a#b#c\n\t    ^",
+			queryError(q.request, err))
+	})
+
+	t.Run("unknown command", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		q := search{
+			request:  ".a",
+			firstArg: "tag",
+		}
+
+		err := q.parse()
+		rq.Error(err)
+		rq.Equal("invalid query: unknown command `tag`", queryError(q.request, err))
+	})
+
+	t.Run("not a query error", func(t *testing.T) {
+		t.Parallel()
+		rq := require.New(t)
+
+		rq.Equal("invalid query: error", queryError(".", errors.New("error")))
+	})
 }